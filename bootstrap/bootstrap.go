@@ -62,6 +62,10 @@ const (
 	DefaultCookieSameSite           = http.SameSiteNoneMode
 )
 
+// minPairwiseSubjectSecretSize is the minimal size of the secret used to
+// derive pairwise subject identifiers.
+const minPairwiseSubjectSecretSize = 32
+
 // Bootstrap is a data structure to hold configuration required to start
 // konnectd.
 type Bootstrap interface {
@@ -227,8 +231,41 @@ func (bs *bootstrap) initialize(settings *Settings) error {
 		bs.config.EncryptionSecret = rndm.GenerateRandomBytes(encryption.KeySize)
 	}
 
+	pairwiseSubjectSecretFn := settings.PairwiseSubjectSecretFile
+	if pairwiseSubjectSecretFn != "" {
+		logger.WithField("file", pairwiseSubjectSecretFn).Infoln("loading pairwise subject secret from file")
+		bs.config.PairwiseSubjectSecret, err = ioutil.ReadFile(pairwiseSubjectSecretFn)
+		if err != nil {
+			return fmt.Errorf("failed to load pairwise subject secret from file: %v", err)
+		}
+		if len(bs.config.PairwiseSubjectSecret) < minPairwiseSubjectSecretSize {
+			return fmt.Errorf("invalid pairwise subject secret size - must be at least %d bytes", minPairwiseSubjectSecretSize)
+		}
+	} else {
+		logger.Infoln("pairwise subject identifiers are disabled, set --pairwise-subject-secret to enable")
+	}
+
 	bs.config.Config.ListenAddr = settings.Listen
 
+	if settings.TLSCertFile != "" || settings.TLSKeyFile != "" {
+		if settings.TLSCertFile == "" || settings.TLSKeyFile == "" {
+			return fmt.Errorf("tls-cert and tls-key must be set together")
+		}
+		bs.config.Config.TLSCertFile = settings.TLSCertFile
+		bs.config.Config.TLSKeyFile = settings.TLSKeyFile
+	}
+	if settings.TLSClientCAFile != "" {
+		logger.WithField("file", settings.TLSClientCAFile).Infoln("loading TLS client certificate authorities from file")
+		caBytes, errRead := ioutil.ReadFile(settings.TLSClientCAFile)
+		if errRead != nil {
+			return fmt.Errorf("failed to load tls-client-ca file: %v", errRead)
+		}
+		bs.config.Config.TLSClientCAs = x509.NewCertPool()
+		if !bs.config.Config.TLSClientCAs.AppendCertsFromPEM(caBytes) {
+			return fmt.Errorf("no certificates found in tls-client-ca file")
+		}
+	}
+
 	bs.config.IdentifierClientDisabled = settings.IdentifierClientDisabled
 	bs.config.IdentifierClientPath = settings.IdentifierClientPath
 
@@ -334,6 +371,21 @@ func (bs *bootstrap) initialize(settings *Settings) error {
 	}
 	bs.config.DyamicClientSecretDurationSeconds = settings.DyamicClientSecretDurationSeconds
 
+	bs.config.RevocationStoreFile = settings.RevocationStoreFile
+	if bs.config.RevocationStoreFile != "" {
+		bs.config.RevocationStoreFile, _ = filepath.Abs(bs.config.RevocationStoreFile)
+	}
+
+	bs.config.DynamicClientStoreFile = settings.DynamicClientStoreFile
+	if bs.config.DynamicClientStoreFile != "" {
+		bs.config.DynamicClientStoreFile, _ = filepath.Abs(bs.config.DynamicClientStoreFile)
+	}
+
+	bs.config.SignedMetadata = settings.SignedMetadata
+	if bs.config.SignedMetadata {
+		logger.Infoln("signed authorization server metadata is enabled")
+	}
+
 	// add setting to allow setting the same site attribute of the cookies
 	bs.config.CookieSameSite = settings.CookieSameSite
 	if bs.config.CookieSameSite == 0 {
@@ -472,6 +524,7 @@ func (bs *bootstrap) setupOIDCProvider(ctx context.Context) (*oidcProvider.Provi
 
 		IssuerIdentifier:       bs.config.IssuerIdentifierURI.String(),
 		WellKnownPath:          "/.well-known/openid-configuration",
+		MetadataPath:           "/.well-known/oauth-authorization-server",
 		JwksPath:               bs.MakeURIPath(APITypeKonnect, "/jwks.json"),
 		AuthorizationPath:      bs.config.AuthorizationEndpointURI.EscapedPath(),
 		TokenPath:              bs.MakeURIPath(APITypeKonnect, "/token"),
@@ -480,6 +533,13 @@ func (bs *bootstrap) setupOIDCProvider(ctx context.Context) (*oidcProvider.Provi
 		CheckSessionIframePath: bs.MakeURIPath(APITypeKonnect, "/session/check-session.html"),
 		RegistrationPath:       registrationPath,
 
+		DeviceAuthorizationPath: bs.MakeURIPath(APITypeKonnect, "/device"),
+		DeviceVerificationPath:  bs.MakeURIPath(APITypeSignin, "/device"),
+		IntrospectionPath:       bs.MakeURIPath(APITypeKonnect, "/introspect"),
+		RevocationPath:          bs.MakeURIPath(APITypeKonnect, "/revoke"),
+
+		PushedAuthorizationRequestPath: bs.MakeURIPath(APITypeKonnect, "/par"),
+
 		BrowserStateCookiePath:     bs.MakeURIPath(APITypeKonnect, "/session/"),
 		BrowserStateCookieName:     "__Secure-KKBS", // Kopano-Konnect-Browser-State
 		BrowserStateCookieSameSite: bs.config.CookieSameSite,
@@ -491,6 +551,10 @@ func (bs *bootstrap) setupOIDCProvider(ctx context.Context) (*oidcProvider.Provi
 		AccessTokenDuration:  time.Duration(bs.config.AccessTokenDurationSeconds) * time.Second,
 		IDTokenDuration:      time.Duration(bs.config.IDTokenDurationSeconds) * time.Second,
 		RefreshTokenDuration: time.Duration(bs.config.RefreshTokenDurationSeconds) * time.Second,
+
+		PairwiseSubjectSecret: bs.config.PairwiseSubjectSecret,
+
+		SignedMetadata: bs.config.SignedMetadata,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create provider: %v", err)
@@ -61,10 +61,17 @@ type Config struct {
 	Validators       map[string]crypto.PublicKey
 	Certificates     map[string][]*x509.Certificate
 
+	PairwiseSubjectSecret []byte
+
 	AccessTokenDurationSeconds        uint64
 	IDTokenDurationSeconds            uint64
 	RefreshTokenDurationSeconds       uint64
 	DyamicClientSecretDurationSeconds uint64
 
+	RevocationStoreFile    string
+	DynamicClientStoreFile string
+
+	SignedMetadata bool
+
 	CookieSameSite http.SameSite
 }
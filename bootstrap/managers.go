@@ -25,9 +25,14 @@ import (
 	"github.com/libregraph/lico/identity"
 	identityAuthorities "github.com/libregraph/lico/identity/authorities"
 	identityClients "github.com/libregraph/lico/identity/clients"
+	identityClientsStores "github.com/libregraph/lico/identity/clients/stores"
 	identityManagers "github.com/libregraph/lico/identity/managers"
 	"github.com/libregraph/lico/managers"
 	codeManagers "github.com/libregraph/lico/oidc/code/managers"
+	deviceManagers "github.com/libregraph/lico/oidc/device/managers"
+	parManagers "github.com/libregraph/lico/oidc/par/managers"
+	"github.com/libregraph/lico/oidc/revocation"
+	revocationStores "github.com/libregraph/lico/oidc/revocation/stores"
 )
 
 type IdentityManagerFactory func(Bootstrap) (identity.Manager, error)
@@ -70,11 +75,42 @@ func newManagers(ctx context.Context, bs *bootstrap) (*managers.Managers, error)
 	code := codeManagers.NewMemoryMapManager(ctx)
 	mgrs.Set("code", code)
 
+	// OAuth2 device authorization manager.
+	device := deviceManagers.NewMemoryMapManager(ctx)
+	mgrs.Set("device", device)
+
+	// OAuth2 pushed authorization request manager.
+	par := parManagers.NewMemoryMapManager(ctx)
+	mgrs.Set("par", par)
+
+	// OAuth2 token revocation store.
+	var revocationStore revocation.Store
+	if bs.config.RevocationStoreFile != "" {
+		revocationStore, err = revocationStores.NewFileStore(ctx, bs.config.RevocationStoreFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create revocation store: %v", err)
+		}
+	} else {
+		revocationStore = revocationStores.NewMemoryMapStore(ctx)
+	}
+	mgrs.Set("revocation", revocationStore)
+
 	// Identifier client registry manager.
 	clients, err := identityClients.NewRegistry(ctx, bs.config.IssuerIdentifierURI, bs.config.IdentifierRegistrationConf, bs.config.Config.AllowDynamicClientRegistration, time.Duration(bs.config.DyamicClientSecretDurationSeconds)*time.Second, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client registry: %v", err)
 	}
+	if bs.config.Config.AllowDynamicClientRegistration {
+		// Dynamic client store, allows dynamic clients to manage their registration.
+		if bs.config.DynamicClientStoreFile != "" {
+			clients.Store, err = identityClientsStores.NewFileStore(ctx, bs.config.DynamicClientStoreFile, logger)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create dynamic client store: %v", err)
+			}
+		} else {
+			clients.Store = identityClientsStores.NewMemoryMapStore(ctx)
+		}
+	}
 	mgrs.Set("clients", clients)
 
 	// Identifier authorities registry manager.
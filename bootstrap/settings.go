@@ -37,7 +37,11 @@ type Settings struct {
 	AllowClientGuests                 bool
 	AllowDynamicClientRegistration    bool
 	EncryptionSecretFile              string
+	PairwiseSubjectSecretFile         string
 	Listen                            string
+	TLSCertFile                       string
+	TLSKeyFile                        string
+	TLSClientCAFile                   string
 	IdentifierClientDisabled          bool
 	IdentifierClientPath              string
 	IdentifierRegistrationConf        string
@@ -57,4 +61,7 @@ type Settings struct {
 	IDTokenDurationSeconds            uint64
 	RefreshTokenDurationSeconds       uint64
 	DyamicClientSecretDurationSeconds uint64
+	RevocationStoreFile               string
+	DynamicClientStoreFile            string
+	SignedMetadata                    bool
 }
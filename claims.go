@@ -29,6 +29,7 @@ import (
 // Access token claims used.
 const (
 	RefClaim              = "lg.r"
+	RefFamilyClaim        = "lg.f"
 	IdentityClaim         = "lg.i"
 	IdentityProviderClaim = "lg.p"
 	ScopesClaim           = "scp"
@@ -71,14 +72,27 @@ type AccessTokenClaims struct {
 
 	TokenType TokenTypeValue `json:"lg.t"`
 
+	ClientID        string `json:"client_id,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+
 	AuthorizedClaimsRequest *payload.ClaimsRequest `json:"lg.acr,omitempty"`
 
 	AuthorizedScopesList payload.ScopesValue `json:"scp"`
 
+	Family string `json:"lg.f,omitempty"`
+
 	IdentityClaims   jwt.MapClaims `json:"lg.i"`
 	IdentityProvider string        `json:"lg.p,omitempty"`
 
+	Actor *ActorClaims `json:"act,omitempty"`
+
+	Confirmation *payload.ConfirmationClaims `json:"cnf,omitempty"`
+
+	AuthorizationDetails payload.AuthorizationDetails `json:"authorization_details,omitempty"`
+
 	*oidc.SessionClaims
+	*oidc.AuthContextClaims
 }
 
 // Valid implements the jwt.Claims interface.
@@ -108,6 +122,28 @@ func (c AccessTokenClaims) AuthorizedScopes() map[string]bool {
 	return authorizedScopes
 }
 
+// Client returns the ID of the client to which the accociated access token was
+// issued. Access tokens for resources carry the resource as audience and the
+// client either in the client_id or the azp claim.
+func (c AccessTokenClaims) Client() string {
+	if c.ClientID != "" {
+		return c.ClientID
+	}
+	if c.AuthorizedParty != "" {
+		return c.AuthorizedParty
+	}
+	return c.Audience
+}
+
+// ActorClaims define the claims of the actor claim used for delegation as
+// specified at https://tools.ietf.org/html/rfc8693#section-4.1. Nested actors
+// represent the prior actors of a delegation chain.
+type ActorClaims struct {
+	Subject string `json:"sub"`
+
+	Actor *ActorClaims `json:"act,omitempty"`
+}
+
 // RefreshTokenClaims define the claims used by refresh tokens.
 type RefreshTokenClaims struct {
 	jwt.StandardClaims
@@ -118,9 +154,17 @@ type RefreshTokenClaims struct {
 
 	ApprovedClaimsRequest *payload.ClaimsRequest `json:"lg.acr,omitempty"`
 	Ref                   string                 `json:"lg.r"`
+	Family                string                 `json:"lg.f,omitempty"`
+	Resources             []string               `json:"lg.res,omitempty"`
 
 	IdentityClaims   jwt.MapClaims `json:"lg.i"`
 	IdentityProvider string        `json:"lg.p,omitempty"`
+
+	Confirmation *payload.ConfirmationClaims `json:"cnf,omitempty"`
+
+	AuthorizationDetails payload.AuthorizationDetails `json:"lg.ad,omitempty"`
+
+	*oidc.AuthContextClaims
 }
 
 // Valid implements the jwt.Claims interface.
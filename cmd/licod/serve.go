@@ -77,11 +77,15 @@ func commandServe() *cobra.Command {
 	cfg := bootstrapConfig
 
 	serveCmd.Flags().StringVar(&cfg.Listen, "listen", envOrDefault("LICOD_LISTEN", defaultListenAddr), fmt.Sprintf("TCP listen address (default \"%s\")", defaultListenAddr))
+	serveCmd.Flags().StringVar(&cfg.TLSCertFile, "tls-cert", os.Getenv("LICOD_TLS_CERT"), "Full path to PEM encoded certificate file to serve TLS with (requires --tls-key)")
+	serveCmd.Flags().StringVar(&cfg.TLSKeyFile, "tls-key", os.Getenv("LICOD_TLS_KEY"), "Full path to PEM encoded private key file of the --tls-cert certificate")
+	serveCmd.Flags().StringVar(&cfg.TLSClientCAFile, "tls-client-ca", os.Getenv("LICOD_TLS_CLIENT_CA"), "Full path to PEM encoded CA certificates file used to validate tls_client_auth client certificates")
 	serveCmd.Flags().StringVar(&cfg.Iss, "iss", "", "OIDC issuer URL")
 	serveCmd.Flags().StringArrayVar(&cfg.SigningPrivateKeyFiles, "signing-private-key", listEnvArg("LICOD_SIGNING_PRIVATE_KEY"), "Full path to PEM encoded private key file (must match the --signing-method algorithm)")
 	serveCmd.Flags().StringVar(&cfg.SigningKid, "signing-kid", os.Getenv("LICOD_SIGNING_KID"), "Value of kid field to use in created tokens (uniquely identifying the signing-private-key)")
 	serveCmd.Flags().StringVar(&cfg.ValidationKeysPath, "validation-keys-path", os.Getenv("LICOD_VALIDATION_KEYS_PATH"), "Full path to a folder containing PEM encoded private or public key files used for token validaton (file name without extension is used as kid)")
 	serveCmd.Flags().StringVar(&cfg.EncryptionSecretFile, "encryption-secret", os.Getenv("LICOD_ENCRYPTION_SECRET"), fmt.Sprintf("Full path to a file containing a %d bytes secret key", encryption.KeySize))
+	serveCmd.Flags().StringVar(&cfg.PairwiseSubjectSecretFile, "pairwise-subject-secret", os.Getenv("LICOD_PAIRWISE_SUBJECT_SECRET"), "Full path to a file containing a secret key of at least 32 bytes to derive pairwise subject identifiers with (enables the pairwise subject type)")
 	serveCmd.Flags().StringVar(&cfg.SigningMethod, "signing-method", "PS256", "JWT default signing method")
 	serveCmd.Flags().StringVar(&cfg.URIBasePath, "uri-base-path", "", "Custom base path for URI endpoints")
 	serveCmd.Flags().StringVar(&cfg.SignInURI, "sign-in-uri", "", "Custom redirection URI to sign-in form")
@@ -105,6 +109,9 @@ func commandServe() *cobra.Command {
 	serveCmd.Flags().Uint64Var(&cfg.IDTokenDurationSeconds, "id-token-expiration", 60*60, "Expiration time of id tokens in seconds since generated")                                                         // 1 Hour.
 	serveCmd.Flags().Uint64Var(&cfg.RefreshTokenDurationSeconds, "refresh-token-expiration", 60*60*24*365*3, "Expiration time of refresh tokens in seconds since generated")                                 // 3 Years.
 	serveCmd.Flags().Uint64Var(&cfg.DyamicClientSecretDurationSeconds, "dynamic-client-secret-expiration", 0, "Expiration time of generated dynamic OAuth2 client client_secret in seconds since generated") // 0 by default -> does not expire.
+	serveCmd.Flags().StringVar(&cfg.RevocationStoreFile, "revocation-store-file", os.Getenv("LICOD_REVOCATION_STORE_FILE"), "Path to a file to persist revoked tokens (if not set, revoked tokens are kept in memory only)")
+	serveCmd.Flags().StringVar(&cfg.DynamicClientStoreFile, "dynamic-client-store-file", os.Getenv("LICOD_DYNAMIC_CLIENT_STORE_FILE"), "Path to a file to persist updates and deletions of dynamically registered clients (if not set, they are kept in memory only)")
+	serveCmd.Flags().BoolVar(&cfg.SignedMetadata, "signed-metadata", false, "Include signed_metadata in the OAuth 2.0 authorization server metadata")
 	serveCmd.Flags().Bool("log-timestamp", true, "Prefix each log line with timestamp")
 	serveCmd.Flags().String("log-level", "info", "Log level (one of panic, fatal, error, warn, info or debug)")
 	serveCmd.Flags().Bool("with-pprof", false, "With pprof enabled")
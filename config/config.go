@@ -18,6 +18,7 @@
 package config
 
 import (
+	"crypto/x509"
 	"net"
 	"net/http"
 
@@ -28,6 +29,10 @@ import (
 type Config struct {
 	ListenAddr string
 
+	TLSCertFile  string
+	TLSKeyFile   string
+	TLSClientCAs *x509.CertPool
+
 	WithMetrics bool
 
 	Logger        logrus.FieldLogger
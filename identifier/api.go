@@ -125,6 +125,10 @@ handleHelloLoop:
 		if !clientDetails.Trusted {
 			promptConsent = true
 		}
+		// Authorization details always need consent of the user.
+		if len(r.AuthorizationDetails) > 0 {
+			promptConsent = true
+		}
 
 		if promptConsent {
 			// TODO(longsleep): Filter scopes to scopes we know about and all.
@@ -134,6 +138,15 @@ handleHelloLoop:
 			response.Meta = &meta.Meta{
 				Scopes: scopes.NewScopesFromIDs(r.Scopes, i.meta.Scopes),
 			}
+			if len(r.AuthorizationDetails) > 0 {
+				response.AuthorizationDetails = r.AuthorizationDetails
+				response.Meta.AuthorizationDetailsTypes = make(map[string]string)
+				for _, ad := range r.AuthorizationDetails {
+					if typeRegistration, ok := i.clients.GetAuthorizationDetailsType(req.Context(), ad.Type()); ok && typeRegistration.Description != "" {
+						response.Meta.AuthorizationDetailsTypes[ad.Type()] = typeRegistration.Description
+					}
+				}
+			}
 		}
 
 		// Add authorize endpoint URI as continue URI.
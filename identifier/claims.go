@@ -23,6 +23,8 @@ const (
 	LogonRefClaim            = "lref"
 	ExternalAuthorityIDClaim = "eaid"
 	LockedScopesClaim        = "lscp"
+	AuthContextClassClaim    = "acr"
+	AuthMethodsClaim         = "amr"
 )
 
 // History claims previously used by the identifier in its own tokens.
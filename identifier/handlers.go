@@ -30,6 +30,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/libregraph/lico/identity/authorities"
+	konnectoidc "github.com/libregraph/lico/oidc"
 	"github.com/libregraph/lico/utils"
 )
 
@@ -164,6 +165,30 @@ func (i *Identifier) handleIdentifier(rw http.ResponseWriter, req *http.Request)
 	i.writeWebappIndexHTML(rw, req)
 }
 
+func (i *Identifier) handleDevice(rw http.ResponseWriter, req *http.Request) {
+	addCommonResponseHeaders(rw.Header())
+	addNoCacheResponseHeaders(rw.Header())
+
+	err := req.ParseForm()
+	if err != nil {
+		i.logger.WithError(err).Debugln("identifier failed to decode device request")
+		i.ErrorPage(rw, http.StatusBadRequest, "", "failed to decode request")
+		return
+	}
+
+	if userCode := req.Form.Get("user_code"); userCode != "" {
+		// Continue device verification at the authorization endpoint, which
+		// uses the sign-in and consent flow as required.
+		uri, _ := url.Parse(i.authorizationEndpointURI.String())
+		uri.RawQuery = url.Values{"user_code": []string{userCode}}.Encode()
+		utils.WriteRedirect(rw, http.StatusFound, uri, nil, false)
+		return
+	}
+
+	// Show default, which lets the user enter the user code.
+	i.writeWebappIndexHTML(rw, req)
+}
+
 func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 	decoder := json.NewDecoder(req.Body)
 	var r LogonRequest
@@ -270,8 +295,10 @@ func (i *Identifier) handleLogon(rw http.ResponseWriter, req *http.Request) {
 		i.logger.WithError(err).Debugln("identifier failed to update user data in logon request")
 	}
 
-	// Set logon time.
+	// Set logon time and context.
 	user.logonAt = time.Now()
+	user.acr = konnectoidc.ACRPassword
+	user.amr = []string{konnectoidc.AMRPassword}
 
 	if r.Hello != nil {
 		hello, errHello := i.writeHelloResponse(rw, req, r.Hello, user)
@@ -321,7 +348,7 @@ func (i *Identifier) handleLogoff(rw http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		i.logger.WithError(err).Warnln("identifier logoff failed to get logon from ticket")
 	}
-	err = i.UnsetLogonCookie(ctx, u, rw)
+	err = i.UnsetLogonCookie(ctx, u, rw, req)
 	if err != nil {
 		i.logger.WithError(err).Errorln("identifier failed to set logoff ticket")
 		i.ErrorPage(rw, http.StatusInternalServerError, "", "failed to set logoff ticket")
@@ -88,7 +88,7 @@ type Identifier struct {
 	defaultBannerLogo *string
 
 	onSetLogonCallbacks   []func(ctx context.Context, rw http.ResponseWriter, user identity.User) error
-	onUnsetLogonCallbacks []func(ctx context.Context, rw http.ResponseWriter) error
+	onUnsetLogonCallbacks []func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error
 
 	logger logrus.FieldLogger
 
@@ -138,7 +138,7 @@ func NewIdentifier(c *Config) (*Identifier, error) {
 		backend: c.Backend,
 
 		onSetLogonCallbacks:   make([]func(ctx context.Context, rw http.ResponseWriter, user identity.User) error, 0),
-		onUnsetLogonCallbacks: make([]func(ctx context.Context, rw http.ResponseWriter) error, 0),
+		onUnsetLogonCallbacks: make([]func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error, 0),
 
 		logger: c.Config.Logger,
 	}
@@ -190,6 +190,7 @@ func (i *Identifier) AddRoutes(ctx context.Context, router *mux.Router) {
 	r.Handle("/consent", i).Methods(http.MethodGet).Name("consent")
 	r.Handle("/welcome", i).Methods(http.MethodGet).Name("welcome")
 	r.Handle("/goodbye", i).Methods(http.MethodGet).Name("goodbye")
+	r.Handle("/device", http.HandlerFunc(i.handleDevice)).Methods(http.MethodGet).Name("device")
 	r.Handle("/index.html", i).Methods(http.MethodGet) // For service worker.
 	r.Handle("/identifier/_/logon", i.secureHandler(http.HandlerFunc(i.handleLogon))).Methods(http.MethodPost)
 	r.Handle("/identifier/_/logoff", i.secureHandler(http.HandlerFunc(i.handleLogoff))).Methods(http.MethodPost)
@@ -301,6 +302,10 @@ func (i *Identifier) SetUserToLogonCookie(ctx context.Context, rw http.ResponseW
 	if lockedScopes := user.LockedScopes(); lockedScopes != nil {
 		userClaims[LockedScopesClaim] = strings.Join(lockedScopes, " ")
 	}
+	if acr, amr := user.AuthContext(); acr != "" {
+		userClaims[AuthContextClassClaim] = acr
+		userClaims[AuthMethodsClaim] = strings.Join(amr, " ")
+	}
 
 	// Serialize and encrypt cookie value.
 	serialized, err := jwt.Encrypted(i.encrypter).Claims(claims).Claims(userClaims).CompactSerialize()
@@ -326,7 +331,7 @@ func (i *Identifier) SetUserToLogonCookie(ctx context.Context, rw http.ResponseW
 
 // UnsetLogonCookie adds cookie remove headers to the provided http.ResponseWriter
 // effectively implementing logout.
-func (i *Identifier) UnsetLogonCookie(ctx context.Context, user *IdentifiedUser, rw http.ResponseWriter) error {
+func (i *Identifier) UnsetLogonCookie(ctx context.Context, user *IdentifiedUser, rw http.ResponseWriter, req *http.Request) error {
 	// Remove cookie.
 	err := i.removeLogonCookie(rw)
 	if err != nil {
@@ -343,7 +348,7 @@ func (i *Identifier) UnsetLogonCookie(ctx context.Context, user *IdentifiedUser,
 	}
 	// Trigger callbacks.
 	for _, f := range i.onUnsetLogonCallbacks {
-		err = f(ctx, rw)
+		err = f(ctx, rw, req)
 		if err != nil {
 			return err
 		}
@@ -355,8 +360,8 @@ func (i *Identifier) UnsetLogonCookie(ctx context.Context, user *IdentifiedUser,
 // EndSession begins the process to end the session either directly or indirectly
 // based on the provided user. It optionally returns an uri which shall be used
 // as redirection target or an error.
-func (i *Identifier) EndSession(ctx context.Context, user *IdentifiedUser, rw http.ResponseWriter, postRedirectURI *url.URL, state string) (*url.URL, error) {
-	err := i.UnsetLogonCookie(ctx, user, rw)
+func (i *Identifier) EndSession(ctx context.Context, user *IdentifiedUser, rw http.ResponseWriter, req *http.Request, postRedirectURI *url.URL, state string) (*url.URL, error) {
+	err := i.UnsetLogonCookie(ctx, user, rw, req)
 	if err != nil {
 		return nil, err
 	}
@@ -539,6 +544,12 @@ func (i *Identifier) GetUserFromLogonCookie(ctx context.Context, req *http.Reque
 			user.lockedScopes = strings.Split(lockedScopes, " ")
 		}
 	}
+	if v, ok := userClaims[AuthContextClassClaim].(string); ok {
+		user.acr = v
+	}
+	if v, ok := userClaims[AuthMethodsClaim].(string); ok && v != "" {
+		user.amr = strings.Split(v, " ")
+	}
 
 	// Fill additional claim.
 	user.claims = make(map[string]interface{})
@@ -561,6 +572,9 @@ func (i *Identifier) GetUserFromLogonCookie(ctx context.Context, req *http.Reque
 		case LockedScopesClaim:
 			// Already handled above.
 			continue
+		case AuthContextClassClaim, AuthMethodsClaim:
+			// Already handled above.
+			continue
 		case ObsoleteUserClaimsClaim:
 			// Keep and ignore for history reasons.
 			continue
@@ -753,7 +767,7 @@ func (i *Identifier) OnSetLogon(cb func(ctx context.Context, rw http.ResponseWri
 
 // OnUnsetLogon implements a way to register hooks whenever logon information is
 // set by the accociated Identifier.
-func (i *Identifier) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter) error) error {
+func (i *Identifier) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error) error {
 	i.onUnsetLogonCallbacks = append(i.onUnsetLogonCallbacks, cb)
 	return nil
 }
@@ -25,4 +25,6 @@ import (
 // clients.
 type Meta struct {
 	Scopes *scopes.Scopes `json:"scopes"`
+
+	AuthorizationDetailsTypes map[string]string `json:"authorization_details_types,omitempty"`
 }
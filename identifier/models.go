@@ -27,6 +27,7 @@ import (
 
 	"github.com/libregraph/lico/identifier/meta"
 	"github.com/libregraph/lico/identity/clients"
+	"github.com/libregraph/lico/oidc/payload"
 )
 
 // A LogonRequest is the request data as sent to the logon endpoint
@@ -56,12 +57,16 @@ type HelloRequest struct {
 	RawIDTokenHint string `json:"id_token_hint"`
 	RawMaxAge      string `json:"max_age"`
 
+	RawAuthorizationDetails string `json:"authorization_details"`
+
 	Scopes      map[string]bool `json:"-"`
 	Prompts     map[string]bool `json:"-"`
 	RedirectURI *url.URL        `json:"-"`
 	IDTokenHint *jwt.Token      `json:"-"`
 	MaxAge      time.Duration   `json:"-"`
 
+	AuthorizationDetails payload.AuthorizationDetails `json:"-"`
+
 	//TODO(longsleep): Add support to pass request parameters as JWT as
 	// specified in http://openid.net/specs/openid-connect-core-1_0.html#JWTRequests
 }
@@ -89,6 +94,13 @@ func (hr *HelloRequest) parse() error {
 		}
 		hr.MaxAge = time.Duration(maxAgeInt) * time.Second
 	}
+	if hr.RawAuthorizationDetails != "" {
+		authorizationDetails, err := payload.ParseAuthorizationDetails(hr.RawAuthorizationDetails)
+		if err != nil {
+			return err
+		}
+		hr.AuthorizationDetails = authorizationDetails
+	}
 
 	return nil
 }
@@ -107,6 +119,8 @@ type HelloResponse struct {
 	ClientDetails *clients.Details `json:"client,omitempty"`
 	Meta          *meta.Meta       `json:"meta,omitempty"`
 	Branding      *meta.Branding   `json:"branding,omitempty"`
+
+	AuthorizationDetails payload.AuthorizationDetails `json:"authorization_details,omitempty"`
 }
 
 // A StateRequest is a general request with a state.
@@ -345,8 +345,10 @@ func (i *Identifier) writeOAuth2Cb(rw http.ResponseWriter, req *http.Request) {
 			i.logger.WithError(err).Debugln("identifier failed to update user data in oauth2 cb request")
 		}
 
-		// Set logon time.
+		// Set logon time and context.
 		user.logonAt = time.Now()
+		user.acr = konnectoidc.ACRFederated
+		user.amr = []string{konnectoidc.AMRFederated}
 
 		err = i.SetUserToLogonCookie(req.Context(), rw, user)
 		if err != nil {
@@ -192,8 +192,10 @@ func (i *Identifier) writeSAML2AssertionConsumerService(rw http.ResponseWriter,
 			break
 		}
 
-		// Set logon time.
+		// Set logon time and context.
 		user.logonAt = time.Now()
+		user.acr = konnectoidc.ACRFederated
+		user.amr = []string{konnectoidc.AMRFederated}
 
 		err = i.SetUserToLogonCookie(req.Context(), rw, user)
 		if err != nil {
@@ -340,7 +342,7 @@ func (i *Identifier) writeSAMLSingleLogoutServiceRequest(rw http.ResponseWriter,
 
 		if authorityDetails != nil && authorityDetails.Trusted {
 			// Directly clear identifier session when a trusted authority requests it.
-			err = i.UnsetLogonCookie(req.Context(), user, rw)
+			err = i.UnsetLogonCookie(req.Context(), user, rw, req)
 			if err != nil {
 				i.logger.WithError(err).Errorln("identifier saml2 slo failed to unset logon cookie")
 				i.ErrorPage(rw, http.StatusInternalServerError, "", "saml2 slo logout failed")
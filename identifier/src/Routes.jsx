@@ -11,6 +11,8 @@ const AsyncWelcome = lazy(() =>
   import(/* webpackChunkName: "containers-welcome" */ './containers/Welcome'));
 const AsyncGoodbye = lazy(() =>
   import(/* webpackChunkName: "containers-goodbye" */ './containers/Goodbye'));
+const AsyncDevice = lazy(() =>
+  import(/* webpackChunkName: "containers-device" */ './containers/Device'));
 
 const Routes = ({ hello }) => (
   <Switch>
@@ -25,6 +27,11 @@ const Routes = ({ hello }) => (
       exact
       component={AsyncGoodbye}
     />
+    <Route
+      path="/device"
+      exact
+      component={AsyncDevice}
+    />
     <Route
       path="/"
       component={AsyncLogin}
@@ -267,6 +267,8 @@ export function advanceLogonFlow(success, history, done=false, extraQuery={}) {
         }
         if (hello.details.continue_uri) {
           q.prompt = 'none';
+          // Mark the return, the user is signed in from here on.
+          q.identifier = 'must';
           window.location.replace(hello.details.continue_uri + '?' + queryString.stringify(q));
           return;
         }
@@ -0,0 +1,73 @@
+import React from 'react';
+import List from '@material-ui/core/List';
+import ListItem from '@material-ui/core/ListItem';
+import ListItemText from '@material-ui/core/ListItemText';
+import { withStyles } from '@material-ui/core/styles';
+import PropTypes from 'prop-types';
+import Checkbox from '@material-ui/core/Checkbox';
+
+import { useTranslation } from 'react-i18next';
+
+const styles = () => ({
+  row: {
+    paddingTop: 0,
+    paddingBottom: 0
+  },
+  details: {
+    whiteSpace: 'pre-line'
+  }
+});
+
+const formatValue = (value) => {
+  if (Array.isArray(value)) {
+    return value.map(formatValue).join(', ');
+  }
+  if (value !== null && typeof value === 'object') {
+    return Object.keys(value).map(key => `${key}: ${formatValue(value[key])}`).join(', ');
+  }
+  return String(value);
+};
+
+const AuthorizationDetailsList = ({authorizationDetails, types, classes, ...rest}) => {
+  const { t } = useTranslation();
+
+  const rows = authorizationDetails.map((detail, idx) => {
+    const { type, ...fields } = detail;
+
+    let label = types[type];
+    if (!label) {
+      label = t("konnect.authorizationDetails.type", "Permission: {{type}}", { type });
+    }
+    const details = Object.keys(fields).map(field => `${field}: ${formatValue(fields[field])}`).join('\n');
+
+    return (
+      <ListItem
+        disableGutters
+        dense
+        key={idx}
+        className={classes.row}
+      ><Checkbox
+          checked
+          disableRipple
+          disabled
+        />
+        <ListItemText primary={label} secondary={details} secondaryTypographyProps={{className: classes.details}} />
+      </ListItem>
+    );
+  });
+
+  return (
+    <List {...rest}>
+      {rows}
+    </List>
+  );
+};
+
+AuthorizationDetailsList.propTypes = {
+  classes: PropTypes.object.isRequired,
+
+  authorizationDetails: PropTypes.array.isRequired,
+  types: PropTypes.object.isRequired
+};
+
+export default withStyles(styles)(AuthorizationDetailsList);
@@ -0,0 +1,125 @@
+import React from 'react';
+import PropTypes from 'prop-types';
+import { connect } from 'react-redux';
+
+import { withTranslation } from 'react-i18next';
+
+import renderIf from 'render-if';
+
+import { withStyles } from '@material-ui/core/styles';
+import Button from '@material-ui/core/Button';
+import TextField from '@material-ui/core/TextField';
+import Typography from '@material-ui/core/Typography';
+import DialogActions from '@material-ui/core/DialogActions';
+
+import ResponsiveScreen from '../../components/ResponsiveScreen';
+import { executeHello } from '../../actions/common';
+
+const styles = theme => ({
+  button: {
+    margin: theme.spacing(1),
+    minWidth: 100
+  },
+  subHeader: {
+    marginBottom: theme.spacing(5)
+  },
+  userCodeInputField: {
+    marginTop: theme.spacing(1),
+    marginBottom: theme.spacing(1.5),
+  }
+});
+
+class Devicescreen extends React.PureComponent {
+  componentDidMount() {
+    this.props.dispatch(executeHello());
+  }
+
+  render() {
+    const { classes, branding, hello, query, t } = this.props;
+
+    const loading = hello === null;
+    const result = query.result;
+    return (
+      <ResponsiveScreen loading={loading} branding={branding}>
+        {renderIf(result === 'approved')(() => (
+          <div>
+            <Typography variant="h5" component="h3">
+              {t("konnect.device.approved.headline", "Device connected")}
+            </Typography>
+            <Typography gutterBottom>
+              {t("konnect.device.message.close", "You can close this window now and return to your device.")}
+            </Typography>
+          </div>
+        ))}
+        {renderIf(result === 'denied')(() => (
+          <div>
+            <Typography variant="h5" component="h3">
+              {t("konnect.device.denied.headline", "Device not connected")}
+            </Typography>
+            <Typography gutterBottom>
+              {t("konnect.device.message.close", "You can close this window now and return to your device.")}
+            </Typography>
+          </div>
+        ))}
+        {renderIf(result !== 'approved' && result !== 'denied')(() => (
+          <form method="get">
+            <Typography variant="h5" component="h3">
+              {t("konnect.device.headline", "Connect a device")}
+            </Typography>
+            <Typography variant="subtitle1" className={classes.subHeader}>
+              {t("konnect.device.subHeader", "Enter the code displayed on your device")}
+            </Typography>
+            <TextField
+              name="user_code"
+              label={t("konnect.device.userCodeField.label", "Code")}
+              error={result === 'invalid'}
+              helperText={result === 'invalid' ? t("konnect.device.userCodeField.invalid", "The code is invalid or has expired.") : undefined}
+              fullWidth
+              autoFocus
+              inputProps={{
+                autoCapitalize: 'characters',
+                autoComplete: 'off',
+                spellCheck: 'false'
+              }}
+              variant="outlined"
+              className={classes.userCodeInputField}
+            />
+            <DialogActions>
+              <Button
+                type="submit"
+                color="primary"
+                variant="contained"
+                className={classes.button}
+              >
+                {t("konnect.device.continueButton.label", "Continue")}
+              </Button>
+            </DialogActions>
+          </form>
+        ))}
+      </ResponsiveScreen>
+    );
+  }
+}
+
+Devicescreen.propTypes = {
+  classes: PropTypes.object.isRequired,
+  t: PropTypes.func.isRequired,
+
+  branding: PropTypes.object,
+  hello: PropTypes.object,
+  query: PropTypes.object.isRequired,
+
+  dispatch: PropTypes.func.isRequired
+};
+
+const mapStateToProps = (state) => {
+  const { branding, hello, query } = state.common;
+
+  return {
+    branding,
+    hello,
+    query
+  };
+};
+
+export default connect(mapStateToProps)(withStyles(styles)(withTranslation()(Devicescreen)));
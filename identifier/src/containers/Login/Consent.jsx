@@ -20,6 +20,7 @@ import { ErrorMessage } from '../../errors';
 import { REQUEST_CONSENT_ALLOW } from '../../actions/types';
 import ClientDisplayName from '../../components/ClientDisplayName';
 import ScopesList from '../../components/ScopesList';
+import AuthorizationDetailsList from '../../components/AuthorizationDetailsList';
 
 const styles = theme => ({
   button: {
@@ -96,6 +97,7 @@ class Consent extends React.PureComponent {
 
     const scopes = hello.details.scopes || {};
     const meta = hello.details.meta || {};
+    const authorizationDetails = hello.details.authorization_details || [];
 
     return (
       <DialogContent>
@@ -117,6 +119,15 @@ class Consent extends React.PureComponent {
           </Trans>
         </Typography>
         <ScopesList dense disablePadding className={classes.scopesList} scopes={scopes} meta={meta.scopes}></ScopesList>
+        {renderIf(authorizationDetails.length > 0)(() => (
+          <AuthorizationDetailsList
+            dense
+            disablePadding
+            className={classes.scopesList}
+            authorizationDetails={authorizationDetails}
+            types={meta.authorization_details_types || {}}
+          ></AuthorizationDetailsList>
+        ))}
 
         <Typography variant="subtitle1" gutterBottom>
           <Trans t={t} i18nKey="konnect.consent.question">
@@ -20,6 +20,9 @@ export function newHelloRequest(flow, query) {
       if (query.max_age) {
         r.max_age = query.max_age;  // eslint-disable-line camelcase
       }
+      if (query.authorization_details) {
+        r.authorization_details = query.authorization_details;  // eslint-disable-line camelcase
+      }
       if (query.claims_scope) {
         // Add additional scopes from claims request if given.
         r.scope += ' ' + query.claims_scope;
@@ -55,6 +55,9 @@ type IdentifiedUser struct {
 	logonAt      time.Time
 	expiresAfter *time.Time
 
+	acr string
+	amr []string
+
 	lockedScopes []string
 }
 
@@ -146,6 +149,12 @@ func (u *IdentifiedUser) LoggedOn() (bool, time.Time) {
 	return !u.logonAt.IsZero(), u.logonAt
 }
 
+// AuthContext returns the authentication context class reference and the
+// authentication methods references of the accociated user's logon.
+func (u *IdentifiedUser) AuthContext() (string, []string) {
+	return u.acr, u.amr
+}
+
 // SessionRef returns the accociated users underlaying session reference.
 func (u *IdentifiedUser) SessionRef() *string {
 	return u.sessionRef
@@ -40,4 +40,7 @@ type AuthRecord interface {
 
 	LoggedOn() (bool, time.Time)
 	SetAuthTime(time.Time)
+
+	AuthContext() (string, []string)
+	SetAuthContext(acr string, amr []string)
 }
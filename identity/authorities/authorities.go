@@ -23,7 +23,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/go-jose/go-jose/v3"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/libregraph/oidc-go"
 )
@@ -134,6 +136,49 @@ func (d *Details) validateJWT(token *jwt.Token) (interface{}, error) {
 	return nil, errors.New("no key available")
 }
 
+// ConsumeJTI records the provided JWT ID as used until the provided expiration
+// time. It returns an error if the JWT ID was used before or if the associated
+// authority does not support tracking of JWT IDs.
+func (d *Details) ConsumeJTI(jti string, expiresAt time.Time) error {
+	consumer, ok := d.registration.(jtiConsumer)
+	if !ok {
+		return errors.New("jti tracking not supported")
+	}
+
+	return consumer.ConsumeJTI(jti, expiresAt)
+}
+
 func (d *Details) Metadata() interface{} {
 	return d.registration.Metadata()
 }
+
+type jtiConsumer interface {
+	ConsumeJTI(jti string, expiresAt time.Time) error
+}
+
+func validationKeysFromJWKS(jwks *jose.JSONWebKeySet, skipInvalid bool) (map[string]crypto.PublicKey, error) {
+	if jwks == nil || len(jwks.Keys) == 0 {
+		return nil, nil
+	}
+
+	validationKeys := make(map[string]crypto.PublicKey)
+	skipped := 0
+	for _, jwk := range jwks.Keys {
+		if jwk.Use == "sig" {
+			if key, ok := jwk.Key.(crypto.PublicKey); ok {
+				validationKeys[jwk.KeyID] = key
+			} else {
+				if !skipInvalid {
+					return nil, fmt.Errorf("failed to decode public key")
+				} else {
+					skipped++
+				}
+			}
+		}
+	}
+	if skipped > 0 {
+		return validationKeys, fmt.Errorf("failed to decode %d keys in set", skipped)
+	}
+
+	return validationKeys, nil
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package authorities
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
+	"github.com/orcaman/concurrent-map"
+	"github.com/sirupsen/logrus"
+
+	"github.com/libregraph/lico/utils"
+)
+
+// Authority default values.
+var (
+	jwtBearerAuthorityDefaultIdentityClaimName = oidc.SubjectIdentifierClaim
+)
+
+// jwtBearerAuthorityMaxUsedJTIs limits the number of tracked assertion IDs per
+// authority, assertions are rejected when the limit is reached.
+const jwtBearerAuthorityMaxUsedJTIs = 10000
+
+// jwtBearerAuthorityRegistration defines a trusted issuer of JWT assertions
+// which can be used with the JWT bearer authorization grant as specified at
+// https://tools.ietf.org/html/rfc7523. Such authorities cannot be used for
+// interactive sign-in.
+type jwtBearerAuthorityRegistration struct {
+	registry *Registry
+	data     *authorityRegistrationData
+
+	discover bool
+
+	validationKeys map[string]crypto.PublicKey
+
+	mutex sync.RWMutex
+	ready bool
+
+	usedJTIs cmap.ConcurrentMap
+}
+
+func newJWTBearerAuthorityRegistration(registry *Registry, registrationData *authorityRegistrationData) (*jwtBearerAuthorityRegistration, error) {
+	ar := &jwtBearerAuthorityRegistration{
+		registry: registry,
+		data:     registrationData,
+
+		usedJTIs: cmap.New(),
+	}
+
+	if ar.data.Iss == "" {
+		return nil, errors.New("jwt-bearer authority iss is empty")
+	}
+	if ar.data.JWKS != nil {
+		if err := ar.setValidationKeysFromJWKS(ar.data.JWKS, false); err != nil {
+			return nil, err
+		}
+	}
+	if ar.data.Discover != nil {
+		ar.discover = *ar.data.Discover
+	} else {
+		ar.discover = ar.data.JWKS == nil
+	}
+
+	if !ar.discover {
+		if ar.data.JWKS == nil {
+			return nil, errors.New("jwks is empty")
+		}
+		// Static keys are ready right away.
+		ar.ready = ar.validationKeys != nil
+	}
+
+	return ar, nil
+}
+
+func (ar *jwtBearerAuthorityRegistration) ID() string {
+	return ar.data.ID
+}
+
+func (ar *jwtBearerAuthorityRegistration) Name() string {
+	return ar.data.Name
+}
+
+func (ar *jwtBearerAuthorityRegistration) AuthorityType() string {
+	return ar.data.AuthorityType
+}
+
+func (ar *jwtBearerAuthorityRegistration) Authority() *Details {
+	details := &Details{
+		ID:            ar.data.ID,
+		Name:          ar.data.Name,
+		AuthorityType: ar.data.AuthorityType,
+
+		ClientID: ar.data.ClientID,
+
+		Trusted:  ar.data.Trusted,
+		Insecure: ar.data.Insecure,
+
+		Scopes: ar.data.Scopes,
+
+		registration: ar,
+	}
+
+	ar.mutex.RLock()
+	details.ready = ar.ready
+	if ar.ready {
+		details.validationKeys = ar.validationKeys
+	}
+	ar.mutex.RUnlock()
+
+	return details
+}
+
+func (ar *jwtBearerAuthorityRegistration) Issuer() string {
+	return ar.data.Iss
+}
+
+func (ar *jwtBearerAuthorityRegistration) setValidationKeysFromJWKS(jwks *jose.JSONWebKeySet, skipInvalid bool) error {
+	var err error
+	ar.validationKeys, err = validationKeysFromJWKS(jwks, skipInvalid)
+	return err
+}
+
+func (ar *jwtBearerAuthorityRegistration) Validate() error {
+	// Ensure some defaults.
+	if ar.data.IdentityClaimName == "" {
+		ar.data.IdentityClaimName = jwtBearerAuthorityDefaultIdentityClaimName
+	}
+
+	return nil
+}
+
+func (ar *jwtBearerAuthorityRegistration) Initialize(ctx context.Context, registry *Registry) error {
+	ar.mutex.Lock()
+	defer ar.mutex.Unlock()
+
+	// Cleanup function for seen assertion IDs.
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ar.purgeExpiredJTIs()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if !ar.discover {
+		return nil
+	}
+
+	return initializeJWTBearer(ctx, registry.logger, ar)
+}
+
+func (ar *jwtBearerAuthorityRegistration) IdentityClaimValue(rawToken interface{}) (string, map[string]interface{}, error) {
+	token, _ := rawToken.(*jwt.Token)
+	if token == nil {
+		return "", nil, errors.New("invalid assertion data")
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if claims == nil {
+		return "", nil, errors.New("invalid claims data")
+	}
+
+	cvr, ok := claims[ar.data.IdentityClaimName]
+	if !ok {
+		return "", nil, errors.New("identity claim not found")
+	}
+	cvs, ok := cvr.(string)
+	if !ok || cvs == "" {
+		return "", nil, errors.New("identify claim has invalid type")
+	}
+
+	// Convert claim value.
+	whitelisted := false
+	if ar.data.IdentityAliases != nil {
+		if alias, ok := ar.data.IdentityAliases[cvs]; ok && alias != "" {
+			cvs = alias
+			whitelisted = true
+		}
+	}
+
+	// Check whitelist.
+	if ar.data.IdentityAliasRequired && !whitelisted {
+		return "", nil, errors.New("identity claim has no alias")
+	}
+
+	return cvs, nil, nil
+}
+
+// ConsumeJTI implements the jtiConsumer interface, to reject replay of
+// assertions as specified at https://tools.ietf.org/html/rfc7523#section-3.
+func (ar *jwtBearerAuthorityRegistration) ConsumeJTI(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("missing jti")
+	}
+	if ar.usedJTIs.Count() >= jwtBearerAuthorityMaxUsedJTIs {
+		ar.purgeExpiredJTIs()
+		if ar.usedJTIs.Count() >= jwtBearerAuthorityMaxUsedJTIs {
+			return errors.New("too many assertions in use")
+		}
+	}
+	if !ar.usedJTIs.SetIfAbsent(jti, expiresAt) {
+		return errors.New("jti has been used before")
+	}
+
+	return nil
+}
+
+func (ar *jwtBearerAuthorityRegistration) purgeExpiredJTIs() {
+	var expired []string
+	now := time.Now()
+	for entry := range ar.usedJTIs.IterBuffered() {
+		if entry.Val.(time.Time).Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, jti := range expired {
+		ar.usedJTIs.Remove(jti)
+	}
+}
+
+func (ar *jwtBearerAuthorityRegistration) MakeRedirectAuthenticationRequestURL(state string) (*url.URL, map[string]interface{}, error) {
+	return nil, nil, fmt.Errorf("not supported for jwt-bearer authority")
+}
+
+func (ar *jwtBearerAuthorityRegistration) MakeRedirectEndSessionRequestURL(ref interface{}, state string) (*url.URL, map[string]interface{}, error) {
+	return nil, nil, fmt.Errorf("not supported for jwt-bearer authority")
+}
+
+func (ar *jwtBearerAuthorityRegistration) MakeRedirectEndSessionResponseURL(req interface{}, state string) (*url.URL, map[string]interface{}, error) {
+	return nil, nil, fmt.Errorf("not supported for jwt-bearer authority")
+}
+
+func (ar *jwtBearerAuthorityRegistration) ParseStateResponse(req *http.Request, state string, extra map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("not supported for jwt-bearer authority")
+}
+
+func (ar *jwtBearerAuthorityRegistration) ValidateIdpEndSessionRequest(req interface{}, state string) (bool, error) {
+	return false, fmt.Errorf("not supported for jwt-bearer authority")
+}
+
+func (ar *jwtBearerAuthorityRegistration) ValidateIdpEndSessionResponse(res interface{}, state string) (bool, error) {
+	return false, fmt.Errorf("not supported for jwt-bearer authority")
+}
+
+func (ar *jwtBearerAuthorityRegistration) Metadata() AuthorityMetadata {
+	return nil
+}
+
+func initializeJWTBearer(ctx context.Context, logger logrus.FieldLogger, ar *jwtBearerAuthorityRegistration) error {
+	providerLogger := logger.WithFields(logrus.Fields{
+		"id":   ar.data.ID,
+		"type": AuthorityTypeJWTBearer,
+	})
+	config := &oidc.ProviderConfig{
+		Logger:     &oidcProviderLogger{providerLogger},
+		HTTPHeader: http.Header{},
+	}
+	if ar.data.Insecure {
+		config.HTTPClient = utils.InsecureHTTPClient
+	} else {
+		config.HTTPClient = utils.DefaultHTTPClient
+	}
+	config.HTTPHeader.Set("User-Agent", utils.DefaultHTTPUserAgent)
+
+	issuer, err := url.Parse(ar.data.Iss)
+	if err != nil {
+		return fmt.Errorf("failed to parse issuer: %v", err)
+	}
+	if issuer.Scheme != "https" {
+		return fmt.Errorf("issuer scheme is not https")
+	}
+	if issuer.Host == "" {
+		return fmt.Errorf("issuer host is empty")
+	}
+	provider, err := oidc.NewProvider(issuer, config)
+	if err != nil {
+		return fmt.Errorf("failed to create oidc provider: %v", err)
+	}
+	updateCh := make(chan *oidc.ProviderDefinition)
+	errorCh := make(chan error)
+	err = provider.Initialize(ctx, updateCh, errorCh)
+	if err != nil {
+		return fmt.Errorf("failed to initialize oidc provider: %v", err)
+	}
+	go func() {
+		// Handle updates and errors of authority keys. Only the keys are of
+		// interest for the validation of assertions.
+		var pd *oidc.ProviderDefinition
+		for {
+			pd = nil
+
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updateCh:
+				pd = update
+			case chErr := <-errorCh:
+				providerLogger.Errorf("error while oidc provider update: %v", chErr)
+			}
+
+			if pd != nil && pd.JWKS != nil {
+				ar.mutex.Lock()
+
+				if err := ar.setValidationKeysFromJWKS(pd.JWKS, true); err != nil {
+					providerLogger.Errorf("failed to set authority keys from oidc provider jwks: %v", err)
+				}
+
+				ready := ar.ready
+				ar.ready = ar.validationKeys != nil
+				if ready != ar.ready {
+					if ar.ready {
+						providerLogger.Infoln("authority is now ready")
+					} else {
+						providerLogger.Warnln("authority is no longer ready")
+					}
+				}
+
+				ar.mutex.Unlock()
+			}
+		}
+	}()
+
+	return nil
+}
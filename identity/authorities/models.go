@@ -27,8 +27,9 @@ import (
 
 // Supported Authority kind string values.
 const (
-	AuthorityTypeOIDC  = "oidc"
-	AuthorityTypeSAML2 = "saml2"
+	AuthorityTypeOIDC      = "oidc"
+	AuthorityTypeSAML2     = "saml2"
+	AuthorityTypeJWTBearer = "jwt-bearer"
 )
 
 type authorityRegistrationData struct {
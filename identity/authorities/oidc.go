@@ -198,31 +198,9 @@ func (ar *oidcAuthorityRegistration) Issuer() string {
 }
 
 func (ar *oidcAuthorityRegistration) setValidationKeysFromJWKS(jwks *jose.JSONWebKeySet, skipInvalid bool) error {
-	if jwks == nil || len(jwks.Keys) == 0 {
-		ar.validationKeys = nil
-		return nil
-	}
-
-	ar.validationKeys = make(map[string]crypto.PublicKey)
-	skipped := 0
-	for _, jwk := range jwks.Keys {
-		if jwk.Use == "sig" {
-			if key, ok := jwk.Key.(crypto.PublicKey); ok {
-				ar.validationKeys[jwk.KeyID] = key
-			} else {
-				if !skipInvalid {
-					return fmt.Errorf("failed to decode public key")
-				} else {
-					skipped++
-				}
-			}
-		}
-	}
-	if skipped > 0 {
-		return fmt.Errorf("failed to decode %d keys in set", skipped)
-	}
-
-	return nil
+	var err error
+	ar.validationKeys, err = validationKeysFromJWKS(jwks, skipInvalid)
+	return err
 }
 
 func (ar *oidcAuthorityRegistration) Validate() error {
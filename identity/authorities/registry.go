@@ -91,6 +91,8 @@ func NewRegistry(ctx context.Context, baseURI *url.URL, registrationConfFilepath
 			authority, validateErr = newOIDCAuthorityRegistration(r, registrationData)
 		case AuthorityTypeSAML2:
 			authority, validateErr = newSAML2AuthorityRegistration(r, registrationData)
+		case AuthorityTypeJWTBearer:
+			authority, validateErr = newJWTBearerAuthorityRegistration(r, registrationData)
 		}
 
 		fields := logrus.Fields{
@@ -117,14 +119,17 @@ func NewRegistry(ctx context.Context, baseURI *url.URL, registrationConfFilepath
 			continue
 		}
 
-		if registrationData.Default || defaultAuthorityRegistrationData == nil {
+		switch {
+		case registrationData.AuthorityType == AuthorityTypeJWTBearer:
+			// Assertion issuers are never used for sign-in.
+		case registrationData.Default || defaultAuthorityRegistrationData == nil:
 			if defaultAuthorityRegistrationData == nil || !defaultAuthorityRegistrationData.Default {
 				defaultAuthorityRegistrationData = registrationData
 				defaultAuthority = authority
 			} else {
 				logger.Warnln("ignored default authority flag since already have a default")
 			}
-		} else {
+		default:
 			// TODO(longsleep): Implement authority selection.
 			logger.Warnln("non-default additional authorities are not supported yet")
 		}
@@ -167,6 +172,8 @@ func (r *Registry) Register(authority AuthorityRegistration) error {
 		// breaks
 	case AuthorityTypeSAML2:
 		// breaks
+	case AuthorityTypeJWTBearer:
+		// breaks
 	default:
 		return fmt.Errorf("unknown authority type: %v", authority.AuthorityType())
 	}
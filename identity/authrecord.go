@@ -35,6 +35,8 @@ type authRecord struct {
 
 	user     PublicUser
 	authTime time.Time
+	acr      string
+	amr      []string
 }
 
 // NewAuthRecord returns a implementation of identity.AuthRecord holding
@@ -127,3 +129,16 @@ func (r *authRecord) LoggedOn() (bool, time.Time) {
 func (r *authRecord) SetAuthTime(authTime time.Time) {
 	r.authTime = authTime
 }
+
+// AuthContext implements the identity.AuthRecord interface, returning the
+// authentication context class reference and the authentication methods
+// references.
+func (r *authRecord) AuthContext() (string, []string) {
+	return r.acr, r.amr
+}
+
+// SetAuthContext implements the identity.AuthRecord interface.
+func (r *authRecord) SetAuthContext(acr string, amr []string) {
+	r.acr = acr
+	r.amr = amr
+}
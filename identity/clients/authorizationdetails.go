@@ -0,0 +1,117 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Common authorization details fields as specified at
+// https://datatracker.ietf.org/doc/html/rfc9396#section-2.2
+const (
+	AuthorizationDetailsTypeField       = "type"
+	AuthorizationDetailsLocationsField  = "locations"
+	AuthorizationDetailsActionsField    = "actions"
+	AuthorizationDetailsDatatypesField  = "datatypes"
+	AuthorizationDetailsIdentifierField = "identifier"
+	AuthorizationDetailsPrivilegesField = "privileges"
+)
+
+// AuthorizationDetailsTypeRegistration defines an accepted type of
+// authorization details as specified at
+// https://datatracker.ietf.org/doc/html/rfc9396#section-2 and the schema which
+// authorization details objects of that type must comply to. Fields lists the
+// type specific fields in addition to the common fields, Required lists the
+// fields which must be set.
+type AuthorizationDetailsTypeRegistration struct {
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+
+	Fields   []string `yaml:"fields,flow"`
+	Required []string `yaml:"required,flow"`
+}
+
+// Validate checks if the provided authorization details object complies to
+// the schema of the accociated type registration and returns error when it
+// does not.
+func (tr *AuthorizationDetailsTypeRegistration) Validate(detail map[string]interface{}) error {
+	if detailType, _ := detail[AuthorizationDetailsTypeField].(string); detailType != tr.Type {
+		return fmt.Errorf("type mismatch: %v", detail[AuthorizationDetailsTypeField])
+	}
+
+	for field, value := range detail {
+		switch field {
+		case AuthorizationDetailsTypeField:
+			// breaks
+		case AuthorizationDetailsIdentifierField:
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s must be a string", field)
+			}
+		case AuthorizationDetailsLocationsField, AuthorizationDetailsActionsField, AuthorizationDetailsDatatypesField, AuthorizationDetailsPrivilegesField:
+			values, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be an array of strings", field)
+			}
+			for _, v := range values {
+				if _, ok := v.(string); !ok {
+					return fmt.Errorf("%s must be an array of strings", field)
+				}
+			}
+		default:
+			if !containsString(tr.Fields, field) {
+				return fmt.Errorf("unknown field for type %s: %s", tr.Type, field)
+			}
+		}
+	}
+	for _, field := range tr.Required {
+		if _, ok := detail[field]; !ok {
+			return fmt.Errorf("missing field for type %s: %s", tr.Type, field)
+		}
+	}
+
+	return nil
+}
+
+func (tr *AuthorizationDetailsTypeRegistration) validateRegistration() error {
+	if tr.Type == "" {
+		return errors.New("invalid type")
+	}
+	for _, field := range tr.Required {
+		switch field {
+		case AuthorizationDetailsLocationsField, AuthorizationDetailsActionsField, AuthorizationDetailsDatatypesField, AuthorizationDetailsIdentifierField, AuthorizationDetailsPrivilegesField:
+			// breaks
+		default:
+			if !containsString(tr.Fields, field) {
+				return fmt.Errorf("required field %s is not a known field", field)
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
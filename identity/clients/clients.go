@@ -19,7 +19,11 @@ package clients
 
 import (
 	"crypto"
+	"errors"
 	"net/url"
+	"strings"
+
+	konnectoidc "github.com/libregraph/lico/oidc"
 )
 
 // Details hold detail information about clients identified by ID.
@@ -61,3 +65,32 @@ func IsLocalNativeHostURI(uri *url.URL) bool {
 	hostname := uri.Hostname()
 	return hostname == "localhost" || hostname == "127.0.0.1" || hostname == "::1"
 }
+
+// ValidateResourceURI returns error if the provided URI cannot be used as
+// resource indicator. As specified at
+// https://tools.ietf.org/html/rfc8707#section-2 resources must be absolute
+// URIs and must not include a fragment.
+func ValidateResourceURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsAbs() {
+		return errors.New("resource must be an absolute uri")
+	}
+	if strings.Contains(uri, "#") {
+		return errors.New("resource must not include a fragment")
+	}
+
+	return nil
+}
+
+// IsKnownAccessTokenFormat returns true if the provided access token format is
+// supported. Empty means the default format.
+func IsKnownAccessTokenFormat(format string) bool {
+	switch format {
+	case "", konnectoidc.AccessTokenFormatDefault, konnectoidc.AccessTokenFormatJWT:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/longsleep/rndm"
+)
+
+// RegisterDynamic records the provided dynamic client registration in the
+// accociated registry's store and returns a new registration access token
+// which allows the client to manage its registration as specified at
+// https://tools.ietf.org/html/rfc7592#section-3
+func (r *Registry) RegisterDynamic(ctx context.Context, client *ClientRegistration) (string, error) {
+	if r.Store == nil {
+		return "", errors.New("no store")
+	}
+	if !client.Dynamic || client.ID == "" {
+		return "", errors.New("not a dynamic client")
+	}
+
+	sub, err := client.secretSubject()
+	if err != nil {
+		return "", err
+	}
+
+	registrationAccessToken := rndm.GenerateRandomString(64)
+	record := &StoreRecord{
+		Claims:                      client.registrationClaims(sub),
+		RegistrationAccessTokenHash: hashRegistrationAccessToken(registrationAccessToken),
+		ExpiresAt:                   client.SecretExpiresAt,
+	}
+	if err = r.Store.Set(client.ID, record); err != nil {
+		return "", fmt.Errorf("failed to store dynamic client: %v", err)
+	}
+
+	return registrationAccessToken, nil
+}
+
+// GetDynamic returns the current registration of the dynamic client with the
+// provided client ID if the provided registration access token is valid for
+// it.
+func (r *Registry) GetDynamic(ctx context.Context, clientID string, registrationAccessToken string) (*ClientRegistration, bool) {
+	record, ok := r.getStoreRecord(clientID)
+	if !ok || record.Claims == nil || registrationAccessToken == "" {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashRegistrationAccessToken(registrationAccessToken)), []byte(record.RegistrationAccessTokenHash)) != 1 {
+		return nil, false
+	}
+
+	return r.getDynamicClient(clientID)
+}
+
+// UpdateDynamic replaces the registration of the dynamic client with the
+// provided client ID with the provided client registration. If the update
+// requires a new client secret, it is returned.
+func (r *Registry) UpdateDynamic(ctx context.Context, clientID string, client *ClientRegistration) (string, error) {
+	record, ok := r.getStoreRecord(clientID)
+	if !ok || record.Claims == nil {
+		return "", errors.New("unknown client")
+	}
+	current := record.Claims.ClientRegistration
+
+	client.ID = clientID
+	client.Dynamic = true
+	client.IDIssuedAt = current.IDIssuedAt
+	client.SecretExpiresAt = current.SecretExpiresAt
+
+	sub := record.Claims.Subject
+	var secret string
+	if client.Name != current.Name {
+		// The hashed client secret is bound to the client name, thus a new
+		// client secret is required whenever the name changes.
+		var err error
+		sub, secret, err = client.makeSecret(nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to make dynamic client secret: %v", err)
+		}
+	}
+
+	updated := &StoreRecord{
+		Claims:                      client.registrationClaims(sub),
+		RegistrationAccessTokenHash: record.RegistrationAccessTokenHash,
+		ExpiresAt:                   record.ExpiresAt,
+	}
+	if err := r.Store.Set(clientID, updated); err != nil {
+		return "", fmt.Errorf("failed to store dynamic client: %v", err)
+	}
+
+	return secret, nil
+}
+
+// DeleteDynamic deletes the dynamic client with the provided client ID. The
+// deletion is remembered until the stateless client ID expires.
+func (r *Registry) DeleteDynamic(ctx context.Context, clientID string) error {
+	record, ok := r.getStoreRecord(clientID)
+	if !ok || record.Claims == nil {
+		return errors.New("unknown client")
+	}
+
+	deleted := &StoreRecord{
+		ExpiresAt: record.ExpiresAt,
+	}
+	if err := r.Store.Set(clientID, deleted); err != nil {
+		return fmt.Errorf("failed to store dynamic client: %v", err)
+	}
+
+	return nil
+}
+
+func (r *Registry) getStoreRecord(clientID string) (*StoreRecord, bool) {
+	if r.Store == nil {
+		return nil, false
+	}
+
+	record, ok, err := r.Store.Get(clientID)
+	if err != nil {
+		r.logger.WithError(err).Errorln("failed to get dynamic client from store")
+		return nil, false
+	}
+
+	return record, ok
+}
+
+// registrationClaims returns the claims which hold the accociated dynamic
+// client registration, using the provided hashed secret as subject.
+func (cr *ClientRegistration) registrationClaims(sub string) *RegistrationClaims {
+	registration := *cr
+	registration.ID = ""
+	registration.Secret = ""
+
+	return &RegistrationClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   sub,
+			IssuedAt:  cr.IDIssuedAt,
+			ExpiresAt: cr.SecretExpiresAt,
+		},
+		ClientRegistration: &registration,
+	}
+}
+
+// secretSubject returns the hashed secret of the accociated dynamic client
+// registration, which must hold the client secret.
+func (cr *ClientRegistration) secretSubject() (string, error) {
+	secret, err := base64.RawURLEncoding.DecodeString(cr.Secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode client secret: %v", err)
+	}
+	sub, _, err := cr.makeSecret(secret)
+
+	return sub, err
+}
+
+func hashRegistrationAccessToken(registrationAccessToken string) string {
+	sum := sha256.Sum256([]byte(registrationAccessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -20,16 +20,23 @@ package clients
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
 	"github.com/longsleep/rndm"
 	"github.com/mendsley/gojwk"
 	"golang.org/x/crypto/blake2b"
 	_ "gopkg.in/yaml.v2" // Make sure we have yaml.
+
+	konnectoidc "github.com/libregraph/lico/oidc"
 )
 
 // Constat data used with dynamic stateless clients.
@@ -40,7 +47,21 @@ const (
 
 // RegistryData is the base structur of our client registry configuration file.
 type RegistryData struct {
-	Clients []*ClientRegistration `yaml:"clients,flow"`
+	Clients   []*ClientRegistration   `yaml:"clients,flow"`
+	Resources []*ResourceRegistration `yaml:"resources,flow"`
+
+	AuthorizationDetailsTypes []*AuthorizationDetailsTypeRegistration `yaml:"authorization_details_types,flow"`
+
+	RegistrationPolicy *RegistrationPolicy `yaml:"registration_policy"`
+}
+
+// ResourceRegistration defines a protected resource which can be requested
+// as target of access tokens with resource indicators as specified at
+// https://tools.ietf.org/html/rfc8707
+type ResourceRegistration struct {
+	URI string `yaml:"uri"`
+
+	AccessTokenFormat string `yaml:"access_token_format"`
 }
 
 // ClientRegistration defines a client with its properties.
@@ -53,6 +74,14 @@ type ClientRegistration struct {
 	Insecure      bool     `yaml:"insecure" json:"-"`
 
 	ImplicitScopes []string `yaml:"implicit_scopes" json:"-"`
+	Scopes         []string `yaml:"scopes,flow" json:"scopes,omitempty"`
+
+	RotateRefreshTokens                bool `yaml:"rotate_refresh_tokens" json:"-"`
+	RequirePushedAuthorizationRequests bool `yaml:"require_pushed_authorization_requests" json:"-"`
+
+	AccessTokenFormat string `yaml:"access_token_format" json:"-"`
+
+	AuthorizationDetailsTypes []string `yaml:"authorization_details_types,flow" json:"-"`
 
 	Dynamic         bool  `yaml:"-" json:"-"`
 	IDIssuedAt      int64 `yaml:"-" json:"-"`
@@ -63,19 +92,38 @@ type ClientRegistration struct {
 	URI             string   `yaml:"uri"  json:"uri,omitempty"`
 	GrantTypes      []string `yaml:"grant_types,flow" json:"grant_types,omitempty"`
 	ApplicationType string   `yaml:"application_type"  json:"application_type,omitempty"`
+	ResponseTypes   []string `yaml:"-" json:"response_types,omitempty"`
 
 	RedirectURIs []string `yaml:"redirect_uris,flow" json:"redirect_uris,omitempty"`
 	Origins      []string `yaml:"origins,flow" json:"-"`
+	RequestURIs  []string `yaml:"request_uris,flow" json:"-"`
 
 	JWKS *gojwk.Key `yaml:"jwks" json:"-"`
 
-	RawIDTokenSignedResponseAlg    string `yaml:"id_token_signed_response_alg" json:"id_token_signed_response_alg,omitempty"`
-	RawUserInfoSignedResponseAlg   string `yaml:"userinfo_signed_response_alg" json:"userinfo_signed_response_alg,omitempty"`
-	RawRequestObjectSigningAlg     string `yaml:"request_object_signing_alg" json:"request_object_signing_alg,omitempty"`
-	RawTokenEndpointAuthMethod     string `yaml:"token_endpoint_auth_method" json:"token_endpoint_auth_method,omitempty"`
-	RawTokenEndpointAuthSigningAlg string `yaml:"token_endpoint_auth_signing_alg"  json:"token_endpoint_auth_signing_alg,omitempty"`
+	RawIDTokenSignedResponseAlg       string `yaml:"id_token_signed_response_alg" json:"id_token_signed_response_alg,omitempty"`
+	RawUserInfoSignedResponseAlg      string `yaml:"userinfo_signed_response_alg" json:"userinfo_signed_response_alg,omitempty"`
+	RawAuthorizationSignedResponseAlg string `yaml:"authorization_signed_response_alg" json:"authorization_signed_response_alg,omitempty"`
+	RawRequestObjectSigningAlg        string `yaml:"request_object_signing_alg" json:"request_object_signing_alg,omitempty"`
+	RawTokenEndpointAuthMethod        string `yaml:"token_endpoint_auth_method" json:"token_endpoint_auth_method,omitempty"`
+	RawTokenEndpointAuthSigningAlg    string `yaml:"token_endpoint_auth_signing_alg"  json:"token_endpoint_auth_signing_alg,omitempty"`
+
+	RawIDTokenEncryptedResponseAlg  string `yaml:"id_token_encrypted_response_alg" json:"id_token_encrypted_response_alg,omitempty"`
+	RawIDTokenEncryptedResponseEnc  string `yaml:"id_token_encrypted_response_enc" json:"id_token_encrypted_response_enc,omitempty"`
+	RawUserInfoEncryptedResponseAlg string `yaml:"userinfo_encrypted_response_alg" json:"userinfo_encrypted_response_alg,omitempty"`
+	RawUserInfoEncryptedResponseEnc string `yaml:"userinfo_encrypted_response_enc" json:"userinfo_encrypted_response_enc,omitempty"`
+
+	TLSClientAuthSubjectDN string `yaml:"tls_client_auth_subject_dn" json:"tls_client_auth_subject_dn,omitempty"`
+
+	SubjectType         string `yaml:"subject_type" json:"subject_type,omitempty"`
+	SectorIdentifierURI string `yaml:"sector_identifier_uri" json:"sector_identifier_uri,omitempty"`
 
 	PostLogoutRedirectURIs []string `yaml:"post_logout_redirect_uris,flow" json:"post_logout_redirect_uris,omitempty"`
+
+	BackchannelLogoutURI             string `yaml:"backchannel_logout_uri" json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired bool   `yaml:"backchannel_logout_session_required" json:"backchannel_logout_session_required,omitempty"`
+
+	FrontchannelLogoutURI             string `yaml:"frontchannel_logout_uri" json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool   `yaml:"frontchannel_logout_session_required" json:"frontchannel_logout_session_required,omitempty"`
 }
 
 // Validate validates the associated client registration data and returns error
@@ -84,30 +132,40 @@ func (cr *ClientRegistration) Validate() error {
 	return nil
 }
 
-// Secure looks up the a matching key from the accociated client registration
-// and returns its public key part as a secured client.
+// Secure looks up the a matching signature key from the accociated client
+// registration and returns its public key part as a secured client. Keys
+// registered for encryption are never used.
 func (cr *ClientRegistration) Secure(rawKid interface{}) (*Secured, error) {
 	var kid string
 	var key crypto.PublicKey
 	var err error
 
-	switch len(cr.JWKS.Keys) {
+	var signingKeys []*gojwk.Key
+	if cr.JWKS != nil {
+		for _, k := range cr.JWKS.Keys {
+			if k.Use != "enc" {
+				signingKeys = append(signingKeys, k)
+			}
+		}
+	}
+
+	switch len(signingKeys) {
 	case 0:
 		// breaks
 	case 1:
 		// Use the one and only, no matter what kid says.
-		key, err = cr.JWKS.Keys[0].DecodePublicKey()
+		key, err = signingKeys[0].DecodePublicKey()
 		if err != nil {
 			return nil, err
 		}
-		kid = cr.JWKS.Keys[0].Kid
+		kid = signingKeys[0].Kid
 	default:
 		// Find by kid.
 		kid, _ = rawKid.(string)
 		if kid == "" {
 			kid = "default"
 		}
-		for _, k := range cr.JWKS.Keys {
+		for _, k := range signingKeys {
 			if kid == k.Kid {
 				key, err = k.DecodePublicKey()
 				if err != nil {
@@ -154,8 +212,12 @@ func (cr *ClientRegistration) SetDynamic(ctx context.Context, creator func(ctx c
 
 	// Initialize basic client registration data for dynamic client.
 	cr.IDIssuedAt = time.Now().Unix()
-	if registry.dynamicClientSecretDuration > 0 {
-		cr.SecretExpiresAt = time.Now().Add(registry.dynamicClientSecretDuration).Unix()
+	secretDuration := registry.dynamicClientSecretDuration
+	if policy := registry.RegistrationPolicy(); policy != nil {
+		secretDuration = policy.LimitSecretLifetime(secretDuration)
+	}
+	if secretDuration > 0 {
+		cr.SecretExpiresAt = time.Now().Add(secretDuration).Unix()
 	}
 	cr.Dynamic = true
 
@@ -200,6 +262,190 @@ func (cr *ClientRegistration) ApplyImplicitScopes(scopes map[string]bool) error
 	return nil
 }
 
+// HasGrantType returns true if the provided grant type is registered for the
+// accociated client registration.
+func (cr *ClientRegistration) HasGrantType(grantType string) bool {
+	for _, registeredGrantType := range cr.GrantTypes {
+		if registeredGrantType == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAuthorizationDetailsType returns true if the provided authorization
+// details type can be requested by the accociated client registration. All
+// types are allowed when the registration does not limit them.
+func (cr *ClientRegistration) AllowsAuthorizationDetailsType(detailsType string) bool {
+	if len(cr.AuthorizationDetailsTypes) == 0 {
+		return true
+	}
+	return containsString(cr.AuthorizationDetailsTypes, detailsType)
+}
+
+// HasRequestURI returns true if the provided request URI is registered for
+// the accociated client registration. The fragment is ignored when comparing
+// as specified at https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+func (cr *ClientRegistration) HasRequestURI(requestURI *url.URL) bool {
+	withoutFragment := *requestURI
+	withoutFragment.Fragment = ""
+	withoutFragment.RawFragment = ""
+	requestURIString := withoutFragment.String()
+	for _, registeredURIString := range cr.RequestURIs {
+		registeredURI, err := url.Parse(registeredURIString)
+		if err != nil {
+			continue
+		}
+		registeredURI.Fragment = ""
+		registeredURI.RawFragment = ""
+		if registeredURI.String() == requestURIString {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesTLSClientAuth returns true if the accociated client registration
+// authenticates with a client certificate as specified at
+// https://tools.ietf.org/html/rfc8705#section-2.
+func (cr *ClientRegistration) UsesTLSClientAuth() bool {
+	switch cr.RawTokenEndpointAuthMethod {
+	case konnectoidc.AuthMethodTLSClientAuth, konnectoidc.AuthMethodSelfSignedTLSClientAuth:
+		return true
+	}
+	return false
+}
+
+// IsConfidential returns true if the accociated client registration has
+// credentials to authenticate with.
+func (cr *ClientRegistration) IsConfidential() bool {
+	return cr.Secret != "" || cr.UsesTLSClientAuth() || cr.RawTokenEndpointAuthMethod == oidc.AuthMethodPrivateKeyJWT
+}
+
+// HasPublicKey returns true if the provided public key is found in the
+// registered keys of the accociated client registration. Keys registered for
+// encryption are ignored.
+func (cr *ClientRegistration) HasPublicKey(publicKey crypto.PublicKey) bool {
+	if cr.JWKS == nil {
+		return false
+	}
+	comparable, ok := publicKey.(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok {
+		return false
+	}
+	for _, k := range cr.JWKS.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.DecodePublicKey()
+		if err != nil {
+			continue
+		}
+		if comparable.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptionKey looks up a key suitable to encrypt to with the provided JWE
+// key management algorithm in the registered keys of the accociated client
+// registration and returns its key ID and public key.
+func (cr *ClientRegistration) EncryptionKey(alg string) (string, crypto.PublicKey, error) {
+	if cr.JWKS == nil {
+		return "", nil, fmt.Errorf("no jwks")
+	}
+	for _, k := range cr.JWKS.Keys {
+		if k.Use != "" && k.Use != "enc" {
+			continue
+		}
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		key, err := k.DecodePublicKey()
+		if err != nil {
+			continue
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RSA-") {
+				return k.Kid, key, nil
+			}
+		case *ecdsa.PublicKey:
+			if strings.HasPrefix(alg, "ECDH-ES") {
+				return k.Kid, key, nil
+			}
+		}
+	}
+
+	return "", nil, fmt.Errorf("no encryption key for %s", alg)
+}
+
+// UsesPairwiseSubject returns true if the accociated client registration
+// receives pairwise subject identifiers as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#PairwiseAlg
+func (cr *ClientRegistration) UsesPairwiseSubject() bool {
+	return cr.SubjectType == konnectoidc.SubjectIDPairwise
+}
+
+// SectorIdentifier returns the sector identifier of the accociated client
+// registration. This is the host component of the sector_identifier_uri or of
+// the first registered redirect URI, falling back to the client ID for clients
+// without either.
+func (cr *ClientRegistration) SectorIdentifier() string {
+	uriString := cr.SectorIdentifierURI
+	if uriString == "" && len(cr.RedirectURIs) > 0 {
+		uriString = cr.RedirectURIs[0]
+	}
+	if uriString != "" {
+		if uri, err := url.Parse(uriString); err == nil && uri.Host != "" {
+			return uri.Host
+		}
+	}
+	return cr.ID
+}
+
+// RequiresRedirectURIs returns true if the accociated client registration
+// uses any grant type which involves redirecting to the client. Clients
+// without registered grant types are considered to use redirects.
+func (cr *ClientRegistration) RequiresRedirectURIs() bool {
+	if len(cr.GrantTypes) == 0 {
+		return true
+	}
+	return cr.HasGrantType(oidc.GrantTypeAuthorizationCode) || cr.HasGrantType(oidc.GrantTypeImplicit)
+}
+
+// ApplyAllowedScopes limits the provided scopes to the scopes which are
+// registered for the accociated client registration. If no scopes are
+// provided, all registered scopes are returned. Returns error if any of the
+// provided scopes is not registered.
+func (cr *ClientRegistration) ApplyAllowedScopes(scopes map[string]bool) (map[string]bool, error) {
+	allowedScopes := make(map[string]bool)
+	for _, scope := range cr.Scopes {
+		if scope != "" {
+			allowedScopes[scope] = true
+		}
+	}
+	if len(scopes) == 0 {
+		return allowedScopes, nil
+	}
+
+	authorizedScopes := make(map[string]bool)
+	for scope, requested := range scopes {
+		if !requested {
+			continue
+		}
+		if !allowedScopes[scope] {
+			return nil, fmt.Errorf("scope not allowed: %v", scope)
+		}
+		authorizedScopes[scope] = true
+	}
+
+	return authorizedScopes, nil
+}
+
 func (cr *ClientRegistration) makeSecret(secret []byte) (string, string, error) {
 	// Create random secret. HMAC the client name with it to get the subject.
 	if secret == nil {
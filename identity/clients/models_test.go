@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/mendsley/gojwk"
+)
+
+func makeTestJWK(t *testing.T, kid string, use string) (*ecdsa.PrivateKey, *gojwk.Key) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := gojwk.PublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.Kid = kid
+	jwk.Use = use
+	return privateKey, jwk
+}
+
+func TestClientRegistrationSecureIgnoresEncryptionKeys(t *testing.T) {
+	encKey, encJWK := makeTestJWK(t, "enc", "enc")
+	sigKey, sigJWK := makeTestJWK(t, "sig", "sig")
+
+	// A single encryption key must not be used for signatures.
+	cr := &ClientRegistration{
+		ID:   "client",
+		JWKS: &gojwk.Key{Keys: []*gojwk.Key{encJWK}},
+	}
+	if _, err := cr.Secure(nil); err == nil {
+		t.Error("secure with only an encryption key must fail")
+	}
+	if _, err := cr.Secure("enc"); err == nil {
+		t.Error("secure with kid of an encryption key must fail")
+	}
+	if cr.HasPublicKey(encKey.Public()) {
+		t.Error("encryption key must not be found as public key")
+	}
+
+	// With an additional signature key, only the signature key is used.
+	cr.JWKS.Keys = append(cr.JWKS.Keys, sigJWK)
+	secured, err := cr.Secure(nil)
+	if err != nil {
+		t.Fatalf("secure must use the only signature key: %v", err)
+	}
+	if secured.Kid != "sig" || !sigKey.PublicKey.Equal(secured.PublicKey) {
+		t.Errorf("secure returned wrong key %s", secured.Kid)
+	}
+	if !cr.HasPublicKey(sigKey.Public()) {
+		t.Error("signature key must be found as public key")
+	}
+
+	// With multiple signature keys, an encryption key is never found by kid.
+	_, otherJWK := makeTestJWK(t, "other", "")
+	cr.JWKS.Keys = append(cr.JWKS.Keys, otherJWK)
+	if _, err := cr.Secure("enc"); err == nil {
+		t.Error("secure with kid of an encryption key must fail")
+	}
+	if secured, err := cr.Secure("other"); err != nil || secured.Kid != "other" {
+		t.Errorf("secure must find signature key by kid, got %v", err)
+	}
+
+	// The encryption key is still available for encryption.
+	if kid, _, err := cr.EncryptionKey("ECDH-ES"); err != nil || kid != "enc" {
+		t.Errorf("encryption key must be found, got %s %v", kid, err)
+	}
+}
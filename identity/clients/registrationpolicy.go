@@ -0,0 +1,267 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mendsley/gojwk"
+)
+
+// RegistrationPolicy defines which dynamic client registrations are accepted.
+// Empty lists do not restrict the accociated client metadata.
+type RegistrationPolicy struct {
+	InitialAccessTokens []string `yaml:"initial_access_tokens,flow"`
+
+	SoftwareStatementIssuers []*SoftwareStatementIssuer `yaml:"software_statement_issuers,flow"`
+	RequireSoftwareStatement bool                       `yaml:"require_software_statement"`
+
+	RedirectURIPatterns []string `yaml:"redirect_uri_patterns,flow"`
+	GrantTypes          []string `yaml:"grant_types,flow"`
+	Scopes              []string `yaml:"scopes,flow"`
+
+	MaxSecretLifetime uint64 `yaml:"max_secret_lifetime"`
+}
+
+// SoftwareStatementIssuer is a trusted publisher of software statements as
+// specified at https://tools.ietf.org/html/rfc7591#section-2.3, identified
+// by the iss claim of its software statements.
+type SoftwareStatementIssuer struct {
+	Issuer string     `yaml:"iss"`
+	JWKS   *gojwk.Key `yaml:"jwks"`
+}
+
+// Validate validates the accociated registration policy and returns error if
+// it is not valid.
+func (rp *RegistrationPolicy) Validate() error {
+	for _, pattern := range rp.RedirectURIPatterns {
+		if _, err := parseRedirectURIPattern(pattern); err != nil {
+			return fmt.Errorf("invalid redirect_uri pattern %v: %v", pattern, err)
+		}
+	}
+	for _, issuer := range rp.SoftwareStatementIssuers {
+		if issuer.Issuer == "" {
+			return errors.New("software statement issuer without iss")
+		}
+		if issuer.JWKS == nil || len(issuer.JWKS.Keys) == 0 {
+			return fmt.Errorf("software statement issuer %v without keys", issuer.Issuer)
+		}
+	}
+
+	return nil
+}
+
+// RequiresInitialAccessToken returns true if the accociated registration
+// policy only allows registration with an initial access token.
+func (rp *RegistrationPolicy) RequiresInitialAccessToken() bool {
+	return len(rp.InitialAccessTokens) > 0
+}
+
+// ValidateInitialAccessToken returns true if the provided initial access
+// token is one of the accociated registration policy's tokens.
+func (rp *RegistrationPolicy) ValidateInitialAccessToken(initialAccessToken string) bool {
+	if initialAccessToken == "" {
+		return false
+	}
+
+	valid := false
+	for _, token := range rp.InitialAccessTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(initialAccessToken)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// SoftwareStatementKey returns the public key of the trusted software
+// statement issuer with the provided iss value. The key is selected by the
+// provided kid if the issuer has more than one key.
+func (rp *RegistrationPolicy) SoftwareStatementKey(iss string, rawKid interface{}) (crypto.PublicKey, error) {
+	var issuer *SoftwareStatementIssuer
+	for _, candidate := range rp.SoftwareStatementIssuers {
+		if candidate.Issuer == iss {
+			issuer = candidate
+			break
+		}
+	}
+	if issuer == nil {
+		return nil, fmt.Errorf("untrusted software statement issuer: %v", iss)
+	}
+
+	// Use the one and only, no matter what kid says.
+	if len(issuer.JWKS.Keys) == 1 {
+		return issuer.JWKS.Keys[0].DecodePublicKey()
+	}
+	kid, _ := rawKid.(string)
+	for _, k := range issuer.JWKS.Keys {
+		if kid == k.Kid {
+			return k.DecodePublicKey()
+		}
+	}
+
+	return nil, fmt.Errorf("unknown kid")
+}
+
+// ValidateRedirectURIs returns error if any of the provided redirect URIs
+// does not match any of the accociated registration policy's patterns. The
+// scheme, host, path and query of the redirect URIs are matched separately, so
+// wildcards never match across URI components.
+func (rp *RegistrationPolicy) ValidateRedirectURIs(redirectURIs []string) error {
+	if len(rp.RedirectURIPatterns) == 0 {
+		return nil
+	}
+
+	patterns := make([]*url.URL, 0, len(rp.RedirectURIPatterns))
+	for _, rawPattern := range rp.RedirectURIPatterns {
+		pattern, err := parseRedirectURIPattern(rawPattern)
+		if err != nil {
+			return fmt.Errorf("invalid redirect_uri pattern %v: %v", rawPattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	for _, redirectURI := range redirectURIs {
+		uri, err := url.Parse(redirectURI)
+		if err != nil {
+			return fmt.Errorf("invalid redirect_uri: %v", redirectURI)
+		}
+		// Redirect URIs must not include a fragment, see
+		// https://tools.ietf.org/html/rfc6749#section-3.1.2
+		if uri.Fragment != "" || strings.Contains(redirectURI, "#") {
+			return fmt.Errorf("redirect_uri must not include a fragment: %v", redirectURI)
+		}
+
+		matched := false
+		for _, pattern := range patterns {
+			if matchRedirectURIPattern(pattern, uri) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("redirect_uri not allowed: %v", redirectURI)
+		}
+	}
+
+	return nil
+}
+
+// parseRedirectURIPattern parses the provided redirect URI pattern into its
+// URI components and checks that each of them is a valid match pattern.
+func parseRedirectURIPattern(rawPattern string) (*url.URL, error) {
+	pattern, err := url.Parse(rawPattern)
+	if err != nil {
+		return nil, err
+	}
+	if pattern.Scheme == "" || pattern.Host == "" || pattern.Opaque != "" {
+		return nil, errors.New("scheme and host required")
+	}
+	if pattern.Fragment != "" || pattern.User != nil {
+		return nil, errors.New("fragment and userinfo not allowed")
+	}
+	for _, component := range []string{pattern.Host, pattern.EscapedPath(), pattern.RawQuery} {
+		if _, err := path.Match(component, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return pattern, nil
+}
+
+// matchRedirectURIPattern returns true if each URI component of the provided
+// URI matches the accociated component of the provided pattern.
+func matchRedirectURIPattern(pattern *url.URL, uri *url.URL) bool {
+	if uri.Opaque != "" || uri.User != nil || uri.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(pattern.Scheme, uri.Scheme) {
+		return false
+	}
+	if ok, _ := path.Match(strings.ToLower(pattern.Host), strings.ToLower(uri.Host)); !ok {
+		return false
+	}
+	if ok, _ := path.Match(pattern.EscapedPath(), uri.EscapedPath()); !ok {
+		return false
+	}
+	if uri.RawQuery != "" || pattern.RawQuery != "" {
+		if ok, _ := path.Match(pattern.RawQuery, uri.RawQuery); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateGrantTypes returns error if any of the provided grant types is not
+// allowed by the accociated registration policy.
+func (rp *RegistrationPolicy) ValidateGrantTypes(grantTypes []string) error {
+	if len(rp.GrantTypes) == 0 {
+		return nil
+	}
+
+	for _, grantType := range grantTypes {
+		if !containsString(rp.GrantTypes, grantType) {
+			return fmt.Errorf("grant_type not allowed: %v", grantType)
+		}
+	}
+
+	return nil
+}
+
+// ApplyScopes returns the scopes a dynamic client may use when it requests
+// the provided scopes. Clients which do not request scopes get all the scopes
+// of the accociated registration policy. Returns error if any of the provided
+// scopes is not allowed.
+func (rp *RegistrationPolicy) ApplyScopes(scopes []string) ([]string, error) {
+	if len(rp.Scopes) == 0 {
+		return scopes, nil
+	}
+	if len(scopes) == 0 {
+		return rp.Scopes, nil
+	}
+
+	for _, scope := range scopes {
+		if !containsString(rp.Scopes, scope) {
+			return nil, fmt.Errorf("scope not allowed: %v", scope)
+		}
+	}
+
+	return scopes, nil
+}
+
+// LimitSecretLifetime returns the provided client secret lifetime, limited to
+// the maximum secret lifetime of the accociated registration policy. Zero
+// means the secret does not expire.
+func (rp *RegistrationPolicy) LimitSecretLifetime(lifetime time.Duration) time.Duration {
+	if rp.MaxSecretLifetime == 0 {
+		return lifetime
+	}
+
+	maxLifetime := time.Duration(rp.MaxSecretLifetime) * time.Second
+	if lifetime == 0 || lifetime > maxLifetime {
+		return maxLifetime
+	}
+	return lifetime
+}
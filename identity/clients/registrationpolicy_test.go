@@ -0,0 +1,51 @@
+package clients
+
+import (
+	"testing"
+)
+
+func TestRegistrationPolicyRedirectURIPatterns(t *testing.T) {
+	policy := &RegistrationPolicy{
+		RedirectURIPatterns: []string{"https://*.example.com/*", "http://localhost:8080/callback"},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	redirectURIs := []struct {
+		uri       string
+		shallFail bool
+	}{
+		{"https://app.example.com/callback", false},
+		{"https://APP.example.com/callback", false},
+		{"http://localhost:8080/callback", false},
+		{"https://app.example.com/callback/other", true},
+		{"https://app.example.com/callback?state=1", true},
+		{"https://app.example.com/callback#fragment", true},
+		{"https://evil.com?.example.com/x", true},
+		{"https://evil.com#.example.com/x", true},
+		{"https://evil.com/.example.com/x", true},
+		{"https://user@app.example.com/callback", true},
+		{"https://app.example.com.evil.com/callback", true},
+		{"http://app.example.com/callback", true},
+		{"https:app.example.com/callback", true},
+	}
+	for _, redirectURI := range redirectURIs {
+		err := policy.ValidateRedirectURIs([]string{redirectURI.uri})
+		if !redirectURI.shallFail && err != nil {
+			t.Errorf("redirect_uri '%v' failed: %v", redirectURI.uri, err)
+		}
+		if redirectURI.shallFail && err == nil {
+			t.Errorf("redirect_uri '%v' did not fail as expected", redirectURI.uri)
+		}
+	}
+
+	for _, pattern := range []string{"https://[.example.com/*", "*.example.com/*", "https://*.example.com/*#x"} {
+		policy := &RegistrationPolicy{
+			RedirectURIPatterns: []string{pattern},
+		}
+		if err := policy.Validate(); err == nil {
+			t.Errorf("redirect_uri pattern '%v' did not fail validation", pattern)
+		}
+	}
+}
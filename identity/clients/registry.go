@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -39,13 +40,19 @@ type Registry struct {
 
 	trustedURI *url.URL
 	clients    map[string]*ClientRegistration
+	resources  map[string]*ResourceRegistration
+
+	authorizationDetailsTypes map[string]*AuthorizationDetailsTypeRegistration
 
 	allowDynamicClientRegistration bool
 	dynamicClientSecretDuration    time.Duration
+	registrationPolicy             *RegistrationPolicy
 
 	StatelessCreator   func(ctx context.Context, signingMethod jwt.SigningMethod, claims jwt.Claims) (string, error)
 	StatelessValidator func(token *jwt.Token) (interface{}, error)
 
+	Store Store
+
 	logger logrus.FieldLogger
 }
 
@@ -78,6 +85,9 @@ func NewRegistry(ctx context.Context, trustedURI *url.URL, registrationConfFilep
 	r := &Registry{
 		trustedURI: trustedURI,
 		clients:    make(map[string]*ClientRegistration),
+		resources:  make(map[string]*ResourceRegistration),
+
+		authorizationDetailsTypes: make(map[string]*AuthorizationDetailsTypeRegistration),
 
 		allowDynamicClientRegistration: allowDynamicClientRegistration,
 		dynamicClientSecretDuration:    dynamicClientSecretDuration,
@@ -109,6 +119,43 @@ func NewRegistry(ctx context.Context, trustedURI *url.URL, registrationConfFilep
 		logger.WithFields(fields).Debugln("registered client")
 	}
 
+	for _, resource := range registryData.Resources {
+		registerErr := r.RegisterResource(resource)
+		fields := logrus.Fields{
+			"uri":                 resource.URI,
+			"access_token_format": resource.AccessTokenFormat,
+		}
+
+		if registerErr != nil {
+			logger.WithError(registerErr).WithFields(fields).Warnln("skipped registration of invalid resource")
+			continue
+		}
+		logger.WithFields(fields).Debugln("registered resource")
+	}
+
+	for _, detailsType := range registryData.AuthorizationDetailsTypes {
+		registerErr := r.RegisterAuthorizationDetailsType(detailsType)
+		fields := logrus.Fields{
+			"type": detailsType.Type,
+		}
+
+		if registerErr != nil {
+			logger.WithError(registerErr).WithFields(fields).Warnln("skipped registration of invalid authorization details type")
+			continue
+		}
+		logger.WithFields(fields).Debugln("registered authorization details type")
+	}
+
+	if registryData.RegistrationPolicy != nil {
+		if err := r.SetRegistrationPolicy(registryData.RegistrationPolicy); err != nil {
+			return nil, fmt.Errorf("invalid registration policy: %v", err)
+		}
+		logger.WithFields(logrus.Fields{
+			"initial_access_token":       registryData.RegistrationPolicy.RequiresInitialAccessToken(),
+			"software_statement_issuers": len(registryData.RegistrationPolicy.SoftwareStatementIssuers),
+		}).Debugln("registered dynamic client registration policy")
+	}
+
 	return r, nil
 }
 
@@ -130,7 +177,8 @@ func (r *Registry) Register(client *ClientRegistration) error {
 		return errors.New("invalid client_id")
 	}
 
-	if !client.Insecure && len(client.RedirectURIs) == 0 {
+	requiresRedirectURIs := client.RequiresRedirectURIs()
+	if !client.Insecure && requiresRedirectURIs && len(client.RedirectURIs) == 0 {
 		return errors.New("no redirect_uris")
 	}
 
@@ -156,7 +204,7 @@ func (r *Registry) Register(client *ClientRegistration) error {
 				client.Origins = append(client.Origins, parsed.Scheme+"://"+parsed.Host)
 			}
 		}
-		if !client.Insecure && len(client.Origins) == 0 {
+		if !client.Insecure && requiresRedirectURIs && len(client.Origins) == 0 {
 			return errors.New("no origins - origin is required when application_type is web")
 		}
 		// breaks
@@ -180,12 +228,102 @@ func (r *Registry) Register(client *ClientRegistration) error {
 		return fmt.Errorf("unknown application_type: %v", client.ApplicationType)
 	}
 
+	if !IsKnownAccessTokenFormat(client.AccessTokenFormat) {
+		return fmt.Errorf("unknown access_token_format: %v", client.AccessTokenFormat)
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	r.clients[client.ID] = client
 	return nil
 }
 
+// RegisterResource validates the provided resource registration and adds the
+// resource to the accociated registry if valid. Returns error otherwise.
+func (r *Registry) RegisterResource(resource *ResourceRegistration) error {
+	if err := ValidateResourceURI(resource.URI); err != nil {
+		return err
+	}
+	if !IsKnownAccessTokenFormat(resource.AccessTokenFormat) {
+		return fmt.Errorf("unknown access_token_format: %v", resource.AccessTokenFormat)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.resources[resource.URI] = resource
+	return nil
+}
+
+// GetResource returns the resource registration for the provided resource
+// URI if it is registered.
+func (r *Registry) GetResource(ctx context.Context, uri string) (*ResourceRegistration, bool) {
+	r.mutex.RLock()
+	resource, ok := r.resources[uri]
+	r.mutex.RUnlock()
+
+	return resource, ok
+}
+
+// RegisterAuthorizationDetailsType validates the provided authorization
+// details type registration and adds the type to the accociated registry if
+// valid. Returns error otherwise.
+func (r *Registry) RegisterAuthorizationDetailsType(detailsType *AuthorizationDetailsTypeRegistration) error {
+	if err := detailsType.validateRegistration(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.authorizationDetailsTypes[detailsType.Type] = detailsType
+	return nil
+}
+
+// GetAuthorizationDetailsType returns the authorization details type
+// registration for the provided type if it is registered.
+func (r *Registry) GetAuthorizationDetailsType(ctx context.Context, detailsType string) (*AuthorizationDetailsTypeRegistration, bool) {
+	r.mutex.RLock()
+	registration, ok := r.authorizationDetailsTypes[detailsType]
+	r.mutex.RUnlock()
+
+	return registration, ok
+}
+
+// AuthorizationDetailsTypes returns the sorted list of all registered
+// authorization details types.
+func (r *Registry) AuthorizationDetailsTypes() []string {
+	r.mutex.RLock()
+	detailsTypes := make([]string, 0, len(r.authorizationDetailsTypes))
+	for detailsType := range r.authorizationDetailsTypes {
+		detailsTypes = append(detailsTypes, detailsType)
+	}
+	r.mutex.RUnlock()
+
+	sort.Strings(detailsTypes)
+	return detailsTypes
+}
+
+// SetRegistrationPolicy validates the provided registration policy and sets
+// it as the policy for dynamic client registration of the accociated
+// registry if valid. Returns error otherwise.
+func (r *Registry) SetRegistrationPolicy(policy *RegistrationPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.registrationPolicy = policy
+	return nil
+}
+
+// RegistrationPolicy returns the policy for dynamic client registration of the
+// accociated registry, nil if none is set.
+func (r *Registry) RegistrationPolicy() *RegistrationPolicy {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.registrationPolicy
+}
+
 // Validate checks if the provided client registration data complies to the
 // provided parameters and returns error when it does not.
 func (r *Registry) Validate(client *ClientRegistration, clientSecret string, redirectURIString string, originURIString string, withoutSecret bool) error {
@@ -364,5 +502,19 @@ func (r *Registry) getDynamicClient(clientID string) (*ClientRegistration, bool)
 		}
 	}
 
+	// Apply updates and deletions of the dynamic client.
+	if registration != nil {
+		if record, ok := r.getStoreRecord(clientID); ok {
+			if record.Claims == nil {
+				return nil, false
+			}
+			stored := *record.Claims.ClientRegistration
+			registration = &stored
+			registration.ID = clientID
+			registration.Secret = record.Claims.Subject
+			registration.Dynamic = true
+		}
+	}
+
 	return registration, registration != nil
 }
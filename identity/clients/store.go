@@ -0,0 +1,47 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clients
+
+import (
+	"time"
+)
+
+// StoreRecord is the persisted state of a dynamic client, keyed by its
+// stateless client ID. A record without claims marks a deleted client.
+type StoreRecord struct {
+	Claims *RegistrationClaims `json:"claims,omitempty"`
+
+	RegistrationAccessTokenHash string `json:"registration_access_token_hash,omitempty"`
+
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+// Expired returns true if the accociated record has an expiration time which
+// lies before the provided time.
+func (sr *StoreRecord) Expired(now time.Time) bool {
+	return sr.ExpiresAt > 0 && sr.ExpiresAt < now.Unix()
+}
+
+// Store is a interface defining a store for dynamic clients. Records are
+// written when dynamic clients are registered, updated or deleted so these
+// changes take effect without changing the stateless client ID. Records only
+// need to be remembered until they expire.
+type Store interface {
+	Get(clientID string) (*StoreRecord, bool, error)
+	Set(clientID string, record *StoreRecord) error
+}
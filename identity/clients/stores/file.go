@@ -0,0 +1,150 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/libregraph/lico/identity/clients"
+)
+
+// Store provides the api and state for dynamic client records persisted to a
+// JSON file, so updates and deletions of dynamic clients survive restarts.
+// The Store's methods are safe to call from multiple Go routines, but the file
+// must not be shared between multiple processes.
+type fileStore struct {
+	mutex sync.RWMutex
+	table map[string]*clients.StoreRecord
+
+	path   string
+	logger logrus.FieldLogger
+}
+
+// NewFileStore creates a new file backed dynamic client Store, loading
+// existing records from the provided path if it exists.
+func NewFileStore(ctx context.Context, path string, logger logrus.FieldLogger) (clients.Store, error) {
+	s := &fileStore{
+		table: make(map[string]*clients.StoreRecord),
+
+		path:   path,
+		logger: logger,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, &s.table); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		// breaks
+	default:
+		return nil, err
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *fileStore) purgeExpired() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	purged := 0
+	for clientID, record := range s.table {
+		if record.Expired(now) {
+			delete(s.table, clientID)
+			purged++
+		}
+	}
+	if purged > 0 {
+		if err := s.save(); err != nil {
+			s.logger.WithError(err).Errorln("failed to write client store file")
+		}
+	}
+}
+
+// save writes the table of the accociated Store to its file. The caller must
+// hold the write lock.
+func (s *fileStore) save() error {
+	data, err := json.Marshal(s.table)
+	if err != nil {
+		return err
+	}
+
+	// Write to temporary file in the same folder first, then rename to make
+	// the change atomic.
+	f, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// Get looks up the record for the provided client ID in the accociated
+// Store's table.
+func (s *fileStore) Get(clientID string) (*clients.StoreRecord, bool, error) {
+	s.mutex.RLock()
+	record, ok := s.table[clientID]
+	s.mutex.RUnlock()
+
+	return record, ok, nil
+}
+
+// Set records the provided record for the provided client ID and writes the
+// accociated Store's file.
+func (s *fileStore) Set(clientID string, record *clients.StoreRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.table[clientID] = record
+
+	return s.save()
+}
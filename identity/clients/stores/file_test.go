@@ -0,0 +1,86 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package stores
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/libregraph/lico/identity/clients"
+)
+
+func TestFileStorePersistence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "lico-clients-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "clients.json")
+
+	store, err := NewFileStore(ctx, path, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("client-a", &clients.StoreRecord{
+		Claims: &clients.RegistrationClaims{
+			StandardClaims: jwt.StandardClaims{
+				Subject: "hashed-secret",
+			},
+			ClientRegistration: &clients.ClientRegistration{
+				Name:         "Client A",
+				RedirectURIs: []string{"https://app.example.com/cb"},
+			},
+		},
+		RegistrationAccessTokenHash: "hash",
+		ExpiresAt:                   time.Now().Add(time.Hour).Unix(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("client-b", &clients.StoreRecord{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load again from the same file.
+	store, err = NewFileStore(ctx, path, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, ok, _ := store.Get("client-a")
+	if !ok || record.Claims == nil || record.Claims.ClientRegistration == nil {
+		t.Fatal("client-a must be found after reload")
+	}
+	if record.Claims.Subject != "hashed-secret" || record.Claims.Name != "Client A" || record.RegistrationAccessTokenHash != "hash" {
+		t.Errorf("client-a record was incorrect after reload, got %+v", record.Claims)
+	}
+	if record, ok, _ := store.Get("client-b"); !ok || record.Claims != nil {
+		t.Error("client-b must be found as deleted after reload")
+	}
+	if _, ok, _ := store.Get("client-c"); ok {
+		t.Error("client-c must not be found")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package stores
+
+import (
+	"context"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+
+	"github.com/libregraph/lico/identity/clients"
+)
+
+// Store provides the api and state for in-memory dynamic client records. The
+// Store's methods are safe to call from multiple Go routines.
+type memoryMapStore struct {
+	table cmap.ConcurrentMap
+}
+
+// NewMemoryMapStore creates a new in-memory dynamic client Store.
+func NewMemoryMapStore(ctx context.Context) clients.Store {
+	s := &memoryMapStore{
+		table: cmap.New(),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *memoryMapStore) purgeExpired() {
+	var expired []string
+	now := time.Now()
+	for entry := range s.table.IterBuffered() {
+		if entry.Val.(*clients.StoreRecord).Expired(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, key := range expired {
+		s.table.Remove(key)
+	}
+}
+
+// Get looks up the record for the provided client ID in the accociated
+// Store's table.
+func (s *memoryMapStore) Get(clientID string) (*clients.StoreRecord, bool, error) {
+	record, ok := s.table.Get(clientID)
+	if !ok {
+		return nil, false, nil
+	}
+
+	return record.(*clients.StoreRecord), true, nil
+}
+
+// Set records the provided record for the provided client ID in the
+// accociated Store's table.
+func (s *memoryMapStore) Set(clientID string, record *clients.StoreRecord) error {
+	s.table.Set(clientID, record)
+
+	return nil
+}
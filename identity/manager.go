@@ -44,5 +44,5 @@ type Manager interface {
 	AddRoutes(ctx context.Context, router *mux.Router)
 
 	OnSetLogon(func(ctx context.Context, rw http.ResponseWriter, user User) error) error
-	OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter) error) error
+	OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error) error
 }
@@ -470,6 +470,6 @@ func (im *CookieIdentityManager) OnSetLogon(func(ctx context.Context, rw http.Re
 }
 
 // OnUnsetLogon implements the identity.Manager interface.
-func (im *CookieIdentityManager) OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter) error) error {
+func (im *CookieIdentityManager) OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error) error {
 	return nil
 }
@@ -191,7 +191,10 @@ func (im *DummyIdentityManager) Fetch(ctx context.Context, userID string, sessio
 	authorizedScopes, _ := identity.AuthorizeScopes(im, user, scopes)
 	claims := identity.GetUserClaimsForScopes(user, authorizedScopes, requestedClaimsMaps)
 
-	return identity.NewAuthRecord(im, user.Subject(), authorizedScopes, nil, claims), true, nil
+	auth := identity.NewAuthRecord(im, user.Subject(), authorizedScopes, nil, claims)
+	auth.SetUser(user)
+
+	return auth, true, nil
 }
 
 // Name implements the identity.Manager interface.
@@ -223,6 +226,6 @@ func (im *DummyIdentityManager) OnSetLogon(func(ctx context.Context, rw http.Res
 }
 
 // OnUnsetLogon implements the identity.Manager interface.
-func (im *DummyIdentityManager) OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter) error) error {
+func (im *DummyIdentityManager) OnUnsetLogon(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error) error {
 	return nil
 }
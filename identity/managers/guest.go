@@ -32,6 +32,7 @@ import (
 	"github.com/libregraph/lico/identity"
 	"github.com/libregraph/lico/identity/clients"
 	"github.com/libregraph/lico/managers"
+	konnectoidc "github.com/libregraph/lico/oidc"
 	"github.com/libregraph/lico/oidc/payload"
 	"github.com/libregraph/lico/utils"
 )
@@ -47,7 +48,7 @@ type GuestIdentityManager struct {
 	clients *clients.Registry
 
 	onSetLogonCallbacks   []func(ctx context.Context, rw http.ResponseWriter, user identity.User) error
-	onUnsetLogonCallbacks []func(ctx context.Context, rw http.ResponseWriter) error
+	onUnsetLogonCallbacks []func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error
 }
 
 // NewGuestIdentityManager creates a new GuestIdentityManager from the
@@ -70,7 +71,7 @@ func NewGuestIdentityManager(c *identity.Config) *GuestIdentityManager {
 		logger: c.Logger,
 
 		onSetLogonCallbacks:   make([]func(ctx context.Context, rw http.ResponseWriter, user identity.User) error, 0),
-		onUnsetLogonCallbacks: make([]func(ctx context.Context, rw http.ResponseWriter) error, 0),
+		onUnsetLogonCallbacks: make([]func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error, 0),
 	}
 
 	return im
@@ -268,6 +269,8 @@ func (im *GuestIdentityManager) Authenticate(ctx context.Context, rw http.Respon
 
 	auth := identity.NewAuthRecord(im, user.Subject(), nil, nil, nil)
 	auth.SetUser(user)
+	// Guests are not authenticated at all.
+	auth.SetAuthContext(konnectoidc.ACRNone, nil)
 
 	return auth, nil
 }
@@ -389,7 +392,7 @@ func (im *GuestIdentityManager) EndSession(ctx context.Context, rw http.Response
 
 	// Trigger callbacks.
 	for _, f := range im.onUnsetLogonCallbacks {
-		err := f(ctx, rw)
+		err := f(ctx, rw, req)
 		if err != nil {
 			return err
 		}
@@ -497,7 +500,7 @@ func (im *GuestIdentityManager) OnSetLogon(cb func(ctx context.Context, rw http.
 }
 
 // OnUnsetLogon implements the identity.Manager interface.
-func (im *GuestIdentityManager) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter) error) error {
+func (im *GuestIdentityManager) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error) error {
 	im.onUnsetLogonCallbacks = append(im.onUnsetLogonCallbacks, cb)
 	return nil
 }
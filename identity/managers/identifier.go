@@ -187,6 +187,7 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 	}
 
 	var auth identity.AuthRecord
+	forceLogin := false
 
 	// More checks.
 	if err == nil {
@@ -199,6 +200,18 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 			return nil, err
 		}
 
+		// Force sign-in when the current logon does not satisfy the requested
+		// authentication context class. Voluntary requests only do so once, so
+		// they never fail when the new logon does not satisfy them either.
+		if acrValues, essential := ar.RequestedACRValues(); user != nil && len(acrValues) > 0 {
+			if acr, _ := u.AuthContext(); !konnectoidc.ACRSatisfies(acr, acrValues) && (essential || ar.Prompts[oidc.PromptNone] != true) {
+				err = ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "IdentifierIdentityManager: acr not satisfied")
+				forceLogin = true
+			}
+		}
+	}
+
+	if err == nil {
 		if user != nil {
 			// Inject required scopes into request.
 			for scope, ok := range user.RequiredScopes() {
@@ -243,6 +256,9 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 			return nil, err
 		}
 		query.Set("flow", identifier.FlowOIDC)
+		if forceLogin {
+			query.Set("prompt", oidc.PromptLogin)
+		}
 		if ar.Claims != nil {
 			// Add derived scope list from claims request.
 			claimsScopes := ar.Claims.Scopes(ar.Scopes)
@@ -250,6 +266,11 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 				query.Set("claims_scope", strings.Join(claimsScopes, " "))
 			}
 		}
+		if len(ar.AuthorizationDetails) > 0 {
+			// Add authorization details, which might have been passed in a
+			// request object, to be shown for consent.
+			query.Set("authorization_details", ar.AuthorizationDetails.String())
+		}
 		u, _ := url.Parse(im.signInFormURI)
 		u.RawQuery = query.Encode()
 		utils.WriteRedirect(rw, http.StatusFound, u, nil, false)
@@ -268,6 +289,7 @@ func (im *IdentifierIdentityManager) Authenticate(ctx context.Context, rw http.R
 	if loggedOn, logonAt := u.LoggedOn(); loggedOn {
 		auth.SetAuthTime(logonAt)
 	}
+	auth.SetAuthContext(u.AuthContext())
 
 	return auth, nil
 }
@@ -301,6 +323,10 @@ func (im *IdentifierIdentityManager) Authorize(ctx context.Context, rw http.Resp
 	} else {
 		promptConsent = true
 	}
+	// Authorization details always need consent of the user.
+	if len(ar.AuthorizationDetails) > 0 {
+		promptConsent = true
+	}
 
 	// Check given consent.
 	consent, err := im.identifier.GetConsentFromConsentCookie(req.Context(), rw, req, req.Form.Get("konnect"))
@@ -344,6 +370,11 @@ func (im *IdentifierIdentityManager) Authorize(ctx context.Context, rw http.Resp
 				query.Set("claims_scope", strings.Join(claimsScopes, " "))
 			}
 		}
+		if len(ar.AuthorizationDetails) > 0 {
+			// Add authorization details, which might have been passed in a
+			// request object, to be shown for consent.
+			query.Set("authorization_details", ar.AuthorizationDetails.String())
+		}
 		if ar.Scopes != nil {
 			scopes := make([]string, 0)
 			for scope, ok := range ar.Scopes {
@@ -442,7 +473,7 @@ func (im *IdentifierIdentityManager) EndSession(ctx context.Context, rw http.Res
 			// Directly end identifier session when a trusted client requests
 			// and honor redirect wish if any.
 			var uri *url.URL
-			uri, err = im.identifier.EndSession(ctx, u, rw, esr.PostLogoutRedirectURI, esr.State)
+			uri, err = im.identifier.EndSession(ctx, u, rw, req, esr.PostLogoutRedirectURI, esr.State)
 			if err != nil {
 				// Do nothing if err.
 				im.logger.WithError(err).Errorln("IdentifierIdentityManager: failed to end session")
@@ -549,6 +580,6 @@ func (im *IdentifierIdentityManager) OnSetLogon(cb func(ctx context.Context, rw
 }
 
 // OnUnsetLogon implements the identity.Manager interface.
-func (im *IdentifierIdentityManager) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter) error) error {
+func (im *IdentifierIdentityManager) OnUnsetLogon(cb func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error) error {
 	return im.identifier.OnUnsetLogon(cb)
 }
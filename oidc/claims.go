@@ -34,6 +34,7 @@ type IDTokenClaims struct {
 	*EmailClaims
 
 	*SessionClaims
+	*AuthContextClaims
 }
 
 // Valid implements the jwt.Claims interface.
@@ -103,3 +104,38 @@ func (c UserInfoClaims) Valid() error {
 type SessionClaims struct {
 	SessionID string `json:"sid,omitempty"`
 }
+
+// AuthContextClaims define the claims describing how the authentication was
+// performed as specified at https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type AuthContextClaims struct {
+	AuthContextClassReference string   `json:"acr,omitempty"`
+	AuthMethodsReferences     []string `json:"amr,omitempty"`
+}
+
+// NewAuthContextClaims returns a new AuthContextClaims holding the provided
+// values or nil if no value is set.
+func NewAuthContextClaims(acr string, amr []string) *AuthContextClaims {
+	if acr == "" && len(amr) == 0 {
+		return nil
+	}
+
+	return &AuthContextClaims{
+		AuthContextClassReference: acr,
+		AuthMethodsReferences:     amr,
+	}
+}
+
+// LogoutTokenClaims define the claims found in OIDC Logout Tokens as specified
+// at https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+type LogoutTokenClaims struct {
+	jwt.StandardClaims
+
+	Events map[string]interface{} `json:"events"`
+
+	*SessionClaims
+}
+
+// Valid implements the jwt.Claims interface.
+func (c LogoutTokenClaims) Valid() error {
+	return c.StandardClaims.Valid()
+}
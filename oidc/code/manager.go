@@ -27,6 +27,8 @@ type Record struct {
 	AuthenticationRequest *payload.AuthenticationRequest
 	Auth                  identity.AuthRecord
 	Session               *payload.Session
+
+	AuthorizationDetails payload.AuthorizationDetails
 }
 
 // Manager is a interface defining a code manager.
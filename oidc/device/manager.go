@@ -0,0 +1,54 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package device
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libregraph/lico/oidc/code"
+)
+
+// Errors returned by device managers when polling.
+var (
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("slow down")
+	ErrAccessDenied         = errors.New("access denied")
+	ErrExpiredToken         = errors.New("expired token")
+	ErrNotFound             = errors.New("not found")
+)
+
+// Record bundles the data of a device authorization request as specified at
+// https://tools.ietf.org/html/rfc8628#section-3.1 stored in a device manager.
+type Record struct {
+	ClientID string
+	RawScope string
+
+	// Set by the manager when the record is created.
+	UserCode  string
+	ExpiresAt time.Time
+	Interval  time.Duration
+}
+
+// Manager is a interface defining a device manager.
+type Manager interface {
+	Create(record *Record) (string, error)
+	Get(userCode string) (*Record, bool)
+	Approve(userCode string, result *code.Record) error
+	Deny(userCode string) error
+	Poll(deviceCode string) (*code.Record, error)
+}
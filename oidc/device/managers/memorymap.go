@@ -0,0 +1,275 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package managers
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/longsleep/rndm"
+	"github.com/orcaman/concurrent-map"
+
+	"github.com/libregraph/lico/oidc/code"
+	"github.com/libregraph/lico/oidc/device"
+)
+
+const (
+	deviceCodeValidDuration = 10 * time.Minute
+	devicePollInterval      = 5 * time.Second
+	deviceSlowDownIncrement = 5 * time.Second
+
+	// User codes use a base-20 character set without vowels as recommended
+	// at https://tools.ietf.org/html/rfc8628#section-6.1
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+// Manager provides the api and state for OAuth2 device authorization requests.
+// The Manager's methods are safe to call from multiple Go routines.
+type memoryMapManager struct {
+	table     cmap.ConcurrentMap
+	userCodes cmap.ConcurrentMap
+}
+
+type deviceRequestRecord struct {
+	sync.Mutex
+
+	record     *device.Record
+	deviceCode string
+
+	when     time.Time
+	lastPoll time.Time
+	interval time.Duration
+
+	result *code.Record
+	denied bool
+}
+
+// NewMemoryMapManager creates a new device Manager.
+func NewMemoryMapManager(ctx context.Context) device.Manager {
+	dm := &memoryMapManager{
+		table:     cmap.New(),
+		userCodes: cmap.New(),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+
+		}
+	}()
+
+	return dm
+}
+
+func (dm *memoryMapManager) purgeExpired() {
+	var expired []*deviceRequestRecord
+	deadline := time.Now().Add(-deviceCodeValidDuration)
+	var rr *deviceRequestRecord
+	for entry := range dm.table.IterBuffered() {
+		rr = entry.Val.(*deviceRequestRecord)
+		if rr.when.Before(deadline) {
+			expired = append(expired, rr)
+		}
+	}
+	for _, rr := range expired {
+		dm.remove(rr)
+	}
+}
+
+func (dm *memoryMapManager) remove(rr *deviceRequestRecord) {
+	dm.table.Remove(rr.deviceCode)
+	dm.userCodes.Remove(normalizeUserCode(rr.record.UserCode))
+}
+
+func (dm *memoryMapManager) getByUserCode(userCode string) (*deviceRequestRecord, bool) {
+	stored, found := dm.userCodes.Get(normalizeUserCode(userCode))
+	if !found {
+		return nil, false
+	}
+	rr := stored.(*deviceRequestRecord)
+	if time.Now().After(rr.record.ExpiresAt) {
+		return nil, false
+	}
+
+	return rr, true
+}
+
+// Create creates a new random device code and user code, stores them together
+// with the provided record in the accociated Manager's table and returns the
+// device code. The user code, expiry and interval are set on the record.
+func (dm *memoryMapManager) Create(record *device.Record) (string, error) {
+	deviceCode := rndm.GenerateRandomString(32)
+
+	var userCode string
+	for {
+		var err error
+		userCode, err = generateUserCode()
+		if err != nil {
+			return "", err
+		}
+		if _, exists := dm.userCodes.Get(userCode); !exists {
+			break
+		}
+	}
+
+	now := time.Now()
+	record.UserCode = userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+	record.ExpiresAt = now.Add(deviceCodeValidDuration)
+	record.Interval = devicePollInterval
+
+	rr := &deviceRequestRecord{
+		record:     record,
+		deviceCode: deviceCode,
+
+		when:     now,
+		interval: devicePollInterval,
+	}
+	dm.table.Set(deviceCode, rr)
+	dm.userCodes.Set(userCode, rr)
+
+	return deviceCode, nil
+}
+
+// Get looks up the provided user code in the accociated Manager's table. If
+// found and still pending, it returns the record plus true.
+func (dm *memoryMapManager) Get(userCode string) (*device.Record, bool) {
+	rr, found := dm.getByUserCode(userCode)
+	if !found {
+		return nil, false
+	}
+
+	rr.Lock()
+	defer rr.Unlock()
+	if rr.result != nil || rr.denied {
+		return nil, false
+	}
+
+	return rr.record, true
+}
+
+// Approve marks the pending request identified by the provided user code as
+// approved with the provided result.
+func (dm *memoryMapManager) Approve(userCode string, result *code.Record) error {
+	rr, found := dm.getByUserCode(userCode)
+	if !found {
+		return device.ErrNotFound
+	}
+
+	rr.Lock()
+	defer rr.Unlock()
+	if rr.result != nil || rr.denied {
+		return device.ErrNotFound
+	}
+	rr.result = result
+
+	return nil
+}
+
+// Deny marks the pending request identified by the provided user code as
+// denied.
+func (dm *memoryMapManager) Deny(userCode string) error {
+	rr, found := dm.getByUserCode(userCode)
+	if !found {
+		return device.ErrNotFound
+	}
+
+	rr.Lock()
+	defer rr.Unlock()
+	if rr.result != nil || rr.denied {
+		return device.ErrNotFound
+	}
+	rr.denied = true
+
+	return nil
+}
+
+// Poll looks up the provided device code in the accociated Manager's table. If
+// the request was approved, the result is returned and the request is removed.
+// Otherwise an error is returned, describing the state of the request as
+// specified at https://tools.ietf.org/html/rfc8628#section-3.5
+func (dm *memoryMapManager) Poll(deviceCode string) (*code.Record, error) {
+	stored, found := dm.table.Get(deviceCode)
+	if !found {
+		return nil, device.ErrNotFound
+	}
+	rr := stored.(*deviceRequestRecord)
+
+	rr.Lock()
+	defer rr.Unlock()
+
+	now := time.Now()
+	if now.After(rr.record.ExpiresAt) {
+		dm.remove(rr)
+		return nil, device.ErrExpiredToken
+	}
+	if rr.denied {
+		dm.remove(rr)
+		return nil, device.ErrAccessDenied
+	}
+	if rr.result != nil {
+		dm.remove(rr)
+		return rr.result, nil
+	}
+
+	lastPoll := rr.lastPoll
+	rr.lastPoll = now
+	if !lastPoll.IsZero() && now.Sub(lastPoll) < rr.interval {
+		rr.interval += deviceSlowDownIncrement
+		return nil, device.ErrSlowDown
+	}
+
+	return nil, device.ErrAuthorizationPending
+}
+
+func generateUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeCharset)))
+	userCode := make([]byte, userCodeLength)
+	for i := range userCode {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		userCode[i] = userCodeCharset[n.Int64()]
+	}
+
+	return string(userCode), nil
+}
+
+// normalizeUserCode removes the characters which are ignored when comparing
+// user codes as recommended at https://tools.ietf.org/html/rfc8628#section-6.1
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
@@ -24,6 +24,53 @@ import (
 	"github.com/libregraph/lico/utils"
 )
 
+// Additional OAuth2 error codes as specified at
+// https://tools.ietf.org/html/rfc6749#section-5.2
+const (
+	ErrorCodeOAuth2InvalidClient      = "invalid_client"
+	ErrorCodeOAuth2UnauthorizedClient = "unauthorized_client"
+	ErrorCodeOAuth2InvalidScope       = "invalid_scope"
+)
+
+// OAuth2 device authorization grant error codes as specified at
+// https://tools.ietf.org/html/rfc8628#section-3.5
+const (
+	ErrorCodeOAuth2AuthorizationPending = "authorization_pending"
+	ErrorCodeOAuth2SlowDown             = "slow_down"
+	ErrorCodeOAuth2ExpiredToken         = "expired_token"
+)
+
+// OAuth2 token exchange error codes as specified at
+// https://tools.ietf.org/html/rfc8693#section-2.2.2
+const (
+	ErrorCodeOAuth2InvalidTarget = "invalid_target"
+)
+
+// Additional OpenID Connect 1.0 error codes as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthError
+const (
+	ErrorCodeOIDCInvalidRequestURI = "invalid_request_uri"
+)
+
+// OAuth2 DPoP error codes as specified at
+// https://datatracker.ietf.org/doc/html/rfc9449#section-12.2
+const (
+	ErrorCodeOAuth2InvalidDPoPProof = "invalid_dpop_proof"
+)
+
+// OAuth2 rich authorization requests error codes as specified at
+// https://datatracker.ietf.org/doc/html/rfc9396#section-5
+const (
+	ErrorCodeOAuth2InvalidAuthorizationDetails = "invalid_authorization_details"
+)
+
+// OAuth2 dynamic client registration error codes as specified at
+// https://tools.ietf.org/html/rfc7591#section-3.2.2
+const (
+	ErrorCodeOAuth2InvalidSoftwareStatement    = "invalid_software_statement"
+	ErrorCodeOAuth2UnapprovedSoftwareStatement = "unapproved_software_statement"
+)
+
 // OAuth2Error defines a general OAuth2 error with id and decription.
 type OAuth2Error struct {
 	ErrorID          string `json:"error"`
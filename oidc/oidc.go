@@ -20,3 +20,195 @@ package oidc
 // LibreGraphIDTokenSubjectSaltV1 is the salt value used when hashing Subjects
 // in ID tokens created by this application.
 const LibreGraphIDTokenSubjectSaltV1 = "lico-IDToken-v1"
+
+// LibreGraphPairwiseSubjectSaltV1 is the salt value used when hashing pairwise
+// Subjects created by this application.
+const LibreGraphPairwiseSubjectSaltV1 = "lico-pairwise-v1"
+
+// SubjectIDPairwise is the string value of the pairwise Subject Identifier
+// Type as defined in https://openid.net/specs/openid-connect-core-1_0.html#SubjectIDTypes
+const SubjectIDPairwise = "pairwise"
+
+// Additional grant types as supported by this implementation.
+const (
+	// GrantTypeClientCredentials is the client credentials grant as specified
+	// at https://tools.ietf.org/html/rfc6749#section-4.4
+	GrantTypeClientCredentials = "client_credentials"
+	// GrantTypeDeviceCode is the device authorization grant as specified at
+	// https://tools.ietf.org/html/rfc8628#section-3.4
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+	// GrantTypeTokenExchange is the token exchange grant as specified at
+	// https://tools.ietf.org/html/rfc8693#section-2.1
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// GrantTypeJWTBearer is the JWT bearer authorization grant as specified at
+	// https://tools.ietf.org/html/rfc7523#section-2.1
+	GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// Token type identifiers as specified at https://tools.ietf.org/html/rfc8693#section-3
+const (
+	TokenTypeIdentifierAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIdentifierJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// ClientAssertionTypeJWTBearer is the client assertion type of JWT client
+// authentication as specified at https://tools.ietf.org/html/rfc7523#section-2.2
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Mutual TLS client authentication methods as specified at
+// https://tools.ietf.org/html/rfc8705#section-2.1.1
+const (
+	AuthMethodTLSClientAuth           = "tls_client_auth"
+	AuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+// JWE algorithms as supported by this implementation for encrypted ID tokens
+// and userinfo responses as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#Encryption
+var (
+	EncryptionAlgValuesSupported = []string{
+		"RSA-OAEP",
+		"RSA-OAEP-256",
+		"ECDH-ES",
+		"ECDH-ES+A128KW",
+		"ECDH-ES+A256KW",
+	}
+	EncryptionEncValuesSupported = []string{
+		"A128CBC-HS256",
+		"A256CBC-HS512",
+		"A128GCM",
+		"A256GCM",
+	}
+)
+
+// DefaultEncryptionEnc is the content encryption algorithm used when a client
+// registers an encryption algorithm without content encryption algorithm.
+const DefaultEncryptionEnc = "A128CBC-HS256"
+
+// Additional JWT header keys as used by this implementation.
+const (
+	JWTHeaderType = "typ"
+	JWTHeaderJWK  = "jwk"
+)
+
+// DPoP proof of possession values as specified at
+// https://datatracker.ietf.org/doc/html/rfc9449
+const (
+	// TokenTypeDPoP is the token type and authorization scheme of DPoP bound
+	// access tokens.
+	TokenTypeDPoP = "DPoP"
+	// DPoPHeader is the HTTP request header which carries DPoP proofs.
+	DPoPHeader = "DPoP"
+	// DPoPProofType is the JOSE header typ value of DPoP proofs.
+	DPoPProofType = "dpop+jwt"
+)
+
+// Back-Channel Logout values as specified at
+// https://openid.net/specs/openid-connect-backchannel-1_0.html
+const (
+	// BackChannelLogoutEvent is the event member of Logout Tokens.
+	BackChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+	// LogoutTokenType is the JOSE header typ value of Logout Tokens.
+	LogoutTokenType = "logout+jwt"
+)
+
+// Access token formats as supported by this implementation. The default format
+// carries the client ID as audience and identity data in private claims, the
+// JWT format follows https://datatracker.ietf.org/doc/html/rfc9068
+const (
+	AccessTokenFormatDefault = "default"
+	AccessTokenFormatJWT     = "jwt"
+
+	// AccessTokenTypeJWT is the JOSE header typ value of access tokens in
+	// the JWT format.
+	AccessTokenTypeJWT = "at+jwt"
+)
+
+// Additional response modes as supported by this implementation.
+const (
+	// ResponseModeFormPost is the form post response mode as specified at
+	// https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+	ResponseModeFormPost = "form_post"
+	// ResponseModeWebMessage is the web message response mode as specified
+	// at https://tools.ietf.org/html/draft-sakimura-oauth-wmrm-00
+	ResponseModeWebMessage = "web_message"
+)
+
+// JWT secured authorization response modes as specified at
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.3
+const (
+	ResponseModeJWT         = "jwt"
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFragmentJWT = "fragment.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+)
+
+// Additional claims as used by this implementation.
+const (
+	// JWTIDClaim is the JWT ID claim as specified at
+	// https://tools.ietf.org/html/rfc7519#section-4.1.7
+	JWTIDClaim = "jti"
+	// ScopeClaim is the scope claim as specified at
+	// https://tools.ietf.org/html/rfc8693#section-4.2
+	ScopeClaim = "scope"
+	// ACRClaim is the authentication context class reference claim as
+	// specified at https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+	ACRClaim = "acr"
+	// AMRClaim is the authentication methods references claim as specified
+	// at https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+	AMRClaim = "amr"
+	// AuthorizationDetailsClaim is the authorization details claim as
+	// specified at https://datatracker.ietf.org/doc/html/rfc9396#section-9.1
+	AuthorizationDetailsClaim = "authorization_details"
+)
+
+// Authentication context class references as supported by this
+// implementation. ACRNone is used for authentications which do not meet any
+// assurance level, for example guests.
+const (
+	ACRNone      = "0"
+	ACRFederated = "urn:libregraph:lico:acr:federated"
+	ACRPassword  = "urn:libregraph:lico:acr:password"
+)
+
+// ACRLevels maps the supported authentication context class references to
+// their level. An authentication satisfies all classes with the same or a
+// lower level. Password logons are verified by this implementation itself and
+// thus rank higher than logons at external authorities.
+var ACRLevels = map[string]int{
+	ACRNone:      0,
+	ACRFederated: 1,
+	ACRPassword:  2,
+}
+
+// ACRValuesSupported is the list of supported authentication context class
+// references as published in discovery.
+var ACRValuesSupported = []string{
+	ACRNone,
+	ACRFederated,
+	ACRPassword,
+}
+
+// Authentication method references as used by this implementation as
+// specified at https://tools.ietf.org/html/rfc8176#section-2
+const (
+	AMRPassword  = "pwd"
+	AMRFederated = "fed"
+)
+
+// ACRSatisfies returns true if the provided authentication context class
+// reference meets the level of at least one of the provided requested values.
+// Unknown values are never satisfied.
+func ACRSatisfies(acr string, values []string) bool {
+	level, ok := ACRLevels[acr]
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if requiredLevel, known := ACRLevels[value]; known && level >= requiredLevel {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package par
+
+import (
+	"net/url"
+	"time"
+)
+
+// RequestURIPrefix is the URN prefix of request_uri values created for pushed
+// authorization requests as specified at
+// https://tools.ietf.org/html/rfc9126#section-2.2
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// Record bundles the data of a pushed authorization request stored in a
+// pushed authorization request manager.
+type Record struct {
+	ClientID string
+	Values   url.Values
+
+	// Set by the manager when the record is created.
+	ExpiresAt time.Time
+}
+
+// Manager is a interface defining a pushed authorization request manager.
+type Manager interface {
+	Create(record *Record) (string, error)
+	Get(requestURI string) (*Record, bool)
+	Remove(requestURI string)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/longsleep/rndm"
+	"github.com/orcaman/concurrent-map"
+
+	"github.com/libregraph/lico/oidc/par"
+)
+
+const (
+	// The request URI is used by the authorization endpoint for the whole
+	// interactive sign-in and consent flow, so it has to stay valid for a
+	// little longer than the 60 seconds suggested in the specification.
+	requestURIValidDuration = 5 * time.Minute
+)
+
+// Manager provides the api and state for OAuth2 pushed authorization requests.
+// The Manager's methods are safe to call from multiple Go routines.
+type memoryMapManager struct {
+	table cmap.ConcurrentMap
+}
+
+// NewMemoryMapManager creates a new pushed authorization request Manager.
+func NewMemoryMapManager(ctx context.Context) par.Manager {
+	pm := &memoryMapManager{
+		table: cmap.New(),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pm.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+
+		}
+	}()
+
+	return pm
+}
+
+func (pm *memoryMapManager) purgeExpired() {
+	var expired []string
+	now := time.Now()
+	var record *par.Record
+	for entry := range pm.table.IterBuffered() {
+		record = entry.Val.(*par.Record)
+		if record.ExpiresAt.Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, requestURI := range expired {
+		pm.table.Remove(requestURI)
+	}
+}
+
+// Create creates a new random request URI, stores it together with the
+// provided record in the accociated Manager's table and returns the request
+// URI. The expiry is set on the record.
+func (pm *memoryMapManager) Create(record *par.Record) (string, error) {
+	requestURI := par.RequestURIPrefix + rndm.GenerateRandomString(32)
+
+	record.ExpiresAt = time.Now().Add(requestURIValidDuration)
+	pm.table.Set(requestURI, record)
+
+	return requestURI, nil
+}
+
+// Get looks up the provided request URI in the accociated Manager's table. If
+// found and not expired, it returns the record plus true.
+func (pm *memoryMapManager) Get(requestURI string) (*par.Record, bool) {
+	stored, found := pm.table.Get(requestURI)
+	if !found {
+		return nil, false
+	}
+	record := stored.(*par.Record)
+	if time.Now().After(record.ExpiresAt) {
+		return nil, false
+	}
+
+	return record, true
+}
+
+// Remove removes the provided request URI from the accociated Manager's
+// table.
+func (pm *memoryMapManager) Remove(requestURI string) {
+	pm.table.Remove(requestURI)
+}
@@ -49,6 +49,7 @@ type AuthenticationRequest struct {
 	RawPrompt       string         `schema:"prompt"`
 	RawIDTokenHint  string         `schema:"id_token_hint"`
 	RawMaxAge       string         `schema:"max_age"`
+	RawACRValues    string         `schema:"acr_values"`
 
 	RawRequest      string `schema:"request"`
 	RawRequestURI   string `schema:"request_uri"`
@@ -57,18 +58,29 @@ type AuthenticationRequest struct {
 	CodeChallenge       string `schema:"code_challenge"`
 	CodeChallengeMethod string `schema:"code_challenge_method"`
 
+	Resources []string `schema:"resource"`
+
+	RawAuthorizationDetails string `schema:"authorization_details"`
+
 	Scopes        map[string]bool `schema:"-"`
 	ResponseTypes map[string]bool `schema:"-"`
 	Prompts       map[string]bool `schema:"-"`
 	RedirectURI   *url.URL        `schema:"-"`
 	IDTokenHint   *jwt.Token      `schema:"-"`
 	MaxAge        time.Duration   `schema:"-"`
+	ACRValues     []string        `schema:"-"`
 	Request       *jwt.Token      `schema:"-"`
 
+	AuthorizationDetails AuthorizationDetails `schema:"-"`
+
 	UseFragment bool   `schema:"-"`
 	Flow        string `schema:"-"`
 
 	Session *Session `schema:"-"`
+
+	// SubjectMapper maps user subjects to the subject as seen by the client
+	// when verifying the IDTokenHint, for example for pairwise subjects.
+	SubjectMapper func(sub string) (string, error) `schema:"-"`
 }
 
 // DecodeAuthenticationRequest returns a AuthenticationRequest holding the
@@ -167,6 +179,20 @@ func NewAuthenticationRequest(values url.Values, providerMetadata *oidc.WellKnow
 	case oidc.ResponseModeQuery:
 		ar.UseFragment = false
 		// breaks
+	case konnectoidc.ResponseModeFormPost, konnectoidc.ResponseModeWebMessage:
+		// Response parameters are never added to the redirect URI.
+		ar.UseFragment = false
+		// breaks
+	case konnectoidc.ResponseModeQueryJWT, konnectoidc.ResponseModeFormPostJWT:
+		ar.UseFragment = false
+		// breaks
+	case konnectoidc.ResponseModeFragmentJWT:
+		ar.UseFragment = true
+		// breaks
+	case konnectoidc.ResponseModeJWT:
+		// Use the default of the response type.
+		// https://openid.net/specs/oauth-v2-jarm.html#section-2.3.4
+		// breaks
 	}
 
 	if ar.RawMaxAge != "" {
@@ -176,6 +202,9 @@ func NewAuthenticationRequest(values url.Values, providerMetadata *oidc.WellKnow
 		}
 		ar.MaxAge = time.Duration(maxAgeInt) * time.Second
 	}
+	if ar.RawACRValues != "" {
+		ar.ACRValues = strings.Split(ar.RawACRValues, " ")
+	}
 
 	if ar.Claims != nil && ar.Claims.Passthru != nil {
 		// Remove pass thru claims when not provided in a secure manner. This
@@ -241,6 +270,9 @@ func (ar *AuthenticationRequest) ApplyRequestObject(roc *RequestObjectClaims, me
 	if roc.Nonce != "" {
 		ar.Nonce = roc.Nonce
 	}
+	if roc.ResponseMode != "" {
+		ar.ResponseMode = roc.ResponseMode
+	}
 	if roc.RawPrompt != "" {
 		ar.RawPrompt = roc.RawPrompt
 	}
@@ -250,6 +282,9 @@ func (ar *AuthenticationRequest) ApplyRequestObject(roc *RequestObjectClaims, me
 	if roc.RawMaxAge != "" {
 		ar.RawMaxAge = roc.RawMaxAge
 	}
+	if roc.RawACRValues != "" {
+		ar.RawACRValues = roc.RawACRValues
+	}
 	if roc.RawRegistration != "" {
 		ar.RawRegistration = roc.RawRegistration
 	}
@@ -259,10 +294,39 @@ func (ar *AuthenticationRequest) ApplyRequestObject(roc *RequestObjectClaims, me
 	if roc.CodeChallenge != "" {
 		ar.CodeChallenge = roc.CodeChallenge
 	}
+	if roc.AuthorizationDetails != nil {
+		ar.AuthorizationDetails = roc.AuthorizationDetails
+	}
 
 	return nil
 }
 
+// RequestedACRValues returns the authentication context class references
+// requested by the accociated authentication request and true if they were
+// requested as essential. The acr claim of the ID token claims request takes
+// precedence over the acr_values parameter, which is always voluntary as
+// specified at https://openid.net/specs/openid-connect-core-1_0.html#acrSemantics
+func (ar *AuthenticationRequest) RequestedACRValues() ([]string, bool) {
+	if ar.Claims != nil && ar.Claims.IDToken != nil {
+		if value, ok := ar.Claims.IDToken.Get(konnectoidc.ACRClaim); ok && value != nil {
+			var values []string
+			if s, ok := value.Value.(string); ok {
+				values = append(values, s)
+			}
+			for _, v := range value.Values {
+				if s, ok := v.(string); ok {
+					values = append(values, s)
+				}
+			}
+			if len(values) > 0 {
+				return values, value.Essential
+			}
+		}
+	}
+
+	return ar.ACRValues, false
+}
+
 // Validate validates the request data of the accociated authentication request.
 func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 	switch ar.RawResponseType {
@@ -320,6 +384,12 @@ func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 		}
 	}
 
+	if ar.ResponseMode == konnectoidc.ResponseModeQueryJWT && ar.Flow != oidc.FlowCode {
+		// Tokens must not be passed in the query, unless encrypted.
+		// https://openid.net/specs/oauth-v2-jarm.html#section-2.3.1
+		return ar.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "query.jwt response mode not allowed for response type")
+	}
+
 	if _, hasNonePrompt := ar.Prompts[oidc.PromptNone]; hasNonePrompt {
 		if len(ar.Prompts) > 1 {
 			// Cannot have other prompts if none is requested.
@@ -364,6 +434,20 @@ func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 		}
 	}
 
+	// Rich authorization requests as specified at
+	// https://datatracker.ietf.org/doc/html/rfc9396#section-2, the request
+	// object takes precedence over the parameter.
+	if ar.AuthorizationDetails == nil && ar.RawAuthorizationDetails != "" {
+		authorizationDetails, err := ParseAuthorizationDetails(ar.RawAuthorizationDetails)
+		if err != nil {
+			return ar.NewBadRequest(konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails, err.Error())
+		}
+		ar.AuthorizationDetails = authorizationDetails
+	}
+	if err := ar.AuthorizationDetails.Validate(); err != nil {
+		return ar.NewBadRequest(konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails, err.Error())
+	}
+
 	if ar.RawRequestURI != "" {
 		return ar.NewError(oidc.ErrorCodeOIDCRequestURINotSupported, "")
 	}
@@ -377,6 +461,14 @@ func (ar *AuthenticationRequest) Validate(keyFunc jwt.Keyfunc) error {
 // Verify checks that the passed parameters match the accociated requirements.
 func (ar *AuthenticationRequest) Verify(userID string) error {
 	if ar.IDTokenHint != nil {
+		if ar.SubjectMapper != nil {
+			// Map userID to the subject as seen by the client.
+			sub, err := ar.SubjectMapper(userID)
+			if err != nil {
+				return ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "userid mismatch")
+			}
+			userID = sub
+		}
 		// Compare userID with IDTokenHint.
 		if userID != ar.IDTokenHint.Claims.(*konnectoidc.IDTokenClaims).Subject {
 			return ar.NewError(oidc.ErrorCodeOIDCLoginRequired, "userid mismatch")
@@ -424,6 +516,13 @@ type AuthenticationSuccess struct {
 	SessionState string `url:"session_state,omitempty"`
 }
 
+// AuthenticationSignedResponse holds the outgoing data for an authorize
+// request with a JWT secured authorization response mode as specified at
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.1
+type AuthenticationSignedResponse struct {
+	Response string `url:"response" json:"response"`
+}
+
 // AuthenticationError holds the outgoind data for a failed OpenID
 // Connect 1.0 authorize request as specified at
 // http://openid.net/specs/openid-connect-core-1_0.html#AuthError and
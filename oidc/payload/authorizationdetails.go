@@ -0,0 +1,73 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/libregraph/lico/identity/clients"
+)
+
+// AuthorizationDetail is a single authorization details object as specified
+// at https://datatracker.ietf.org/doc/html/rfc9396#section-2. Besides the
+// common fields, its fields depend on its type.
+type AuthorizationDetail map[string]interface{}
+
+// Type returns the type of the accociated authorization details object.
+func (ad AuthorizationDetail) Type() string {
+	detailType, _ := ad[clients.AuthorizationDetailsTypeField].(string)
+	return detailType
+}
+
+// AuthorizationDetails is the list of authorization details objects as
+// requested with the authorization_details parameter.
+type AuthorizationDetails []AuthorizationDetail
+
+// ParseAuthorizationDetails parses the provided JSON encoded value of an
+// authorization_details parameter.
+func ParseAuthorizationDetails(value string) (AuthorizationDetails, error) {
+	var ads AuthorizationDetails
+	if err := json.Unmarshal([]byte(value), &ads); err != nil {
+		return nil, fmt.Errorf("failed to decode authorization_details: %w", err)
+	}
+
+	return ads, nil
+}
+
+// Validate checks that all objects of the accociated authorization details
+// have a type as required by https://datatracker.ietf.org/doc/html/rfc9396#section-2.
+func (ads AuthorizationDetails) Validate() error {
+	for _, ad := range ads {
+		if ad == nil || ad.Type() == "" {
+			return errors.New("authorization_details object without type")
+		}
+	}
+
+	return nil
+}
+
+// String returns the JSON encoding of the accociated authorization details.
+func (ads AuthorizationDetails) String() string {
+	if ads == nil {
+		return ""
+	}
+	b, _ := json.Marshal(ads)
+	return string(b)
+}
@@ -191,3 +191,15 @@ func (sv *ScopesValue) UnmarshalJSON(data []byte) error {
 	*sv = result
 	return nil
 }
+
+// ConfirmationClaims define the confirmation claim values which bind a token
+// to a proof of possession key as specified at
+// https://tools.ietf.org/html/rfc7800#section-3.1.
+type ConfirmationClaims struct {
+	// JKT is the JWK SHA-256 thumbprint of a DPoP key as specified at
+	// https://datatracker.ietf.org/doc/html/rfc9449#section-6.1
+	JKT string `json:"jkt,omitempty"`
+	// X5tS256 is the SHA-256 thumbprint of a client certificate as specified
+	// at https://tools.ietf.org/html/rfc8705#section-3.1
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
@@ -40,6 +40,10 @@ type EndSessionRequest struct {
 
 	IDTokenHint           *jwt.Token `schema:"-"`
 	PostLogoutRedirectURI *url.URL   `schema:"-"`
+
+	// SubjectMapper maps user subjects to the subject as seen by the client
+	// when verifying the IDTokenHint, for example for pairwise subjects.
+	SubjectMapper func(sub string) (string, error) `schema:"-"`
 }
 
 // DecodeEndSessionRequest returns a EndSessionRequest holding the
@@ -89,6 +93,14 @@ func (esr *EndSessionRequest) Validate(keyFunc jwt.Keyfunc) error {
 // Verify checks that the passed parameters match the accociated requirements.
 func (esr *EndSessionRequest) Verify(userID string) error {
 	if esr.IDTokenHint != nil {
+		if esr.SubjectMapper != nil {
+			// Map userID to the subject as seen by the client.
+			sub, err := esr.SubjectMapper(userID)
+			if err != nil {
+				return esr.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "userid mismatch")
+			}
+			userID = sub
+		}
 		// Compare userID with IDTokenHint.
 		if userID != esr.IDTokenHint.Claims.(*konnectoidc.IDTokenClaims).Subject {
 			return esr.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "userid mismatch")
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package payload
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/libregraph/oidc-go"
+)
+
+// Token type hints as specified at https://tools.ietf.org/html/rfc7009#section-4.1.2
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionRequest holds the incoming parameters and request data for
+// the OAuth 2.0 token introspection endpoint as specified at
+// https://tools.ietf.org/html/rfc7662#section-2.1
+type IntrospectionRequest struct {
+	providerMetadata *oidc.WellKnown
+
+	Token         string `schema:"token"`
+	TokenTypeHint string `schema:"token_type_hint"`
+
+	ClientID     string `schema:"client_id"`
+	ClientSecret string `schema:"client_secret"`
+
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+}
+
+// DecodeIntrospectionRequest returns an IntrospectionRequest holding the
+// provided request's form data.
+func DecodeIntrospectionRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*IntrospectionRequest, error) {
+	ir, err := NewIntrospectionRequest(req.PostForm, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	ir.ClientID, ir.ClientSecret, err = decodeClientCredentials(req, ir.ClientID, ir.ClientSecret, ir.ClientAssertionType, ir.ClientAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	return ir, nil
+}
+
+// NewIntrospectionRequest returns an IntrospectionRequest holding the
+// provided url values.
+func NewIntrospectionRequest(values url.Values, providerMetadata *oidc.WellKnown) (*IntrospectionRequest, error) {
+	ir := &IntrospectionRequest{
+		providerMetadata: providerMetadata,
+	}
+
+	err := DecodeSchema(ir, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return ir, nil
+}
+
+// IntrospectionResponse holds the outgoing data for a token introspection
+// request as specified at https://tools.ietf.org/html/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active bool `json:"active"`
+
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	JTI       string `json:"jti,omitempty"`
+
+	Confirmation *ConfirmationClaims `json:"cnf,omitempty"`
+
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
+
+	IdentityProvider string `json:"lg.p,omitempty"`
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package payload
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
+)
+
+// PushedAuthorizationRequest holds the incoming parameters and request data
+// for the OAuth 2.0 pushed authorization request endpoint as specified at
+// https://tools.ietf.org/html/rfc9126#section-2.1
+type PushedAuthorizationRequest struct {
+	ClientID        string
+	ClientSecret    string
+	ClientAssertion string
+
+	AuthenticationRequest *AuthenticationRequest
+	Values                url.Values
+}
+
+// DecodePushedAuthorizationRequest returns a PushedAuthorizationRequest
+// holding the provided request's form data.
+func DecodePushedAuthorizationRequest(req *http.Request, providerMetadata *oidc.WellKnown, keyFunc jwt.Keyfunc) (*PushedAuthorizationRequest, error) {
+	values := make(url.Values)
+	for key, value := range req.PostForm {
+		switch key {
+		case "client_secret", "client_assertion", "client_assertion_type":
+			// Never store client credentials.
+			continue
+		case "request_uri":
+			// https://tools.ietf.org/html/rfc9126#section-2.1
+			return nil, fmt.Errorf("request_uri must not be provided")
+		}
+		values[key] = value
+	}
+
+	ar, err := NewAuthenticationRequest(values, providerMetadata, keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	par := &PushedAuthorizationRequest{
+		AuthenticationRequest: ar,
+		Values:                values,
+	}
+	par.ClientAssertion = req.PostForm.Get("client_assertion")
+	par.ClientID, par.ClientSecret, err = decodeClientCredentials(req, req.PostForm.Get("client_id"), req.PostForm.Get("client_secret"), req.PostForm.Get("client_assertion_type"), par.ClientAssertion)
+	if err != nil {
+		return nil, err
+	}
+	if ar.ClientID == "" {
+		// Client authenticated with HTTP Basic or client assertion, complete
+		// the request.
+		ar.ClientID = par.ClientID
+		values.Set("client_id", par.ClientID)
+	}
+
+	return par, nil
+}
+
+// PushedAuthorizationResponse holds the outgoing data for a successful OAuth
+// 2.0 pushed authorization request as specified at
+// https://tools.ietf.org/html/rfc9126#section-2.2
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
@@ -37,6 +37,9 @@ import (
 // specified at https://openid.net/specs/openid-connect-registration-1_0.html#ClientRegistration and
 // https://openid.net/specs/openid-connect-session-1_0.html#DynRegRegistrations
 type ClientRegistrationRequest struct {
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+
 	RedirectURIs    []string `json:"redirect_uris"`
 	ResponseTypes   []string `json:"response_types"`
 	GrantTypes      []string `json:"grant_types"`
@@ -45,14 +48,28 @@ type ClientRegistrationRequest struct {
 	Contacts   []string `json:"contacts"`
 	ClientName string   `json:"client_name"`
 	ClientURI  string   `json:"client_uri"`
+	Scope      string   `json:"scope,omitempty"`
+
+	SoftwareID        string `json:"software_id,omitempty"`
+	SoftwareVersion   string `json:"software_version,omitempty"`
+	SoftwareStatement string `json:"software_statement,omitempty"`
 
 	RawJWKS json.RawMessage `json:"jwks"`
 
-	RawIDTokenSignedResponseAlg    string `json:"id_token_signed_response_alg"`
-	RawUserInfoSignedResponseAlg   string `json:"userinfo_signed_response_alg"`
-	RawRequestObjectSigningAlg     string `json:"request_object_signing_alg"`
-	RawTokenEndpointAuthMethod     string `json:"token_endpoint_auth_method"`
-	RawTokenEndpointAuthSigningAlg string `json:"token_endpoint_auth_signing_alg"`
+	RawIDTokenSignedResponseAlg       string `json:"id_token_signed_response_alg"`
+	RawUserInfoSignedResponseAlg      string `json:"userinfo_signed_response_alg"`
+	RawAuthorizationSignedResponseAlg string `json:"authorization_signed_response_alg"`
+	RawRequestObjectSigningAlg        string `json:"request_object_signing_alg"`
+	RawTokenEndpointAuthMethod        string `json:"token_endpoint_auth_method"`
+	RawTokenEndpointAuthSigningAlg    string `json:"token_endpoint_auth_signing_alg"`
+
+	RawIDTokenEncryptedResponseAlg  string `json:"id_token_encrypted_response_alg,omitempty"`
+	RawIDTokenEncryptedResponseEnc  string `json:"id_token_encrypted_response_enc,omitempty"`
+	RawUserInfoEncryptedResponseAlg string `json:"userinfo_encrypted_response_alg,omitempty"`
+	RawUserInfoEncryptedResponseEnc string `json:"userinfo_encrypted_response_enc,omitempty"`
+
+	SubjectType         string `json:"subject_type,omitempty"`
+	SectorIdentifierURI string `json:"sector_identifier_uri,omitempty"`
 
 	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
 
@@ -74,18 +91,55 @@ func DecodeClientRegistrationRequest(req *http.Request) (*ClientRegistrationRequ
 		return nil, fmt.Errorf("failed to decode client registration request: %v", err)
 	}
 
-	if crr.RawJWKS != nil {
-		jwks, err := gojwk.Unmarshal(crr.RawJWKS)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode client registration request jwks: %v", err)
-		}
-		// Only use keys.
-		crr.JWKS = &gojwk.Key{
-			Keys: jwks.Keys,
+	err = crr.decodeJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	return &crr, nil
+}
+
+func (crr *ClientRegistrationRequest) decodeJWKS() error {
+	if crr.RawJWKS == nil {
+		return nil
+	}
+
+	jwks, err := gojwk.Unmarshal(crr.RawJWKS)
+	if err != nil {
+		return fmt.Errorf("failed to decode client registration request jwks: %v", err)
+	}
+	// Only use keys.
+	crr.JWKS = &gojwk.Key{
+		Keys: jwks.Keys,
+	}
+
+	return nil
+}
+
+// ApplySoftwareStatementClaims applies the provided claims of a verified
+// software statement to the accociated client registration request. Client
+// metadata values of the software statement take precedence over the values
+// of the request as specified at https://tools.ietf.org/html/rfc7591#section-2.3
+func (crr *ClientRegistrationRequest) ApplySoftwareStatementClaims(claims map[string]interface{}) error {
+	metadata := make(map[string]interface{})
+	for name, value := range claims {
+		switch name {
+		case "client_id", "client_secret", "software_statement":
+			// Not client metadata, skip.
+		default:
+			metadata[name] = value
 		}
 	}
 
-	return &crr, err
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(b, crr); err != nil {
+		return fmt.Errorf("failed to decode software statement: %v", err)
+	}
+
+	return crr.decodeJWKS()
 }
 
 // Validate validates the request data of the accociated client registration
@@ -214,6 +268,12 @@ func (crr *ClientRegistrationRequest) Validate() error {
 			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unknown userinfo_signed_response_alg")
 		}
 	}
+	if crr.RawAuthorizationSignedResponseAlg != "" {
+		alg := jwt.GetSigningMethod(crr.RawAuthorizationSignedResponseAlg)
+		if alg == nil {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unknown authorization_signed_response_alg")
+		}
+	}
 	if crr.RawRequestObjectSigningAlg != "" {
 		alg := jwt.GetSigningMethod(crr.RawRequestObjectSigningAlg)
 		if alg == nil {
@@ -227,6 +287,12 @@ func (crr *ClientRegistrationRequest) Validate() error {
 		switch crr.RawTokenEndpointAuthMethod {
 		case oidc.AuthMethodClientSecretBasic:
 			// breaks
+		case oidc.AuthMethodClientSecretPost:
+			// breaks
+		case oidc.AuthMethodPrivateKeyJWT:
+			if crr.JWKS == nil {
+				return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "private_key_jwt requires jwks")
+			}
 		case oidc.AuthMethodNone:
 			// breaks
 		default:
@@ -240,6 +306,47 @@ func (crr *ClientRegistrationRequest) Validate() error {
 		}
 	}
 
+	var err error
+	crr.RawIDTokenEncryptedResponseEnc, err = validateEncryptedResponse("id_token", crr.RawIDTokenEncryptedResponseAlg, crr.RawIDTokenEncryptedResponseEnc, crr.JWKS != nil)
+	if err != nil {
+		return err
+	}
+	crr.RawUserInfoEncryptedResponseEnc, err = validateEncryptedResponse("userinfo", crr.RawUserInfoEncryptedResponseAlg, crr.RawUserInfoEncryptedResponseEnc, crr.JWKS != nil)
+	if err != nil {
+		return err
+	}
+
+	switch crr.SubjectType {
+	case "":
+		// breaks
+	case oidc.SubjectIDPublic:
+		// breaks
+	case konnectoidc.SubjectIDPairwise:
+		// breaks
+	default:
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported subject_type")
+	}
+	if crr.SectorIdentifierURI != "" {
+		uri, err := url.Parse(crr.SectorIdentifierURI)
+		if err != nil || uri.Scheme != "https" || uri.Host == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "sector_identifier_uri must be an absolute https URI")
+		}
+	} else if crr.SubjectType == konnectoidc.SubjectIDPairwise {
+		// Without sector identifier URI, the host of the redirect_uris is used
+		// as sector identifier. See https://openid.net/specs/openid-connect-core-1_0.html#PairwiseAlg
+		var host string
+		for _, uriString := range crr.RedirectURIs {
+			uri, err := url.Parse(uriString)
+			if err != nil {
+				return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidRedirectURI, "failed to parse redirect_uris")
+			}
+			if host != "" && uri.Host != host {
+				return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "sector_identifier_uri required for redirect_uris with multiple hosts")
+			}
+			host = uri.Host
+		}
+	}
+
 	for _, uriString := range crr.PostLogoutRedirectURIs {
 		_, err := url.Parse(uriString)
 		if err != nil {
@@ -251,8 +358,10 @@ func (crr *ClientRegistrationRequest) Validate() error {
 		if len(crr.JWKS.Keys) == 0 {
 			crr.JWKS = nil
 		} else {
+			// Keys with unset use can be used for both signing and
+			// encryption, so use is required when both kinds are present.
 			enc := false
-			empty := true
+			empty := false
 			for _, key := range crr.JWKS.Keys {
 				switch key.Use {
 				case "":
@@ -260,7 +369,6 @@ func (crr *ClientRegistrationRequest) Validate() error {
 						return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "jwks includes enc key and unset use key")
 					}
 					empty = true
-					key.Use = "sig"
 				case "enc":
 					enc = true
 					if empty {
@@ -274,6 +382,40 @@ func (crr *ClientRegistrationRequest) Validate() error {
 	return nil
 }
 
+// validateEncryptedResponse validates the provided encrypted response alg and
+// enc values for the provided response and returns the enc value to use.
+func validateEncryptedResponse(response string, alg string, enc string, withKeys bool) (string, error) {
+	if alg == "" {
+		if enc != "" {
+			return "", konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, response+"_encrypted_response_enc requires "+response+"_encrypted_response_alg")
+		}
+		return enc, nil
+	}
+	if !containsString(konnectoidc.EncryptionAlgValuesSupported, alg) {
+		return "", konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported "+response+"_encrypted_response_alg")
+	}
+	if enc == "" {
+		enc = konnectoidc.DefaultEncryptionEnc
+	}
+	if !containsString(konnectoidc.EncryptionEncValuesSupported, enc) {
+		return "", konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported "+response+"_encrypted_response_enc")
+	}
+	if !withKeys {
+		return "", konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, response+"_encrypted_response_alg requires jwks")
+	}
+
+	return enc, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // ClientRegistration returns new dynamic client registration data for the
 // accociated client registration request.
 func (crr *ClientRegistrationRequest) ClientRegistration() (*clients.ClientRegistration, error) {
@@ -283,16 +425,27 @@ func (crr *ClientRegistrationRequest) ClientRegistration() (*clients.ClientRegis
 		URI:             crr.ClientURI,
 		GrantTypes:      crr.GrantTypes,
 		ApplicationType: crr.ApplicationType,
+		ResponseTypes:   crr.ResponseTypes,
+		Scopes:          strings.Fields(crr.Scope),
 
 		RedirectURIs: crr.RedirectURIs,
 
 		JWKS: crr.JWKS,
 
-		RawIDTokenSignedResponseAlg:    crr.RawIDTokenSignedResponseAlg,
-		RawUserInfoSignedResponseAlg:   crr.RawUserInfoSignedResponseAlg,
-		RawRequestObjectSigningAlg:     crr.RawRequestObjectSigningAlg,
-		RawTokenEndpointAuthMethod:     crr.RawTokenEndpointAuthMethod,
-		RawTokenEndpointAuthSigningAlg: crr.RawTokenEndpointAuthSigningAlg,
+		RawIDTokenSignedResponseAlg:       crr.RawIDTokenSignedResponseAlg,
+		RawUserInfoSignedResponseAlg:      crr.RawUserInfoSignedResponseAlg,
+		RawAuthorizationSignedResponseAlg: crr.RawAuthorizationSignedResponseAlg,
+		RawRequestObjectSigningAlg:        crr.RawRequestObjectSigningAlg,
+		RawTokenEndpointAuthMethod:        crr.RawTokenEndpointAuthMethod,
+		RawTokenEndpointAuthSigningAlg:    crr.RawTokenEndpointAuthSigningAlg,
+
+		RawIDTokenEncryptedResponseAlg:  crr.RawIDTokenEncryptedResponseAlg,
+		RawIDTokenEncryptedResponseEnc:  crr.RawIDTokenEncryptedResponseEnc,
+		RawUserInfoEncryptedResponseAlg: crr.RawUserInfoEncryptedResponseAlg,
+		RawUserInfoEncryptedResponseEnc: crr.RawUserInfoEncryptedResponseEnc,
+
+		SubjectType:         crr.SubjectType,
+		SectorIdentifierURI: crr.SectorIdentifierURI,
 
 		PostLogoutRedirectURIs: crr.PostLogoutRedirectURIs,
 	}
@@ -300,6 +453,47 @@ func (crr *ClientRegistrationRequest) ClientRegistration() (*clients.ClientRegis
 	return cr, nil
 }
 
+// NewClientRegistrationRequest returns client registration request data for
+// the provided client registration, as used to respond to client read and
+// update requests.
+func NewClientRegistrationRequest(cr *clients.ClientRegistration) *ClientRegistrationRequest {
+	crr := &ClientRegistrationRequest{
+		RedirectURIs:    cr.RedirectURIs,
+		ResponseTypes:   cr.ResponseTypes,
+		GrantTypes:      cr.GrantTypes,
+		ApplicationType: cr.ApplicationType,
+
+		Contacts:   cr.Contacts,
+		ClientName: cr.Name,
+		ClientURI:  cr.URI,
+		Scope:      strings.Join(cr.Scopes, " "),
+
+		RawIDTokenSignedResponseAlg:       cr.RawIDTokenSignedResponseAlg,
+		RawUserInfoSignedResponseAlg:      cr.RawUserInfoSignedResponseAlg,
+		RawAuthorizationSignedResponseAlg: cr.RawAuthorizationSignedResponseAlg,
+		RawRequestObjectSigningAlg:        cr.RawRequestObjectSigningAlg,
+		RawTokenEndpointAuthMethod:        cr.RawTokenEndpointAuthMethod,
+		RawTokenEndpointAuthSigningAlg:    cr.RawTokenEndpointAuthSigningAlg,
+
+		RawIDTokenEncryptedResponseAlg:  cr.RawIDTokenEncryptedResponseAlg,
+		RawIDTokenEncryptedResponseEnc:  cr.RawIDTokenEncryptedResponseEnc,
+		RawUserInfoEncryptedResponseAlg: cr.RawUserInfoEncryptedResponseAlg,
+		RawUserInfoEncryptedResponseEnc: cr.RawUserInfoEncryptedResponseEnc,
+
+		SubjectType:         cr.SubjectType,
+		SectorIdentifierURI: cr.SectorIdentifierURI,
+
+		PostLogoutRedirectURIs: cr.PostLogoutRedirectURIs,
+
+		JWKS: cr.JWKS,
+	}
+	if cr.JWKS != nil {
+		crr.RawJWKS, _ = gojwk.Marshal(cr.JWKS)
+	}
+
+	return crr
+}
+
 // ClientRegistrationResponse holds the outgoing data for a successful OpenID
 // Connect Dynamic Client Registration 1.0 clientregistration request as
 // specified at https://openid.net/specs/openid-connect-registration-1_0.html#RegistrationResponse
@@ -310,6 +504,9 @@ type ClientRegistrationResponse struct {
 	ClientIDIssuedAt      int64 `json:"client_id_issued_at,omitempty"`
 	ClientSecretExpiresAt int64 `json:"client_secret_expires_at"`
 
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+
 	// Include validated request data.
 	ClientRegistrationRequest
 }
@@ -43,12 +43,15 @@ type RequestObjectClaims struct {
 	RawPrompt       string         `json:"prompt"`
 	RawIDTokenHint  string         `json:"id_token_hint"`
 	RawMaxAge       string         `json:"max_age"`
+	RawACRValues    string         `json:"acr_values"`
 
 	RawRegistration string `json:"registration"`
 
 	CodeChallenge       string `json:"code_challenge"`
 	CodeChallengeMethod string `json:"code_challenge_method"`
 
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
+
 	client *clients.Secured
 }
 
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package payload
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/libregraph/oidc-go"
+)
+
+// RevocationRequest holds the incoming parameters and request data for the
+// OAuth 2.0 token revocation endpoint as specified at
+// https://tools.ietf.org/html/rfc7009#section-2.1
+type RevocationRequest struct {
+	providerMetadata *oidc.WellKnown
+
+	Token         string `schema:"token"`
+	TokenTypeHint string `schema:"token_type_hint"`
+
+	ClientID     string `schema:"client_id"`
+	ClientSecret string `schema:"client_secret"`
+
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+}
+
+// DecodeRevocationRequest returns a RevocationRequest holding the provided
+// request's form data.
+func DecodeRevocationRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*RevocationRequest, error) {
+	rr, err := NewRevocationRequest(req.PostForm, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	rr.ClientID, rr.ClientSecret, err = decodeClientCredentials(req, rr.ClientID, rr.ClientSecret, rr.ClientAssertionType, rr.ClientAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// NewRevocationRequest returns a RevocationRequest holding the provided url
+// values.
+func NewRevocationRequest(values url.Values, providerMetadata *oidc.WellKnown) (*RevocationRequest, error) {
+	rr := &RevocationRequest{
+		providerMetadata: providerMetadata,
+	}
+
+	err := DecodeSchema(rr, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
@@ -27,4 +27,20 @@ type Session struct {
 	ID       string
 	Sub      string
 	Provider string
+
+	// Clients holds the IDs of the clients which received tokens in the
+	// session and need to be notified when the session ends.
+	Clients []string
+}
+
+// AddClient adds the provided client ID to the accociated session's clients
+// and returns true if it was not already found.
+func (s *Session) AddClient(clientID string) bool {
+	for _, existing := range s.Clients {
+		if existing == clientID {
+			return false
+		}
+	}
+	s.Clients = append(s.Clients, clientID)
+	return true
 }
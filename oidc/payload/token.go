@@ -18,7 +18,6 @@
 package payload
 
 import (
-	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -38,6 +37,7 @@ type TokenRequest struct {
 
 	GrantType       string `schema:"grant_type"`
 	Code            string `schema:"code"`
+	DeviceCode      string `schema:"device_code"`
 	RawRedirectURI  string `schema:"redirect_uri"`
 	RawRefreshToken string `schema:"refresh_token"`
 	RawScope        string `schema:"scope"`
@@ -45,8 +45,22 @@ type TokenRequest struct {
 	ClientID     string `schema:"client_id"`
 	ClientSecret string `schema:"client_secret"`
 
+	ClientAssertion     string `schema:"client_assertion"`
+	ClientAssertionType string `schema:"client_assertion_type"`
+
 	CodeVerifier string `schema:"code_verifier"`
 
+	RawSubjectToken    string `schema:"subject_token"`
+	SubjectTokenType   string `schema:"subject_token_type"`
+	RawActorToken      string `schema:"actor_token"`
+	ActorTokenType     string `schema:"actor_token_type"`
+	RequestedTokenType string `schema:"requested_token_type"`
+	Audience           string `schema:"audience"`
+
+	Assertion string `schema:"assertion"`
+
+	Resources []string `schema:"resource"`
+
 	RedirectURI  *url.URL        `schema:"-"`
 	RefreshToken *jwt.Token      `schema:"-"`
 	Scopes       map[string]bool `schema:"-"`
@@ -60,45 +74,9 @@ func DecodeTokenRequest(req *http.Request, providerMetadata *oidc.WellKnown) (*T
 		return nil, err
 	}
 
-	var clientID string
-	var clientSecret string
-
-	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
-	switch auth[0] {
-	case "Basic":
-		// Support client_secret_basic authentication method.
-		if len(auth) != 2 {
-			return nil, fmt.Errorf("invalid Basic authorization header format")
-		}
-		var basic []byte
-		if basic, err = base64.StdEncoding.DecodeString(auth[1]); err != nil {
-			return nil, fmt.Errorf("invalid Basic authorization value: %w", err)
-		}
-		// Decode username as client ID and password as client secret. See
-		// https://tools.ietf.org/html/rfc6749#section-2.3.1 for details.
-		check := strings.SplitN(string(basic), ":", 2)
-		if len(check) == 2 {
-			// Data is encoded application/x-www-form-urlencoded UTF-8. See
-			// https://tools.ietf.org/html/rfc6749#appendix-B for details.
-			if clientID, err = url.QueryUnescape(check[0]); err == nil {
-				clientSecret, _ = url.QueryUnescape(check[1])
-			}
-		}
-	}
-
-	if tr.ClientID == "" {
-		if clientID == "" {
-			return nil, fmt.Errorf("client_id is missing")
-		}
-		// Use client ID and secret if no client_id was passed to the request directly.
-		tr.ClientID = clientID
-		tr.ClientSecret = clientSecret
-	} else if clientID != "" {
-		if tr.ClientID == clientID {
-			// Update the client secret, if the ID is a match. This replaces
-			// a directly given secret.
-			tr.ClientSecret = clientSecret
-		}
+	tr.ClientID, tr.ClientSecret, err = decodeClientCredentials(req, tr.ClientID, tr.ClientSecret, tr.ClientAssertionType, tr.ClientAssertion)
+	if err != nil {
+		return nil, err
 	}
 
 	return tr, err
@@ -149,6 +127,40 @@ func (tr *TokenRequest) Validate(keyFunc jwt.Keyfunc, claims jwt.Claims) error {
 		}
 		// breaks
 
+	case konnectoidc.GrantTypeClientCredentials:
+		// breaks
+
+	case konnectoidc.GrantTypeDeviceCode:
+		if tr.DeviceCode == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing device_code")
+		}
+		// breaks
+
+	case konnectoidc.GrantTypeTokenExchange:
+		// Token exchange request as specified at https://tools.ietf.org/html/rfc8693#section-2.1
+		if tr.RawSubjectToken == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing subject_token")
+		}
+		if !isSupportedTokenTypeIdentifier(tr.SubjectTokenType) {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "unsupported subject_token_type")
+		}
+		if tr.RawActorToken != "" && !isSupportedTokenTypeIdentifier(tr.ActorTokenType) {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "unsupported actor_token_type")
+		}
+		if tr.RawActorToken == "" && tr.ActorTokenType != "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "actor_token_type without actor_token")
+		}
+		if tr.RequestedTokenType != "" && tr.RequestedTokenType != konnectoidc.TokenTypeIdentifierAccessToken {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "unsupported requested_token_type")
+		}
+		// breaks
+
+	case konnectoidc.GrantTypeJWTBearer:
+		if tr.Assertion == "" {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing assertion")
+		}
+		// breaks
+
 	default:
 		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2UnsupportedGrantType, "unsupported grant_type value")
 	}
@@ -156,6 +168,16 @@ func (tr *TokenRequest) Validate(keyFunc jwt.Keyfunc, claims jwt.Claims) error {
 	return nil
 }
 
+func isSupportedTokenTypeIdentifier(tokenType string) bool {
+	switch tokenType {
+	case konnectoidc.TokenTypeIdentifierAccessToken:
+		return true
+	case konnectoidc.TokenTypeIdentifierJWT:
+		return true
+	}
+	return false
+}
+
 // TokenSuccess holds the outgoing data for a successful OpenID
 // Connect 1.0 token request as specified at
 // http://openid.net/specs/openid-connect-core-1_0.html#TokenResponse.
@@ -165,4 +187,9 @@ type TokenSuccess struct {
 	IDToken      string `json:"id_token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	ExpiresIn    int64  `json:"expires_in,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
 }
@@ -18,7 +18,16 @@
 package payload
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	konnectoidc "github.com/libregraph/lico/oidc"
 )
 
 // ToMap is a helper function to convert the provided payload struct to
@@ -38,3 +47,90 @@ func ToMap(payload interface{}) (map[string]interface{}, error) {
 
 	return claims, nil
 }
+
+// decodeClientAuthentication returns the client ID and client secret of the
+// provided request, taking into account the provided values which were passed
+// to the request directly.
+func decodeClientAuthentication(req *http.Request, requestClientID string, requestClientSecret string) (string, string, error) {
+	var clientID string
+	var clientSecret string
+
+	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	switch auth[0] {
+	case "Basic":
+		// Support client_secret_basic authentication method.
+		if len(auth) != 2 {
+			return "", "", fmt.Errorf("invalid Basic authorization header format")
+		}
+		basic, err := base64.StdEncoding.DecodeString(auth[1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid Basic authorization value: %w", err)
+		}
+		// Decode username as client ID and password as client secret. See
+		// https://tools.ietf.org/html/rfc6749#section-2.3.1 for details.
+		check := strings.SplitN(string(basic), ":", 2)
+		if len(check) == 2 {
+			// Data is encoded application/x-www-form-urlencoded UTF-8. See
+			// https://tools.ietf.org/html/rfc6749#appendix-B for details.
+			if clientID, err = url.QueryUnescape(check[0]); err == nil {
+				clientSecret, _ = url.QueryUnescape(check[1])
+			}
+		}
+	}
+
+	if requestClientID == "" {
+		if clientID == "" {
+			return "", "", fmt.Errorf("client_id is missing")
+		}
+		// Use client ID and secret if no client_id was passed to the request directly.
+		return clientID, clientSecret, nil
+	} else if clientID != "" {
+		if requestClientID == clientID {
+			// Update the client secret, if the ID is a match. This replaces
+			// a directly given secret.
+			return requestClientID, clientSecret, nil
+		}
+	}
+
+	return requestClientID, requestClientSecret, nil
+}
+
+// decodeClientCredentials returns the client ID and client secret of the
+// provided request like decodeClientAuthentication or the client ID of the
+// provided client assertion if any. Client assertions replace all other
+// client credentials and are used with the client_secret_jwt and
+// private_key_jwt authentication methods.
+func decodeClientCredentials(req *http.Request, requestClientID string, requestClientSecret string, clientAssertionType string, clientAssertion string) (string, string, error) {
+	if clientAssertion != "" || clientAssertionType != "" {
+		clientID, err := decodeClientAssertion(clientAssertionType, clientAssertion, requestClientID)
+		return clientID, "", err
+	}
+
+	return decodeClientAuthentication(req, requestClientID, requestClientSecret)
+}
+
+// decodeClientAssertion returns the client ID of the provided client
+// assertion as specified at https://tools.ietf.org/html/rfc7523#section-2.2,
+// taking into account the provided client_id which was passed to the request
+// directly. The assertion is not validated.
+func decodeClientAssertion(clientAssertionType string, clientAssertion string, requestClientID string) (string, error) {
+	if clientAssertionType != konnectoidc.ClientAssertionTypeJWTBearer {
+		return "", fmt.Errorf("unsupported client_assertion_type")
+	}
+	if clientAssertion == "" {
+		return "", fmt.Errorf("client_assertion is missing")
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(clientAssertion, claims); err != nil {
+		return "", fmt.Errorf("invalid client_assertion: %w", err)
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("client_assertion sub is missing")
+	}
+	if requestClientID != "" && requestClientID != claims.Subject {
+		return "", fmt.Errorf("client_assertion sub does not match client_id")
+	}
+
+	return claims.Subject, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/oidc/payload"
+)
+
+// validateAuthorizationDetails checks that all the provided authorization
+// details objects are of a registered type which the client identified by
+// the provided ID is allowed to request, and that they comply to the schema
+// registered for their type as specified at
+// https://datatracker.ietf.org/doc/html/rfc9396#section-5
+func (p *Provider) validateAuthorizationDetails(ctx context.Context, clientID string, authorizationDetails payload.AuthorizationDetails) error {
+	if len(authorizationDetails) == 0 {
+		return nil
+	}
+
+	registration, _ := p.clients.Get(ctx, clientID)
+	for _, ad := range authorizationDetails {
+		detailsType := ad.Type()
+		typeRegistration, ok := p.clients.GetAuthorizationDetailsType(ctx, detailsType)
+		if !ok {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails, fmt.Sprintf("unknown authorization_details type: %s", detailsType))
+		}
+		if registration != nil && !registration.AllowsAuthorizationDetailsType(detailsType) {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails, fmt.Sprintf("authorization_details type not allowed for client: %s", detailsType))
+		}
+		if err := typeRegistration.Validate(ad); err != nil {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails, err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
+	"github.com/longsleep/rndm"
+
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/oidc/payload"
+	"github.com/libregraph/lico/utils"
+)
+
+const (
+	backchannelLogoutTimeout    = 5 * time.Second
+	backchannelLogoutRetries    = 3
+	backchannelLogoutRetryDelay = 1 * time.Second
+
+	logoutTokenDuration       = 2 * time.Minute
+	endedSessionCacheDuration = 1 * time.Hour
+)
+
+// endSession notifies the clients of the provided session that the session has
+// ended. Notifications are sent in the background and only once per session.
+func (p *Provider) endSession(ctx context.Context, session *payload.Session) {
+	if session == nil || len(session.Clients) == 0 {
+		return
+	}
+	if added, err := p.endedSessionsCache.Add(session.ID, time.Now().Add(endedSessionCacheDuration)); err != nil {
+		// Notify anyway, clients must handle repeated logout tokens.
+		p.logger.WithError(err).Warnln("failed to remember ended session")
+	} else if !added {
+		// Already ended.
+		return
+	}
+
+	for _, clientID := range session.Clients {
+		registration, _ := p.clients.Get(ctx, clientID)
+		if registration == nil || registration.BackchannelLogoutURI == "" {
+			continue
+		}
+
+		logoutToken, err := p.makeLogoutToken(ctx, registration, session)
+		if err != nil {
+			p.logger.WithError(err).WithField("client_id", clientID).Errorln("failed to create logout token")
+			continue
+		}
+
+		go func(clientID string, uri string) {
+			if sendErr := p.sendBackchannelLogout(uri, logoutToken); sendErr != nil {
+				p.logger.WithFields(utils.ErrorAsFields(sendErr)).WithField("client_id", clientID).Warnln("backchannel logout failed")
+			}
+		}(clientID, registration.BackchannelLogoutURI)
+	}
+}
+
+// makeLogoutToken returns a signed Logout Token for the provided client
+// registration and session as specified at
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+func (p *Provider) makeLogoutToken(ctx context.Context, registration *clients.ClientRegistration, session *payload.Session) (string, error) {
+	var signingMethod jwt.SigningMethod
+	if registration.RawIDTokenSignedResponseAlg != "" {
+		signingMethod = jwt.GetSigningMethod(registration.RawIDTokenSignedResponseAlg)
+	}
+	sk, ok := p.getSigningKey(signingMethod)
+	if !ok {
+		return "", fmt.Errorf("no signing key")
+	}
+
+	sub := session.Sub
+	if registration.UsesPairwiseSubject() {
+		var err error
+		sub, err = p.makePairwiseSubject(registration.SectorIdentifier(), sub)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	logoutTokenClaims := &konnectoidc.LogoutTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    p.issuerIdentifier,
+			Subject:   sub,
+			Audience:  registration.ID,
+			ExpiresAt: time.Now().Add(logoutTokenDuration).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        rndm.GenerateRandomString(24),
+		},
+		Events: map[string]interface{}{
+			konnectoidc.BackChannelLogoutEvent: map[string]interface{}{},
+		},
+		SessionClaims: &konnectoidc.SessionClaims{
+			SessionID: session.ID,
+		},
+	}
+
+	logoutToken := jwt.NewWithClaims(sk.SigningMethod, logoutTokenClaims)
+	logoutToken.Header[oidc.JWTHeaderKeyID] = sk.ID
+	logoutToken.Header[konnectoidc.JWTHeaderType] = konnectoidc.LogoutTokenType
+
+	return logoutToken.SignedString(sk.PrivateKey)
+}
+
+// sendBackchannelLogout sends the provided logout token to the provided
+// backchannel logout URI, retrying with increasing delay on temporary errors.
+func (p *Provider) sendBackchannelLogout(uri string, logoutToken string) error {
+	delay := backchannelLogoutRetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := p.postLogoutToken(uri, logoutToken)
+		if err == nil || !retry || attempt >= backchannelLogoutRetries {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postLogoutToken sends the provided logout token to the provided backchannel
+// logout URI as specified at https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRequest
+// and returns if the request should be retried on error.
+func (p *Provider) postLogoutToken(uri string, logoutToken string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backchannelLogoutTimeout)
+	defer cancel()
+
+	values := url.Values{}
+	values.Set("logout_token", logoutToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(values.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", utils.DefaultHTTPUserAgent)
+
+	response, err := p.backchannelLogoutClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusOK, response.StatusCode == http.StatusNoContent:
+		return false, nil
+	case response.StatusCode == http.StatusTooManyRequests, response.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("unexpected response status: %d", response.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected response status: %d", response.StatusCode)
+	}
+}
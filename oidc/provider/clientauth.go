@@ -0,0 +1,190 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package provider
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
+
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/signing"
+)
+
+const (
+	clientAssertionMaxLifetime  = 5 * time.Minute
+	clientAssertionMaxClockSkew = 30 * time.Second
+)
+
+// clientAssertionSigningAlgValuesSupported lists the JWS algorithms accepted
+// for client assertions.
+var clientAssertionSigningAlgValuesSupported = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodHS384.Alg(),
+	jwt.SigningMethodHS512.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodPS384.Alg(),
+	jwt.SigningMethodPS512.Alg(),
+	signing.SigningMethodEdDSA.Alg(),
+}
+
+// authenticateClient authenticates the provided client with the provided
+// credentials of the provided request, ensuring that the registered
+// authentication method of the client is used. Returns the client certificate
+// for mutual TLS clients. Secrets must be validated before when looking up the
+// client.
+func (p *Provider) authenticateClient(req *http.Request, clientSecret string, clientAssertion string, clientDetails *clients.Details) (*x509.Certificate, error) {
+	var authMethod string
+	var err error
+
+	switch {
+	case clientAssertion != "":
+		authMethod, err = p.authenticateClientAssertion(clientAssertion, clientDetails)
+		if err != nil {
+			return nil, err
+		}
+	case clientSecret == "":
+		authMethod = oidc.AuthMethodNone
+	default:
+		if _, _, ok := req.BasicAuth(); ok {
+			authMethod = oidc.AuthMethodClientSecretBasic
+		} else {
+			authMethod = oidc.AuthMethodClientSecretPost
+		}
+	}
+
+	clientCertificate, err := p.authenticateTLSClient(req, clientDetails)
+	if err != nil {
+		return nil, err
+	}
+	if clientCertificate != nil {
+		authMethod = clientDetails.Registration.RawTokenEndpointAuthMethod
+	}
+
+	err = validateTokenEndpointAuthMethod(clientDetails, authMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientCertificate, nil
+}
+
+// authenticateClientAssertion validates the provided client assertion of the
+// provided client as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+// and returns the used authentication method. HMAC assertions are validated
+// with the client secret, all others with the registered keys of the client.
+func (p *Provider) authenticateClientAssertion(clientAssertion string, clientDetails *clients.Details) (string, error) {
+	if clientDetails == nil || clientDetails.Registration == nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion requires a registered client")
+	}
+	registration := clientDetails.Registration
+
+	var authMethod string
+	claims := &jwt.RegisteredClaims{}
+	parser := &jwt.Parser{
+		ValidMethods: clientAssertionSigningAlgValuesSupported,
+	}
+	_, err := parser.ParseWithClaims(clientAssertion, claims, func(token *jwt.Token) (interface{}, error) {
+		if registration.RawTokenEndpointAuthSigningAlg != "" && token.Method.Alg() != registration.RawTokenEndpointAuthSigningAlg {
+			return nil, fmt.Errorf("unexpected alg")
+		}
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			authMethod = oidc.AuthMethodClientSecretJWT
+			// Dynamic clients only have a hash of their secret.
+			if registration.Dynamic || registration.Secret == "" {
+				return nil, fmt.Errorf("client_secret_jwt requires a client secret")
+			}
+			return []byte(registration.Secret), nil
+		default:
+			authMethod = oidc.AuthMethodPrivateKeyJWT
+			if registration.JWKS == nil {
+				return nil, fmt.Errorf("private_key_jwt requires registered keys")
+			}
+			secured, securedErr := registration.Secure(token.Header[oidc.JWTHeaderKeyID])
+			if securedErr != nil {
+				return nil, securedErr
+			}
+			return secured.PublicKey, nil
+		}
+	})
+	if err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+	}
+
+	if claims.Issuer != clientDetails.ID || claims.Subject != clientDetails.ID {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion iss and sub must be the client_id")
+	}
+	if !claims.VerifyAudience(p.makeIssURL(p.tokenPath), true) && !claims.VerifyAudience(p.issuerIdentifier, true) {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion aud mismatch")
+	}
+	if claims.ExpiresAt == nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion exp is missing")
+	}
+	// Assertions must be short lived, since their jti is remembered until
+	// they expire. Parsing already rejects iat and nbf values in the future.
+	if claims.ExpiresAt.Time.After(time.Now().Add(clientAssertionMaxLifetime + clientAssertionMaxClockSkew)) {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion exp is too far in the future")
+	}
+	if claims.IssuedAt != nil && claims.ExpiresAt.Time.Sub(claims.IssuedAt.Time) > clientAssertionMaxLifetime {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion lifetime is too long")
+	}
+	if claims.ID == "" {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion jti is missing")
+	}
+	if added, addErr := p.clientAssertionReplayCache.Add(clientDetails.ID+":"+claims.ID, claims.ExpiresAt.Time); addErr != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion cannot be checked for replay: "+addErr.Error())
+	} else if !added {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client_assertion has been used before")
+	}
+
+	return authMethod, nil
+}
+
+// validateTokenEndpointAuthMethod ensures that the provided client used its
+// registered token endpoint authentication method. Clients without registered
+// method can use any method and the secret methods are interchangeable.
+func validateTokenEndpointAuthMethod(clientDetails *clients.Details, authMethod string) error {
+	if clientDetails == nil || clientDetails.Registration == nil || clientDetails.Registration.RawTokenEndpointAuthMethod == "" {
+		return nil
+	}
+
+	switch clientDetails.Registration.RawTokenEndpointAuthMethod {
+	case oidc.AuthMethodClientSecretBasic, oidc.AuthMethodClientSecretPost:
+		if authMethod == oidc.AuthMethodClientSecretBasic || authMethod == oidc.AuthMethodClientSecretPost {
+			return nil
+		}
+	default:
+		if authMethod == clientDetails.Registration.RawTokenEndpointAuthMethod {
+			return nil
+		}
+	}
+
+	return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, fmt.Sprintf("client must authenticate with %s", clientDetails.Registration.RawTokenEndpointAuthMethod))
+}
@@ -30,6 +30,7 @@ type Config struct {
 
 	IssuerIdentifier       string
 	WellKnownPath          string
+	MetadataPath           string
 	JwksPath               string
 	AuthorizationPath      string
 	TokenPath              string
@@ -38,6 +39,13 @@ type Config struct {
 	CheckSessionIframePath string
 	RegistrationPath       string
 
+	DeviceAuthorizationPath string
+	DeviceVerificationPath  string
+	IntrospectionPath       string
+	RevocationPath          string
+
+	PushedAuthorizationRequestPath string
+
 	BrowserStateCookiePath     string
 	BrowserStateCookieName     string
 	BrowserStateCookieSameSite http.SameSite
@@ -49,4 +57,8 @@ type Config struct {
 	AccessTokenDuration  time.Duration
 	IDTokenDuration      time.Duration
 	RefreshTokenDuration time.Duration
+
+	PairwiseSubjectSecret []byte
+
+	SignedMetadata bool
 }
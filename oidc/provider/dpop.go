@@ -0,0 +1,161 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package provider
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v4"
+
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/signing"
+)
+
+const (
+	dpopProofMaxAge       = 5 * time.Minute
+	dpopProofMaxClockSkew = 30 * time.Second
+)
+
+// dpopSigningAlgValuesSupported lists the asymmetric JWS algorithms accepted
+// for DPoP proofs.
+var dpopSigningAlgValuesSupported = []string{
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodPS384.Alg(),
+	jwt.SigningMethodPS512.Alg(),
+	signing.SigningMethodEdDSA.Alg(),
+}
+
+// dpopProofClaims define the claims of a DPoP proof JWT as specified at
+// https://datatracker.ietf.org/doc/html/rfc9449#section-4.2
+type dpopProofClaims struct {
+	jwt.StandardClaims
+
+	HTTPMethod      string `json:"htm"`
+	HTTPURI         string `json:"htu"`
+	AccessTokenHash string `json:"ath,omitempty"`
+}
+
+// Valid implements the jwt.Claims interface.
+func (c dpopProofClaims) Valid() error {
+	if c.Id == "" {
+		return errors.New("missing jti")
+	}
+	if c.IssuedAt == 0 {
+		return errors.New("missing iat")
+	}
+	now := time.Now()
+	iat := time.Unix(c.IssuedAt, 0)
+	if iat.After(now.Add(dpopProofMaxClockSkew)) {
+		return errors.New("iat is in the future")
+	}
+	if now.Sub(iat) > dpopProofMaxAge {
+		return errors.New("proof is too old")
+	}
+
+	return nil
+}
+
+// validateDPoPProof validates the DPoP proof of the provided request for the
+// provided endpoint path as specified at
+// https://datatracker.ietf.org/doc/html/rfc9449#section-4.3 and returns the
+// base64url encoded SHA-256 JWK thumbprint of the key used to sign the proof.
+// If an access token is provided, the proof must be bound to it.
+func (p *Provider) validateDPoPProof(req *http.Request, path string, accessToken string) (string, error) {
+	values := req.Header.Values(konnectoidc.DPoPHeader)
+	if len(values) != 1 {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "exactly one DPoP header is required")
+	}
+
+	var jwk jose.JSONWebKey
+	claims := &dpopProofClaims{}
+	parser := &jwt.Parser{
+		ValidMethods: dpopSigningAlgValuesSupported,
+	}
+	_, err := parser.ParseWithClaims(values[0], claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header[konnectoidc.JWTHeaderType].(string); typ != konnectoidc.DPoPProofType {
+			return nil, fmt.Errorf("invalid typ header")
+		}
+		rawJWK, ok := token.Header[konnectoidc.JWTHeaderJWK]
+		if !ok {
+			return nil, fmt.Errorf("missing jwk header")
+		}
+		jwkBytes, jwkErr := json.Marshal(rawJWK)
+		if jwkErr != nil {
+			return nil, jwkErr
+		}
+		if jwkErr = jwk.UnmarshalJSON(jwkBytes); jwkErr != nil {
+			return nil, fmt.Errorf("invalid jwk header: %w", jwkErr)
+		}
+		if !jwk.Valid() || !jwk.IsPublic() {
+			return nil, fmt.Errorf("jwk header must be a public key")
+		}
+		return jwk.Key, nil
+	})
+	if err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, err.Error())
+	}
+
+	if claims.HTTPMethod != req.Method {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "htm mismatch")
+	}
+	htu, err := url.Parse(claims.HTTPURI)
+	if err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "invalid htu")
+	}
+	htu.RawQuery = ""
+	htu.Fragment = ""
+	if htu.String() != p.makeIssURL(path) {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "htu mismatch")
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.AccessTokenHash != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "ath mismatch")
+		}
+	}
+
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, err.Error())
+	}
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	// Reject replayed proofs, see
+	// https://datatracker.ietf.org/doc/html/rfc9449#section-11.1
+	if added, addErr := p.dpopReplayCache.Add(jkt+":"+claims.Id, time.Unix(claims.IssuedAt, 0).Add(dpopProofMaxAge)); addErr != nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, addErr.Error())
+	} else if !added {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "proof has been used before")
+	}
+
+	return jkt, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/longsleep/rndm"
+
+	"github.com/libregraph/lico/oidc/payload"
+)
+
+const (
+	frontchannelLogoutTimeout = 5 * time.Second
+)
+
+// makeFrontchannelLogoutURIs returns the front-channel logout URIs of the
+// clients of the provided session including the iss and sid parameters as
+// specified at https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPLogout
+func (p *Provider) makeFrontchannelLogoutURIs(ctx context.Context, session *payload.Session) []*url.URL {
+	if session == nil {
+		return nil
+	}
+
+	var uris []*url.URL
+	for _, clientID := range session.Clients {
+		registration, _ := p.clients.Get(ctx, clientID)
+		if registration == nil || registration.FrontchannelLogoutURI == "" {
+			continue
+		}
+
+		uri, err := url.Parse(registration.FrontchannelLogoutURI)
+		if err != nil {
+			p.logger.WithError(err).WithField("client_id", clientID).Warnln("invalid frontchannel logout uri")
+			continue
+		}
+		query := uri.Query()
+		query.Set("iss", p.issuerIdentifier)
+		query.Set("sid", session.ID)
+		uri.RawQuery = query.Encode()
+
+		uris = append(uris, uri)
+	}
+
+	return uris
+}
+
+// FrontchannelLogout writes a HTML page to the provided ResponseWriter which
+// loads the provided front-channel logout URIs in hidden iframes and redirects
+// to the provided uri once they have loaded, as specified at
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html#OPLogout
+func (p *Provider) FrontchannelLogout(rw http.ResponseWriter, uris []*url.URL, uri *url.URL) {
+	nonce := rndm.GenerateRandomString(32)
+
+	frameSources := make([]string, 0, len(uris))
+	frameURIs := make([]string, 0, len(uris))
+	for _, frameURI := range uris {
+		frameSources = append(frameSources, frameURI.Scheme+"://"+frameURI.Host)
+		frameURIs = append(frameURIs, frameURI.String())
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	rw.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; script-src 'nonce-%s'; frame-src %s", nonce, strings.Join(frameSources, " ")))
+
+	data := struct {
+		URIs        []string
+		RedirectURI template.URL
+		Timeout     int64
+		Nonce       string
+	}{
+		URIs:    frameURIs,
+		Timeout: frontchannelLogoutTimeout.Milliseconds(),
+		Nonce:   nonce,
+	}
+	if uri != nil {
+		// The uri is a validated post logout redirect URI, so it is safe to
+		// use it even when it has a custom scheme.
+		data.RedirectURI = template.URL(uri.String())
+	}
+	frontchannelLogoutTemplate.Execute(rw, data)
+}
@@ -19,9 +19,13 @@ package provider
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/golang-jwt/jwt/v4"
@@ -34,6 +38,8 @@ import (
 	"github.com/libregraph/lico/identity/clients"
 	konnectoidc "github.com/libregraph/lico/oidc"
 	"github.com/libregraph/lico/oidc/code"
+	"github.com/libregraph/lico/oidc/device"
+	"github.com/libregraph/lico/oidc/par"
 	"github.com/libregraph/lico/oidc/payload"
 	"github.com/libregraph/lico/utils"
 )
@@ -54,6 +60,17 @@ func (p *Provider) WellKnownHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// MetadataHandler implements the HTTP OAuth 2.0 authorization server meta
+// data endpoint as specified at https://tools.ietf.org/html/rfc8414#section-3
+func (p *Provider) MetadataHandler(rw http.ResponseWriter, req *http.Request) {
+	metadata := p.authorizationServerMetadata
+
+	err := utils.WriteJSON(rw, http.StatusOK, metadata, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("metadata request failed writing response")
+	}
+}
+
 // JwksHandler implements the HTTP provider JWKS endpoint for OpenID provider
 // metadata used with OpenID Connect Discovery 1.0 as specified at https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
 func (p *Provider) JwksHandler(rw http.ResponseWriter, req *http.Request) {
@@ -102,46 +119,32 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ar, err := payload.DecodeAuthenticationRequest(req, p.metadata, func(token *jwt.Token) (interface{}, error) {
-		if claims, ok := token.Claims.(*payload.RequestObjectClaims); ok {
-			// Validate signed request tokens according to spec defined at
-			// https://openid.net/specs/openid-connect-core-1_0.html#SignedRequestObject
-			registration, _ := p.clients.Get(req.Context(), claims.ClientID)
-			if registration != nil {
-				if registration.RawRequestObjectSigningAlg != "" {
-					if token.Method.Alg() != registration.RawRequestObjectSigningAlg {
-						return nil, fmt.Errorf("token alg does not match client registration")
-					}
-				}
-				if token.Method == jwt.SigningMethodNone {
-					// Request parameters do not need to be signed to be valid, so
-					// none is allowed in this special case.
-					return jwt.UnsafeAllowNoneSignatureType, nil
-				}
-				// Get secure client.
-				if registration.JWKS != nil {
-					secureClient, err := registration.Secure(token.Header[oidc.JWTHeaderKeyID])
-					if err != nil {
-						return nil, err
-					}
-					if err := claims.SetSecure(secureClient); err != nil {
-						return nil, err
-					}
-					return secureClient.PublicKey, err
-				}
-				return nil, fmt.Errorf("no client keys registered")
-			} else {
-				// Also allow, when client is not registered and the token is unsigned.
-				if token.Method == jwt.SigningMethodNone {
-					// Request parameters do not need to be signed to be valid, so
-					// none is allowed in this special case.
-					return jwt.UnsafeAllowNoneSignatureType, nil
-				}
-			}
-		}
+	if p.deviceManager != nil && req.Form.Get("user_code") != "" {
+		// Device verification reuses the authorization endpoint.
+		p.DeviceVerificationHandler(rw, req)
+		return
+	}
 
-		return nil, fmt.Errorf("not validated")
-	})
+	// Pushed authorization requests are referenced by request_uri.
+	// https://tools.ietf.org/html/rfc9126#section-4
+	requestURI, err := p.resolvePushedAuthorizationRequest(req)
+	if err != nil {
+		p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("authorize request invalid request_uri")
+		p.ErrorPage(rw, http.StatusBadRequest, err.Error(), err.(*konnectoidc.OAuth2Error).Description())
+		return
+	}
+
+	// Request objects passed by reference are fetched and then handled like
+	// request objects passed by value.
+	// https://openid.net/specs/openid-connect-core-1_0.html#RequestUriParameter
+	err = p.resolveRequestURI(req)
+	if err != nil {
+		p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("authorize request invalid request_uri")
+		p.ErrorPage(rw, http.StatusBadRequest, err.Error(), err.(*konnectoidc.OAuth2Error).Description())
+		return
+	}
+
+	ar, err := payload.DecodeAuthenticationRequest(req, p.metadata.WellKnown, p.requestObjectKeyFunc(req.Context()))
 	if err != nil {
 		p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("authorize request invalid request data")
 		p.ErrorPage(rw, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
@@ -155,12 +158,44 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		goto done
 	}
 
-	// Inject implicit scopes set by client registration.
+	// Resource indicators as specified at https://tools.ietf.org/html/rfc8707#section-2.1
+	err = p.validateResources(req.Context(), ar.Resources)
+	if err != nil {
+		goto done
+	}
+	// Rich authorization requests as specified at https://datatracker.ietf.org/doc/html/rfc9396#section-2
+	err = p.validateAuthorizationDetails(req.Context(), ar.ClientID, ar.AuthorizationDetails)
+	if err != nil {
+		goto done
+	}
+
 	if registration, _ := p.clients.Get(req.Context(), ar.ClientID); registration != nil {
+		if registration.RequirePushedAuthorizationRequests && requestURI == "" {
+			// https://tools.ietf.org/html/rfc9126#section-6
+			err = ar.NewBadRequest(oidc.ErrorCodeOAuth2InvalidRequest, "client requires pushed authorization requests")
+			goto done
+		}
+
+		if registration.Dynamic && len(registration.Scopes) > 0 {
+			// Dynamic clients are limited to the scopes of their registration.
+			for scope, requested := range ar.Scopes {
+				if requested && scope != oidc.ScopeOpenID && !containsString(registration.Scopes, scope) {
+					err = ar.NewBadRequest(konnectoidc.ErrorCodeOAuth2InvalidScope, "scope not allowed: "+scope)
+					goto done
+				}
+			}
+		}
+
+		// Inject implicit scopes set by client registration.
 		err = registration.ApplyImplicitScopes(ar.Scopes)
 		if err != nil {
 			p.logger.WithError(err).Debugln("failed to apply implicit scopes")
 		}
+
+		if registration.UsesPairwiseSubject() {
+			// ID token hints hold the pairwise subject of the client.
+			ar.SubjectMapper = p.makePairwiseSubjectMapper(registration)
+		}
 	}
 
 	// Find session if any, ignoring errors.
@@ -181,12 +216,26 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		// Validate sub claim request
 		// https://openid.net/specs/openid-connect-core-1_0.html#ImplicitValidation
 		if subRequest, ok := ar.Claims.IDToken.Get(oidc.SubjectIdentifierClaim); ok {
-			if !subRequest.Match(auth.Subject()) {
+			var sub string
+			sub, err = p.ClientSubjectFromAuth(req.Context(), auth, ar.ClientID)
+			if err != nil {
+				goto done
+			}
+			if !subRequest.Match(sub) {
 				err = ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, "sub claim request mismatch")
 				goto done
 			}
 		}
 	}
+	// Validate essential acr claim request, in case the identity manager did
+	// not enforce it already.
+	// https://openid.net/specs/openid-connect-core-1_0.html#acrSemantics
+	if acrValues, essential := ar.RequestedACRValues(); essential {
+		if acr, _ := auth.AuthContext(); !konnectoidc.ACRSatisfies(acr, acrValues) {
+			err = ar.NewError(oidc.ErrorCodeOAuth2AccessDenied, "acr claim request not satisfied")
+			goto done
+		}
+	}
 
 	// Authorization Server Obtains End-User Consent/Authorization
 	// http://openid.net/specs/openid-connect-core-1_0.html#ImplicitConsent
@@ -195,6 +244,11 @@ func (p *Provider) AuthorizeHandler(rw http.ResponseWriter, req *http.Request) {
 		goto done
 	}
 
+	if requestURI != "" {
+		// Pushed authorization requests are only used once.
+		p.parManager.Remove(requestURI)
+	}
+
 done:
 	p.AuthorizeResponse(rw, req, ar, auth, err)
 }
@@ -207,6 +261,7 @@ func (p *Provider) AuthorizeResponse(rw http.ResponseWriter, req *http.Request,
 	var idTokenString string
 	var authorizedScopes map[string]bool
 	var session *payload.Session
+	var resource string
 	var ctx context.Context
 
 	if err != nil {
@@ -229,6 +284,8 @@ func (p *Provider) AuthorizeResponse(rw http.ResponseWriter, req *http.Request,
 			AuthenticationRequest: ar,
 			Auth:                  auth,
 			Session:               session,
+
+			AuthorizationDetails: ar.AuthorizationDetails,
 		})
 		if err != nil {
 			goto done
@@ -237,7 +294,11 @@ func (p *Provider) AuthorizeResponse(rw http.ResponseWriter, req *http.Request,
 
 	// Create access token when requested.
 	if _, ok := ar.ResponseTypes[oidc.ResponseTypeToken]; ok {
-		accessTokenString, err = p.makeAccessToken(ctx, ar.ClientID, auth, nil)
+		resource, err = p.selectResource(ctx, nil, ar.Resources)
+		if err != nil {
+			goto done
+		}
+		accessTokenString, err = p.makeAccessToken(ctx, ar.ClientID, auth, nil, append(p.accessTokenResourceOptions(ctx, ar.ClientID, resource), withAuthorizationDetails(ar.AuthorizationDetails))...)
 		if err != nil {
 			goto done
 		}
@@ -266,7 +327,7 @@ done:
 	if err != nil {
 		switch err.(type) {
 		case *payload.AuthenticationError:
-			p.Found(rw, ar.RedirectURI, err, ar.UseFragment)
+			p.authorizeRedirect(rw, req, ar, err)
 		case *payload.AuthenticationBadRequest:
 			p.ErrorPage(rw, http.StatusBadRequest, err.Error(), err.(*payload.AuthenticationBadRequest).Description())
 		case *identity.RedirectError:
@@ -277,7 +338,7 @@ done:
 			// do nothing
 		case *konnectoidc.OAuth2Error:
 			err = ar.NewError(err.Error(), err.(*konnectoidc.OAuth2Error).Description())
-			p.Found(rw, ar.RedirectURI, err, ar.UseFragment)
+			p.authorizeRedirect(rw, req, ar, err)
 		default:
 			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("authorize request failed")
 			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
@@ -313,7 +374,37 @@ done:
 		response.IDToken = idTokenString
 	}
 
-	p.Found(rw, ar.RedirectURI, response, ar.UseFragment)
+	p.authorizeRedirect(rw, req, ar, response)
+}
+
+// authorizeRedirect returns the provided params to the redirect URI of the
+// provided authentication request using its response mode.
+func (p *Provider) authorizeRedirect(rw http.ResponseWriter, req *http.Request, ar *payload.AuthenticationRequest, params interface{}) {
+	switch ar.ResponseMode {
+	case konnectoidc.ResponseModeJWT, konnectoidc.ResponseModeQueryJWT, konnectoidc.ResponseModeFragmentJWT, konnectoidc.ResponseModeFormPostJWT:
+		// JWT Secured Authorization Response Mode.
+		// https://openid.net/specs/oauth-v2-jarm.html#section-2.1
+		response, err := p.makeAuthorizationResponseJWT(req.Context(), ar, params)
+		if err != nil {
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("authorize request failed to sign response")
+			p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		params = &payload.AuthenticationSignedResponse{
+			Response: response,
+		}
+		if ar.ResponseMode == konnectoidc.ResponseModeFormPostJWT {
+			p.FormPost(rw, ar.RedirectURI, params)
+		} else {
+			p.Found(rw, ar.RedirectURI, params, ar.UseFragment)
+		}
+	case konnectoidc.ResponseModeFormPost:
+		p.FormPost(rw, ar.RedirectURI, params)
+	case konnectoidc.ResponseModeWebMessage:
+		p.WebMessage(rw, ar.RedirectURI, params)
+	default:
+		p.Found(rw, ar.RedirectURI, params, ar.UseFragment)
+	}
 }
 
 // TokenHandler implements the HTTP token endpoint for OpenID
@@ -331,6 +422,17 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 	var approvedScopes map[string]bool
 	var authorizedScopes map[string]bool
 	var clientDetails *clients.Details
+	var audience string
+	var issuedTokenType string
+	var accessTokenOptions []accessTokenOption
+	var refreshTokenOptions []refreshTokenOption
+	var grantedResources []string
+	var resource string
+	var authorizationDetails payload.AuthorizationDetails
+	var rotateRefreshTokens bool
+	var dpopJKT string
+	var clientCertificate *x509.Certificate
+	var confirmation *payload.ConfirmationClaims
 	signinMethod := p.signingMethodDefault
 
 	rw.Header().Set("Cache-Control", "no-store")
@@ -352,7 +454,7 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		goto done
 	}
-	tr, err = payload.DecodeTokenRequest(req, p.metadata)
+	tr, err = payload.DecodeTokenRequest(req, p.metadata.WellKnown)
 	if err != nil {
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
 		goto done
@@ -367,13 +469,64 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	// Additional validations according to https://tools.ietf.org/html/rfc6749#section-4.1.3
-	clientDetails, err = p.clients.Lookup(req.Context(), tr.ClientID, tr.ClientSecret, tr.RedirectURI, "", false)
+	clientDetails, err = p.clients.Lookup(req.Context(), tr.ClientID, tr.ClientSecret, tr.RedirectURI, "", tr.ClientAssertion != "")
 	if err != nil {
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2AccessDenied, err.Error())
 		goto done
 	}
 	if clientDetails != nil && clientDetails.Registration != nil {
 		signinMethod = jwt.GetSigningMethod(clientDetails.Registration.RawIDTokenSignedResponseAlg)
+		// Rotation needs the revocation store to invalidate rotated tokens.
+		rotateRefreshTokens = clientDetails.Registration.RotateRefreshTokens
+		if rotateRefreshTokens && p.revocationStore == nil {
+			p.logger.WithField("client_id", clientDetails.ID).Warnln("refresh token rotation is configured for client, but disabled since there is no revocation store")
+			rotateRefreshTokens = false
+		}
+	}
+
+	// Client authentication as specified at
+	// https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+	clientCertificate, err = p.authenticateClient(req, tr.ClientSecret, tr.ClientAssertion, clientDetails)
+	if err != nil {
+		goto done
+	}
+	if clientCertificate == nil {
+		// Public clients can use a client certificate to bind tokens.
+		certificates, certificatesErr := p.getClientCertificates(req)
+		if certificatesErr != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, certificatesErr.Error())
+			goto done
+		}
+		if len(certificates) > 0 {
+			clientCertificate = certificates[0]
+		}
+	}
+
+	// Bind tokens to the client certificate if any as specified at
+	// https://tools.ietf.org/html/rfc8705#section-3
+	if clientCertificate != nil {
+		confirmation = &payload.ConfirmationClaims{
+			X5tS256: getCertificateThumbprint(clientCertificate),
+		}
+	}
+	// Bind tokens to the key of the DPoP proof if any as specified at
+	// https://datatracker.ietf.org/doc/html/rfc9449#section-5
+	if len(req.Header.Values(konnectoidc.DPoPHeader)) > 0 {
+		dpopJKT, err = p.validateDPoPProof(req, p.tokenPath, "")
+		if err != nil {
+			goto done
+		}
+		if confirmation == nil {
+			confirmation = &payload.ConfirmationClaims{}
+		}
+		confirmation.JKT = dpopJKT
+	}
+	if confirmation != nil {
+		accessTokenOptions = append(accessTokenOptions, withConfirmation(confirmation))
+		// Refresh tokens of public clients are bound as well.
+		if clientDetails == nil || clientDetails.Registration == nil || !clientDetails.Registration.IsConfidential() {
+			refreshTokenOptions = append(refreshTokenOptions, withRefreshConfirmation(confirmation))
+		}
 	}
 
 	switch tr.GrantType {
@@ -389,6 +542,8 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 		session = codeRecord.Session
 
 		authorizedScopes = auth.AuthorizedScopes()
+		grantedResources = ar.Resources
+		authorizationDetails = codeRecord.AuthorizationDetails
 
 		// Ensure that the authorization code was issued to the client id.
 		if ar.ClientID != tr.ClientID {
@@ -429,9 +584,50 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 			goto done
 		}
 
+		// Ensure that the refresh token was not revoked.
+		if revoked, revokedErr := p.isRevoked(claims.Family, claims.Ref, claims.Id); revokedErr != nil {
+			err = revokedErr
+			goto done
+		} else if revoked {
+			if rotateRefreshTokens {
+				err = p.revokeReusedRefreshToken(tr.ClientID, claims)
+			} else {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "refresh_token revoked")
+			}
+			goto done
+		}
+
+		// Ensure that bound refresh tokens are used with a DPoP proof for the
+		// bound key and the bound client certificate.
+		err = verifyConfirmation(claims.Confirmation, dpopJKT, confirmation)
+		if err != nil {
+			goto done
+		}
+
+		// Consume rotated refresh tokens before new tokens are issued, so
+		// only one of concurrent requests with the same refresh token wins
+		// and all others are detected as reuse.
+		if rotateRefreshTokens {
+			if consumed, consumeErr := p.revocationStore.RevokeIfNotRevoked(claims.Id, time.Unix(claims.ExpiresAt, 0)); consumeErr != nil {
+				err = consumeErr
+				goto done
+			} else if !consumed {
+				err = p.revokeReusedRefreshToken(tr.ClientID, claims)
+				goto done
+			}
+		}
+
+		// Issue the access token within the family of the refresh token, so
+		// it gets revoked together with it.
+		if claims.Family != "" {
+			accessTokenOptions = append(accessTokenOptions, withAccessTokenFamily(claims.Family))
+		} else {
+			accessTokenOptions = append(accessTokenOptions, withAccessTokenFamily(claims.Ref))
+		}
+
 		// TODO(longsleep): Compare standard claims issuer.
 
-		userID, sessionRef := p.getUserIDAndSessionRefFromClaims(&claims.StandardClaims, nil, claims.IdentityClaims)
+		userID, sessionRef := p.getUserIDAndSessionRefFromClaims(claims.Audience, nil, claims.IdentityClaims)
 		if userID == "" {
 			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "missing data in kc.identity claim")
 			goto done
@@ -487,24 +683,315 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 		auth.AuthorizeScopes(authorizedScopes)
 		// Add authorized claims from request.
 		auth.AuthorizeClaims(claims.ApprovedClaimsRequest)
+		// Keep the authentication context of the original authentication.
+		if claims.AuthContextClaims != nil {
+			auth.SetAuthContext(claims.AuthContextClassReference, claims.AuthMethodsReferences)
+		}
+
+		// Keep the resources and authorization details granted for the
+		// original authorization.
+		grantedResources = claims.Resources
+		authorizationDetails = claims.AuthorizationDetails
 
 		// Create fake request for token generation.
 		ar = &payload.AuthenticationRequest{
 			ClientID: claims.Audience,
 		}
 
+	case konnectoidc.GrantTypeDeviceCode:
+		// Device Access Token Request as specified at https://tools.ietf.org/html/rfc8628#section-3.4
+		if p.deviceManager == nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2UnsupportedGrantType, "grant_type value not implemented")
+			goto done
+		}
+
+		codeRecord, pollErr := p.deviceManager.Poll(tr.DeviceCode)
+		switch pollErr {
+		case nil:
+			// breaks
+		case device.ErrAuthorizationPending:
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2AuthorizationPending, "")
+		case device.ErrSlowDown:
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2SlowDown, "")
+		case device.ErrAccessDenied:
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2AccessDenied, "")
+		case device.ErrExpiredToken:
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2ExpiredToken, "")
+		default:
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "device_code not found")
+		}
+		if err != nil {
+			goto done
+		}
+
+		ar = codeRecord.AuthenticationRequest
+		auth = codeRecord.Auth
+		session = codeRecord.Session
+
+		authorizedScopes = auth.AuthorizedScopes()
+
+		// Ensure that the device code was issued to the client id.
+		if ar.ClientID != tr.ClientID {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "client_id mismatch")
+			goto done
+		}
+
+		if _, ok := identity.FromContext(req.Context()); !ok {
+			req = req.WithContext(identity.NewContext(req.Context(), auth))
+		}
+
+	case konnectoidc.GrantTypeTokenExchange:
+		// Token Exchange as specified at https://tools.ietf.org/html/rfc8693
+		// is only available for confidential clients which are registered
+		// for it.
+		if clientDetails == nil || clientDetails.Registration == nil || !clientDetails.Registration.IsConfidential() {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "token-exchange requires a confidential client")
+			goto done
+		}
+		if !clientDetails.Registration.HasGrantType(konnectoidc.GrantTypeTokenExchange) {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "token-exchange not allowed for client")
+			goto done
+		}
+
+		subjectClaims, subjectErr := p.parseExchangeToken(tr.RawSubjectToken)
+		if subjectErr != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid subject_token: "+subjectErr.Error())
+			goto done
+		}
+		// The subject token must have been issued to the requesting client.
+		if subjectClaims.Audience != clientDetails.ID {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid subject_token: audience mismatch")
+			goto done
+		}
+		// Sender-constrained subject tokens require proof of possession, the
+		// issued token is bound to the same keys by the request.
+		err = verifyConfirmation(subjectClaims.Confirmation, dpopJKT, confirmation)
+		if err != nil {
+			goto done
+		}
+
+		// The new token is aimed at the requested audience, which must be a
+		// known client. Defaults to the requesting client.
+		audience = tr.Audience
+		if audience == "" {
+			audience = clientDetails.ID
+		} else if registration, _ := p.clients.Get(req.Context(), audience); registration == nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, "unknown audience")
+			goto done
+		}
+
+		// Scopes can only be reduced.
+		approvedScopes = subjectClaims.AuthorizedScopes()
+		if len(tr.Scopes) > 0 {
+			authorizedScopes = make(map[string]bool)
+			for scope := range tr.Scopes {
+				if !approvedScopes[scope] {
+					err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidScope, "scope exceeds subject_token")
+					goto done
+				}
+				authorizedScopes[scope] = true
+			}
+		} else {
+			authorizedScopes = approvedScopes
+		}
+
+		// Delegation, keeping previous actors of the subject token as nested
+		// actors. Without actor token, the chain of the subject is kept.
+		actor := subjectClaims.Actor
+		if tr.RawActorToken != "" {
+			actorClaims, actorErr := p.parseExchangeToken(tr.RawActorToken)
+			if actorErr != nil {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid actor_token: "+actorErr.Error())
+				goto done
+			}
+			err = verifyConfirmation(actorClaims.Confirmation, dpopJKT, confirmation)
+			if err != nil {
+				goto done
+			}
+			actor = &konnect.ActorClaims{
+				Subject: actorClaims.Subject,
+				Actor:   subjectClaims.Actor,
+			}
+		}
+		if actor != nil {
+			accessTokenOptions = append(accessTokenOptions, withActor(actor))
+		}
+		// Exchanged tokens stay within the family of the subject token.
+		if subjectClaims.Family != "" {
+			accessTokenOptions = append(accessTokenOptions, withAccessTokenFamily(subjectClaims.Family))
+		}
+
+		userID, sessionRef := p.getUserIDAndSessionRefFromClaims(subjectClaims.Client(), subjectClaims.SessionClaims, subjectClaims.IdentityClaims)
+		if userID == "" {
+			// Subject without user, for example from client credentials.
+			auth = identity.NewAuthRecord(nil, subjectClaims.Subject, authorizedScopes, nil, nil)
+		} else {
+			ctx := konnect.NewClaimsContext(req.Context(), subjectClaims)
+
+			var currentIdentityManager identity.Manager
+			currentIdentityManager, err = p.getIdentityManagerFromClaims(subjectClaims.IdentityProvider, subjectClaims.IdentityClaims)
+			if err != nil {
+				goto done
+			}
+
+			// Load user record from identitymanager, without any scopes or claims.
+			auth, found, err = currentIdentityManager.Fetch(ctx, userID, sessionRef, nil, nil, authorizedScopes)
+			if !found {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "user not found")
+				goto done
+			}
+			if err != nil {
+				goto done
+			}
+			// Add authorized scopes.
+			auth.AuthorizeScopes(authorizedScopes)
+			// Add authorized claims from subject token.
+			auth.AuthorizeClaims(subjectClaims.AuthorizedClaimsRequest)
+		}
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: clientDetails.ID,
+		}
+		issuedTokenType = konnectoidc.TokenTypeIdentifierAccessToken
+
+	case konnectoidc.GrantTypeJWTBearer:
+		// JWT Bearer Authorization Grant as specified at https://tools.ietf.org/html/rfc7523#section-2.1
+		if clientDetails == nil || clientDetails.Registration == nil || !clientDetails.Registration.HasGrantType(konnectoidc.GrantTypeJWTBearer) {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "jwt-bearer not allowed for client")
+			goto done
+		}
+
+		authority, assertion, assertionErr := p.parseJWTBearerAssertion(req.Context(), tr.Assertion)
+		if assertionErr != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid assertion: "+assertionErr.Error())
+			goto done
+		}
+		if authority.ClientID != "" && authority.ClientID != clientDetails.ID {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "assertion issuer not allowed for client")
+			goto done
+		}
+
+		subject, _, subjectErr := authority.IdentityClaimValue(assertion)
+		if subjectErr != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid assertion: "+subjectErr.Error())
+			goto done
+		}
+
+		// Scopes are limited by the authority and by the optional scope claim
+		// of the assertion.
+		assertionClaims := assertion.Claims.(jwt.MapClaims)
+		approvedScopes = make(map[string]bool)
+		for _, scope := range authority.Scopes {
+			approvedScopes[scope] = true
+		}
+		if rawScope, ok := assertionClaims[konnectoidc.ScopeClaim].(string); ok {
+			assertionScopes := make(map[string]bool)
+			for _, scope := range strings.Split(rawScope, " ") {
+				if approvedScopes[scope] {
+					assertionScopes[scope] = true
+				}
+			}
+			approvedScopes = assertionScopes
+		}
+		if len(tr.Scopes) > 0 {
+			authorizedScopes = make(map[string]bool)
+			for scope := range tr.Scopes {
+				if !approvedScopes[scope] {
+					err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidScope, "scope not allowed for assertion")
+					goto done
+				}
+				authorizedScopes[scope] = true
+			}
+		} else {
+			authorizedScopes = approvedScopes
+		}
+
+		// Reject replay, as last step so a failed request does not burn the
+		// assertion.
+		jti, _ := assertionClaims[konnectoidc.JWTIDClaim].(string)
+		exp, _ := assertionClaims[oidc.ExpirationClaim].(float64)
+		if consumeErr := authority.ConsumeJTI(jti, time.Unix(int64(exp), 0)); consumeErr != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "invalid assertion: "+consumeErr.Error())
+			goto done
+		}
+
+		auth = identity.NewAuthRecord(nil, subject, authorizedScopes, nil, nil)
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: clientDetails.ID,
+		}
+
+	case konnectoidc.GrantTypeClientCredentials:
+		// Client Credentials Grant as specified at https://tools.ietf.org/html/rfc6749#section-4.4
+		// is only available for confidential clients which are registered
+		// for it.
+		if clientDetails == nil || clientDetails.Registration == nil || !clientDetails.Registration.IsConfidential() {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "client_credentials requires a confidential client")
+			goto done
+		}
+		if !clientDetails.Registration.HasGrantType(konnectoidc.GrantTypeClientCredentials) {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "client_credentials not allowed for client")
+			goto done
+		}
+
+		// Limit scopes to the scopes which are registered for the client.
+		authorizedScopes, err = clientDetails.Registration.ApplyAllowedScopes(tr.Scopes)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidScope, err.Error())
+			goto done
+		}
+
+		// The client itself is the subject of the token. There is no user and
+		// thus no identity manager involved.
+		auth = identity.NewAuthRecord(nil, clientDetails.ID, authorizedScopes, nil, nil)
+
+		// Create fake request for token generation.
+		ar = &payload.AuthenticationRequest{
+			ClientID: clientDetails.ID,
+		}
+
 	default:
 		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2UnsupportedGrantType, "grant_type value not implemented")
 		goto done
 	}
 
+	// Create a new family for the refresh token when granted, and issue the
+	// access token within it so revoking the refresh token also revokes the
+	// access token as specified at https://tools.ietf.org/html/rfc7009#section-2.1
+	if (tr.GrantType == oidc.GrantTypeAuthorizationCode || tr.GrantType == konnectoidc.GrantTypeDeviceCode) && authorizedScopes[oidc.ScopeOfflineAccess] {
+		family := rndm.GenerateRandomString(32)
+		accessTokenOptions = append(accessTokenOptions, withAccessTokenFamily(family))
+		refreshTokenOptions = append(refreshTokenOptions, withFamily(family))
+	}
+
 	// Create access token.
-	accessTokenString, err = p.makeAccessToken(req.Context(), ar.ClientID, auth, signinMethod)
+	if audience == "" {
+		audience = ar.ClientID
+	}
+	// Issue the access token for the requested resource if any as specified
+	// at https://tools.ietf.org/html/rfc8707#section-2.2
+	resource, err = p.selectResource(req.Context(), tr.Resources, grantedResources)
+	if err != nil {
+		goto done
+	}
+	accessTokenOptions = append(accessTokenOptions, p.accessTokenResourceOptions(req.Context(), audience, resource)...)
+	if len(grantedResources) > 0 {
+		refreshTokenOptions = append(refreshTokenOptions, withRefreshResources(grantedResources))
+	}
+	if len(authorizationDetails) > 0 {
+		accessTokenOptions = append(accessTokenOptions, withAuthorizationDetails(authorizationDetails))
+		refreshTokenOptions = append(refreshTokenOptions, withRefreshAuthorizationDetails(authorizationDetails))
+	}
+	accessTokenString, err = p.makeAccessToken(req.Context(), audience, auth, signinMethod, accessTokenOptions...)
 	if err != nil {
 		goto done
 	}
 
 	switch tr.GrantType {
+	case konnectoidc.GrantTypeDeviceCode:
+		fallthrough
 	case oidc.GrantTypeAuthorizationCode:
 		// Create ID token when not previously requested amd openid scope is authorized.
 		if !ar.ResponseTypes[oidc.ResponseTypeIDToken] && authorizedScopes[oidc.ScopeOpenID] {
@@ -516,7 +1003,23 @@ func (p *Provider) TokenHandler(rw http.ResponseWriter, req *http.Request) {
 
 		// Create refresh token when granted.
 		if authorizedScopes[oidc.ScopeOfflineAccess] {
-			refreshTokenString, err = p.makeRefreshToken(req.Context(), ar.ClientID, auth, nil)
+			refreshTokenString, err = p.makeRefreshToken(req.Context(), ar.ClientID, auth, nil, refreshTokenOptions...)
+			if err != nil {
+				goto done
+			}
+		}
+
+	case oidc.GrantTypeRefreshToken:
+		if rotateRefreshTokens {
+			// Rotate refresh token, keeping all approved scopes and the family
+			// of the previous refresh token which was consumed already.
+			claims := tr.RefreshToken.Claims.(*konnect.RefreshTokenClaims)
+			family := claims.Family
+			if family == "" {
+				family = claims.Ref
+			}
+			auth.AuthorizeScopes(approvedScopes)
+			refreshTokenString, err = p.makeRefreshToken(req.Context(), ar.ClientID, auth, nil, append(refreshTokenOptions, withFamily(family))...)
 			if err != nil {
 				goto done
 			}
@@ -546,6 +1049,9 @@ done:
 	if accessTokenString != "" {
 		response.AccessToken = accessTokenString
 		response.TokenType = oidc.TokenTypeBearer
+		if dpopJKT != "" {
+			response.TokenType = konnectoidc.TokenTypeDPoP
+		}
 		response.ExpiresIn = int64(p.accessTokenDuration.Seconds())
 	}
 	if idTokenString != "" {
@@ -554,6 +1060,14 @@ done:
 	if refreshTokenString != "" {
 		response.RefreshToken = refreshTokenString
 	}
+	if issuedTokenType != "" {
+		response.IssuedTokenType = issuedTokenType
+		response.Scope = strings.Join(makeArrayFromBoolMap(authorizedScopes), " ")
+	}
+	if len(authorizationDetails) > 0 {
+		// https://datatracker.ietf.org/doc/html/rfc9396#section-7
+		response.AuthorizationDetails = authorizationDetails
+	}
 
 	err = utils.WriteJSON(rw, http.StatusOK, response, "")
 	if err != nil {
@@ -593,7 +1107,7 @@ func (p *Provider) UserInfoHandler(rw http.ResponseWriter, req *http.Request) {
 	var requestedClaimsMap []*payload.ClaimsRequestMap
 	var authorizedScopes map[string]bool
 
-	userID, sessionRef := p.getUserIDAndSessionRefFromClaims(&claims.StandardClaims, claims.SessionClaims, claims.IdentityClaims)
+	userID, sessionRef := p.getUserIDAndSessionRefFromClaims(claims.Client(), claims.SessionClaims, claims.IdentityClaims)
 
 	ctx := konnect.NewClaimsContext(req.Context(), claims)
 
@@ -631,7 +1145,7 @@ done:
 		return
 	}
 
-	publicSubject, err := p.PublicSubjectFromAuth(auth)
+	publicSubject, err := p.ClientSubjectFromAuth(ctx, auth, claims.Client())
 	if err != nil {
 		p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to create subject")
 		p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
@@ -709,33 +1223,54 @@ done:
 		}
 	}
 
-	// Support returning signed user info if the registered client requested it
-	// as specified in https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse and
+	// Support returning signed and or encrypted user info if the registered
+	// client requested it as specified in https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse and
 	// https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
-	registration, _ := p.clients.Get(req.Context(), claims.Audience)
-	if registration != nil {
+	registration, _ := p.clients.Get(req.Context(), claims.Client())
+	if registration != nil && (registration.RawUserInfoSignedResponseAlg != "" || registration.RawUserInfoEncryptedResponseAlg != "") {
+		// Set extra claims.
+		responseAsMap[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
+		responseAsMap[oidc.AudienceClaim] = registration.ID
+
+		var tokenString string
 		if registration.RawUserInfoSignedResponseAlg != "" {
-			// Get alg.
-			alg := jwt.GetSigningMethod(registration.RawUserInfoSignedResponseAlg)
-			// Set extra claims.
-			responseAsMap[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
-			responseAsMap[oidc.AudienceClaim] = registration.ID
-			tokenString, err := p.makeJWT(req.Context(), alg, jwt.MapClaims(responseAsMap))
+			// Get alg from registration, like for ID tokens. Unknown algs
+			// result in nil which uses the default signing method.
+			signingMethod := jwt.GetSigningMethod(registration.RawUserInfoSignedResponseAlg)
+			tokenString, err = p.makeJWT(req.Context(), signingMethod, jwt.MapClaims(responseAsMap))
 			if err != nil {
 				p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to encode jwt")
 				p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
 				return
 			}
-
-			rw.Header().Set("Content-Type", "application/jwt")
-			rw.Write([]byte(tokenString))
-			return
 		}
-	}
-
-	err = utils.WriteJSON(rw, http.StatusOK, responseAsMap, "")
-	if err != nil {
-		p.logger.WithError(err).Errorln("userinfo request failed writing response")
+		if registration.RawUserInfoEncryptedResponseAlg != "" {
+			nested := tokenString != ""
+			plaintext := []byte(tokenString)
+			if !nested {
+				plaintext, err = json.Marshal(responseAsMap)
+				if err != nil {
+					p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to encode claims")
+					p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+					return
+				}
+			}
+			tokenString, err = p.encryptForClient(registration, registration.RawUserInfoEncryptedResponseAlg, registration.RawUserInfoEncryptedResponseEnc, plaintext, nested)
+			if err != nil {
+				p.logger.WithFields(utils.ErrorAsFields(err)).Debugln("userinfo request failed to encrypt")
+				p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+				return
+			}
+		}
+
+		rw.Header().Set("Content-Type", "application/jwt")
+		rw.Write([]byte(tokenString))
+		return
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, responseAsMap, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("userinfo request failed writing response")
 	}
 }
 
@@ -757,7 +1292,7 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	esr, err := payload.DecodeEndSessionRequest(req, p.metadata)
+	esr, err := payload.DecodeEndSessionRequest(req, p.metadata.WellKnown)
 	if err != nil {
 		p.logger.WithError(err).Errorln("endsession request invalid request data")
 		p.ErrorPage(rw, http.StatusBadRequest, oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
@@ -771,6 +1306,14 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 		goto done
 	}
 
+	if esr.IDTokenHint != nil {
+		audience := esr.IDTokenHint.Claims.(*konnectoidc.IDTokenClaims).Audience
+		if registration, _ := p.clients.Get(req.Context(), audience); registration != nil && registration.UsesPairwiseSubject() {
+			// ID token hints hold the pairwise subject of the client.
+			esr.SubjectMapper = p.makePairwiseSubjectMapper(registration)
+		}
+	}
+
 	// Get our session.
 	session, err = p.getSession(req)
 	if err != nil {
@@ -788,6 +1331,10 @@ func (p *Provider) EndSessionHandler(rw http.ResponseWriter, req *http.Request)
 		goto done
 	}
 
+	// Notify clients of the ended session, in case the identity manager did
+	// not trigger its unset logon callbacks.
+	p.endSession(req.Context(), session)
+
 done:
 	if err != nil {
 		switch err.(type) {
@@ -819,7 +1366,10 @@ done:
 	}
 
 	uri := esr.MakeRedirectEndSessionRequestURL()
-	if uri == nil {
+	if frontchannelLogoutURIs := p.makeFrontchannelLogoutURIs(req.Context(), session); len(frontchannelLogoutURIs) > 0 {
+		// Notify clients in the browser, before continuing.
+		p.FrontchannelLogout(rw, frontchannelLogoutURIs, uri)
+	} else if uri == nil {
 		err = utils.WriteJSON(rw, http.StatusOK, response, "")
 		if err != nil {
 			p.logger.WithError(err).Errorln("endsession request failed writing response")
@@ -858,6 +1408,22 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 	req.Body = http.MaxBytesReader(rw, req.Body, registrationSizeLimit)
 	addResponseHeaders(rw.Header())
 
+	switch req.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		// Registered clients manage their registration with the same URL.
+		p.ClientConfigurationHandler(rw, req)
+		return
+	}
+
+	// Registration may require an initial access token as specified at
+	// https://tools.ietf.org/html/rfc7591#section-3
+	policy := p.clients.RegistrationPolicy()
+	if policy != nil && policy.RequiresInitialAccessToken() && !policy.ValidateInitialAccessToken(getBearerToken(req)) {
+		p.logger.Debugln("client registration request unauthorized")
+		konnectoidc.WriteWWWAuthenticateError(rw, http.StatusUnauthorized, konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "invalid initial access token"))
+		return
+	}
+
 	crr, err := payload.DecodeClientRegistrationRequest(req)
 	if err != nil {
 		p.logger.WithError(err).Errorln("client registration request failed to decode request data")
@@ -867,6 +1433,7 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 	}
 
 	var cr *clients.ClientRegistration
+	var registrationAccessToken string
 
 	// Validate request method
 	switch req.Method {
@@ -877,8 +1444,15 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 		goto done
 	}
 
+	// Apply software statement before validation, so its values get
+	// validated as well.
+	err = p.applySoftwareStatement(req.Context(), policy, crr)
+	if err != nil {
+		goto done
+	}
+
 	// Validate request.
-	err = crr.Validate()
+	err = p.validateClientRegistrationRequest(req.Context(), crr)
 	if err != nil {
 		goto done
 	}
@@ -888,6 +1462,11 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 	if err != nil {
 		goto done
 	}
+	err = p.applyRegistrationPolicy(req.Context(), policy, cr)
+	if err != nil {
+		goto done
+	}
+	crr.Scope = strings.Join(cr.Scopes, " ")
 
 	// Set client to dynamic. This creates the id and client secret.
 	err = cr.SetDynamic(clients.NewRegistryContext(req.Context(), p.clients), p.clients.StatelessCreator)
@@ -895,6 +1474,14 @@ func (p *Provider) RegistrationHandler(rw http.ResponseWriter, req *http.Request
 		goto done
 	}
 
+	// Record client, so it can manage its registration.
+	if p.clients.Store != nil {
+		registrationAccessToken, err = p.clients.RegisterDynamic(req.Context(), cr)
+		if err != nil {
+			goto done
+		}
+	}
+
 done:
 	if err != nil {
 		switch err.(type) {
@@ -928,9 +1515,626 @@ done:
 
 		ClientRegistrationRequest: *crr,
 	}
+	if registrationAccessToken != "" {
+		response.RegistrationAccessToken = registrationAccessToken
+		response.RegistrationClientURI = p.makeRegistrationClientURI(cr.ID)
+	}
 
 	err = utils.WriteJSON(rw, http.StatusCreated, response, "")
 	if err != nil {
 		p.logger.WithError(err).Errorln("client registration request failed writing response")
 	}
 }
+
+// ClientConfigurationHandler implements the HTTP client configuration endpoint
+// to read, update and delete dynamic client registrations as specified at
+// https://tools.ietf.org/html/rfc7592#section-2
+func (p *Provider) ClientConfigurationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var cr *clients.ClientRegistration
+	var crr *payload.ClientRegistrationRequest
+	var clientSecret string
+	var found bool
+
+	policy := p.clients.RegistrationPolicy()
+	clientID := req.URL.Query().Get("client_id")
+	registrationAccessToken := getBearerToken(req)
+
+	cr, found = p.clients.GetDynamic(req.Context(), clientID, registrationAccessToken)
+	if !found {
+		p.logger.WithField("client_id", clientID).Debugln("client configuration request unauthorized")
+		konnectoidc.WriteWWWAuthenticateError(rw, http.StatusUnauthorized, konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "invalid registration access token"))
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		crr = payload.NewClientRegistrationRequest(cr)
+
+	case http.MethodPut:
+		crr, err = payload.DecodeClientRegistrationRequest(req)
+		if err != nil {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+			goto done
+		}
+		if crr.ClientID != cr.ID {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "client_id mismatch")
+			goto done
+		}
+		if crr.ClientSecret != "" {
+			if validateErr := p.clients.Validate(cr, crr.ClientSecret, "", "", false); validateErr != nil {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "client_secret mismatch")
+				goto done
+			}
+		}
+		// Updates are subject to the same software statement requirements
+		// as the registration, so the statement must be sent again.
+		err = p.applySoftwareStatement(req.Context(), policy, crr)
+		if err != nil {
+			goto done
+		}
+		err = p.validateClientRegistrationRequest(req.Context(), crr)
+		if err != nil {
+			goto done
+		}
+		cr, err = crr.ClientRegistration()
+		if err != nil {
+			goto done
+		}
+		err = p.applyRegistrationPolicy(req.Context(), policy, cr)
+		if err != nil {
+			goto done
+		}
+		crr.Scope = strings.Join(cr.Scopes, " ")
+		clientSecret, err = p.clients.UpdateDynamic(req.Context(), clientID, cr)
+		if err != nil {
+			goto done
+		}
+
+	case http.MethodDelete:
+		err = p.clients.DeleteDynamic(req.Context(), clientID)
+		if err != nil {
+			goto done
+		}
+
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with GET, PUT or DELETE")
+		goto done
+	}
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			err = utils.WriteJSON(rw, http.StatusBadRequest, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("client configuration request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("client configuration request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	if req.Method == http.MethodDelete {
+		p.logger.WithField("client_id", clientID).Debugln("deleted dynamic client")
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := &payload.ClientRegistrationResponse{
+		ClientID:     cr.ID,
+		ClientSecret: clientSecret,
+
+		ClientIDIssuedAt:      cr.IDIssuedAt,
+		ClientSecretExpiresAt: cr.SecretExpiresAt,
+
+		RegistrationAccessToken: registrationAccessToken,
+		RegistrationClientURI:   p.makeRegistrationClientURI(cr.ID),
+
+		ClientRegistrationRequest: *crr,
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("client configuration request failed writing response")
+	}
+}
+
+// DeviceAuthorizationHandler implements the HTTP device authorization endpoint
+// for the OAuth 2.0 Device Authorization Grant as specified at
+// https://tools.ietf.org/html/rfc8628#section-3.1
+func (p *Provider) DeviceAuthorizationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var dar *payload.DeviceAuthorizationRequest
+	var clientDetails *clients.Details
+	var record *device.Record
+	var deviceCode string
+	var verificationURI *url.URL
+	var verificationURIComplete *url.URL
+
+	if p.deviceManager == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	dar, err = payload.DecodeDeviceAuthorizationRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	// Device clients have no redirect URI.
+	clientDetails, err = p.clients.Lookup(req.Context(), dar.ClientID, dar.ClientSecret, &url.URL{}, "", dar.ClientAssertion != "")
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+		goto done
+	}
+	_, err = p.authenticateClient(req, dar.ClientSecret, dar.ClientAssertion, clientDetails)
+	if err != nil {
+		goto done
+	}
+	if clientDetails.Registration == nil || !clientDetails.Registration.HasGrantType(konnectoidc.GrantTypeDeviceCode) {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnauthorizedClient, "device_code not allowed for client")
+		goto done
+	}
+
+	record = &device.Record{
+		ClientID: clientDetails.ID,
+		RawScope: dar.RawScope,
+	}
+	deviceCode, err = p.deviceManager.Create(record)
+	if err != nil {
+		goto done
+	}
+
+	verificationURI, err = url.Parse(p.makeIssURL(p.deviceVerificationPath))
+	if err != nil {
+		goto done
+	}
+	verificationURIComplete, _ = url.Parse(verificationURI.String())
+	verificationURIComplete.RawQuery = url.Values{"user_code": []string{record.UserCode}}.Encode()
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			err = utils.WriteJSON(rw, http.StatusBadRequest, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("device authorization request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("device authorization request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	// Device Authorization Response
+	// https://tools.ietf.org/html/rfc8628#section-3.2
+	response := &payload.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                record.UserCode,
+		VerificationURI:         verificationURI.String(),
+		VerificationURIComplete: verificationURIComplete.String(),
+		ExpiresIn:               int64(time.Until(record.ExpiresAt).Seconds()),
+		Interval:                int64(record.Interval.Seconds()),
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("device authorization request failed writing response")
+	}
+}
+
+// IntrospectionHandler implements the HTTP token introspection endpoint as
+// specified at https://tools.ietf.org/html/rfc7662.
+func (p *Provider) IntrospectionHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var ir *payload.IntrospectionRequest
+	var clientDetails *clients.Details
+	var response *payload.IntrospectionResponse
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	ir, err = payload.DecodeIntrospectionRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	// Only confidential clients are allowed to introspect tokens, see
+	// https://tools.ietf.org/html/rfc7662#section-2.1
+	clientDetails, err = p.clients.Lookup(req.Context(), ir.ClientID, ir.ClientSecret, &url.URL{}, "", ir.ClientAssertion != "")
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+		goto done
+	}
+	_, err = p.authenticateClient(req, ir.ClientSecret, ir.ClientAssertion, clientDetails)
+	if err != nil {
+		goto done
+	}
+	if clientDetails.Registration == nil || !clientDetails.Registration.IsConfidential() {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "introspection requires a confidential client")
+		goto done
+	}
+
+	if ir.Token == "" {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing token")
+		goto done
+	}
+
+	response = p.introspectToken(req.Context(), ir.Token, ir.TokenTypeHint, clientDetails.ID)
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			err = utils.WriteJSON(rw, http.StatusBadRequest, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("introspection request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("introspection request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	err = utils.WriteJSON(rw, http.StatusOK, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("introspection request failed writing response")
+	}
+}
+
+// RevocationHandler implements the HTTP token revocation endpoint as specified
+// at https://tools.ietf.org/html/rfc7009.
+func (p *Provider) RevocationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var rr *payload.RevocationRequest
+	var clientDetails *clients.Details
+
+	if p.revocationStore == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	rr, err = payload.DecodeRevocationRequest(req, p.metadata.WellKnown)
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	clientDetails, err = p.clients.Lookup(req.Context(), rr.ClientID, rr.ClientSecret, &url.URL{}, "", rr.ClientAssertion != "")
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+		goto done
+	}
+	_, err = p.authenticateClient(req, rr.ClientSecret, rr.ClientAssertion, clientDetails)
+	if err != nil {
+		goto done
+	}
+
+	if rr.Token == "" {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "missing token")
+		goto done
+	}
+
+	// Invalid tokens and tokens of other clients are ignored, see
+	// https://tools.ietf.org/html/rfc7009#section-2.2
+	err = p.revokeToken(req.Context(), rr.Token, rr.TokenTypeHint, clientDetails.ID)
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error:
+			err = utils.WriteJSON(rw, http.StatusBadRequest, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("revocation request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("revocation request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// PushedAuthorizationRequestHandler implements the HTTP pushed authorization
+// request endpoint as specified at https://tools.ietf.org/html/rfc9126.
+func (p *Provider) PushedAuthorizationRequestHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var pr *payload.PushedAuthorizationRequest
+	var clientDetails *clients.Details
+	var record *par.Record
+	var requestURI string
+
+	if p.parManager == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	// Validate request method
+	switch req.Method {
+	case http.MethodPost:
+		// breaks
+	default:
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request must be sent with POST")
+		goto done
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	pr, err = payload.DecodePushedAuthorizationRequest(req, p.metadata.WellKnown, p.requestObjectKeyFunc(req.Context()))
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+
+	// Authenticate the client first, the redirect URI is validated below.
+	clientDetails, err = p.clients.Lookup(req.Context(), pr.ClientID, pr.ClientSecret, &url.URL{}, "", pr.ClientAssertion != "")
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+		goto done
+	}
+	_, err = p.authenticateClient(req, pr.ClientSecret, pr.ClientAssertion, clientDetails)
+	if err != nil {
+		goto done
+	}
+	if pr.AuthenticationRequest.ClientID != clientDetails.ID {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "client_id mismatch")
+		goto done
+	}
+
+	// Validate the same way as the authorization endpoint would.
+	err = pr.AuthenticationRequest.Validate(func(token *jwt.Token) (interface{}, error) {
+		// Validator for incoming IDToken hints, looks up key.
+		return p.validateJWT(token)
+	})
+	if err != nil {
+		goto done
+	}
+	_, err = p.clients.Lookup(req.Context(), pr.ClientID, pr.ClientSecret, pr.AuthenticationRequest.RedirectURI, "", pr.ClientAssertion != "")
+	if err != nil {
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, err.Error())
+		goto done
+	}
+	err = p.validateResources(req.Context(), pr.AuthenticationRequest.Resources)
+	if err != nil {
+		goto done
+	}
+	err = p.validateAuthorizationDetails(req.Context(), clientDetails.ID, pr.AuthenticationRequest.AuthorizationDetails)
+	if err != nil {
+		goto done
+	}
+
+	record = &par.Record{
+		ClientID: clientDetails.ID,
+		Values:   pr.Values,
+	}
+	requestURI, err = p.parManager.Create(record)
+	if err != nil {
+		goto done
+	}
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *konnectoidc.OAuth2Error, *payload.AuthenticationError, *payload.AuthenticationBadRequest:
+			err = utils.WriteJSON(rw, http.StatusBadRequest, err, "")
+			if err != nil {
+				p.logger.WithError(err).Errorln("pushed authorization request failed writing response")
+				return
+			}
+		default:
+			p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("pushed authorization request failed")
+			p.ErrorPage(rw, http.StatusInternalServerError, err.Error(), "well sorry, but there was a problem")
+		}
+
+		return
+	}
+
+	// Pushed Authorization Response
+	// https://tools.ietf.org/html/rfc9126#section-2.2
+	response := &payload.PushedAuthorizationResponse{
+		RequestURI: requestURI,
+		ExpiresIn:  int64(time.Until(record.ExpiresAt).Seconds()),
+	}
+
+	err = utils.WriteJSON(rw, http.StatusCreated, response, "")
+	if err != nil {
+		p.logger.WithError(err).Errorln("pushed authorization request failed writing response")
+	}
+}
+
+// DeviceVerificationHandler implements the user interaction of the OAuth 2.0
+// Device Authorization Grant as specified at https://tools.ietf.org/html/rfc8628#section-3.3.
+// It is served at the authorization endpoint for requests with an user_code
+// parameter, so that the sign-in and consent flows of the identity managers
+// continue there.
+func (p *Provider) DeviceVerificationHandler(rw http.ResponseWriter, req *http.Request) {
+	var err error
+	var ar *payload.AuthenticationRequest
+	var auth identity.AuthRecord
+	var session *payload.Session
+	var query url.Values
+	var result string
+
+	userCode := req.Form.Get("user_code")
+	record, found := p.deviceManager.Get(userCode)
+	if !found {
+		result = "invalid"
+		goto done
+	}
+
+	// Replace the request parameters with the values of the device
+	// authorization request, so they are retained when the identity manager
+	// redirects to its sign-in or consent flow and back.
+	query = req.URL.Query()
+	for _, key := range []string{"redirect_uri", "request", "request_uri", "registration", "claims", "response_mode", "id_token_hint", "prompt"} {
+		query.Del(key)
+	}
+	query.Set("user_code", record.UserCode)
+	query.Set("client_id", record.ClientID)
+	query.Set("scope", record.RawScope)
+	query.Set("response_type", oidc.ResponseTypeCode)
+	// Always let the user confirm the device, even for trusted clients, so
+	// a verification_uri_complete link cannot approve a device silently as
+	// described at https://tools.ietf.org/html/rfc8628#section-5.4
+	query.Set("prompt", oidc.PromptConsent)
+	req.URL.RawQuery = query.Encode()
+	req.Form = query
+
+	ar, err = payload.NewAuthenticationRequest(query, p.metadata.WellKnown, nil)
+	if err != nil {
+		goto done
+	}
+	// Devices do not receive a redirect, validate with the verification URI
+	// and clear it afterwards, so it is not checked against the redirect URIs
+	// of the client registration.
+	ar.RedirectURI, _ = url.Parse(p.makeIssURL(p.deviceVerificationPath))
+	err = ar.Validate(nil)
+	if err != nil {
+		goto done
+	}
+	ar.RedirectURI = &url.URL{}
+
+	// Inject implicit scopes set by client registration.
+	if registration, _ := p.clients.Get(req.Context(), ar.ClientID); registration != nil {
+		err = registration.ApplyImplicitScopes(ar.Scopes)
+		if err != nil {
+			p.logger.WithError(err).Debugln("failed to apply implicit scopes")
+		}
+	}
+
+	// Find session if any, ignoring errors.
+	ar.Session, err = p.getSession(req)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to decode client session")
+	}
+
+	auth, err = p.identityManager.Authenticate(req.Context(), rw, req, ar, p.guestManager)
+	if err != nil {
+		goto done
+	}
+
+	auth, err = auth.Manager().Authorize(req.Context(), rw, req, ar, auth)
+	if err != nil {
+		goto done
+	}
+
+	session, err = p.updateOrCreateSession(rw, req, ar, auth)
+	if err != nil {
+		goto done
+	}
+
+	err = p.deviceManager.Approve(record.UserCode, &code.Record{
+		AuthenticationRequest: ar,
+		Auth:                  auth,
+		Session:               session,
+	})
+	if err != nil {
+		result = "invalid"
+		err = nil
+		goto done
+	}
+	result = "approved"
+
+done:
+	if err != nil {
+		switch err.(type) {
+		case *identity.RedirectError:
+			p.Found(rw, err.(*identity.RedirectError).RedirectURI(), nil, false)
+			return
+		case *identity.LoginRequiredError:
+			p.LoginRequiredPage(rw, req, err.(*identity.LoginRequiredError).SignInURI())
+			return
+		case *identity.IsHandledError:
+			// do nothing
+			return
+		default:
+			if err.Error() != oidc.ErrorCodeOAuth2AccessDenied {
+				p.logger.WithFields(utils.ErrorAsFields(err)).Errorln("device verification request failed")
+				p.ErrorPage(rw, http.StatusBadRequest, err.Error(), "well sorry, but there was a problem")
+				return
+			}
+			// Denied by the user.
+			if denyErr := p.deviceManager.Deny(record.UserCode); denyErr != nil {
+				p.logger.WithError(denyErr).Debugln("failed to deny device authorization")
+			}
+			result = "denied"
+		}
+	}
+
+	// Redirect back to the verification page to show the result.
+	uri, _ := url.Parse(p.makeIssURL(p.deviceVerificationPath))
+	p.Found(rw, uri, &struct {
+		Result string `url:"result"`
+	}{result}, false)
+}
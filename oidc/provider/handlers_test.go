@@ -18,14 +18,45 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"io"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/libregraph/oidc-go"
+	"github.com/longsleep/rndm"
+	"github.com/mendsley/gojwk"
+
+	konnect "github.com/libregraph/lico"
+	"github.com/libregraph/lico/identity"
+	"github.com/libregraph/lico/identity/authorities"
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/oidc/par"
+	"github.com/libregraph/lico/oidc/payload"
 )
 
 func TestWellKnownHandler(t *testing.T) {
@@ -106,3 +137,3040 @@ func TestWellKnownHandler(t *testing.T) {
 		t.Errorf("IDTokenSigningAlgValuesSupported must not be empty")
 	}
 }
+
+func TestMetadataHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	getMetadata := func() *AuthorizationServerMetadata {
+		req, err := http.NewRequest(http.MethodGet, config.MetadataPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+
+		metadata := &AuthorizationServerMetadata{WellKnown: &WellKnown{WellKnown: &oidc.WellKnown{}}}
+		if err := json.Unmarshal(rr.Body.Bytes(), metadata); err != nil {
+			t.Fatal(err)
+		}
+		return metadata
+	}
+
+	metadata := getMetadata()
+	if metadata.Issuer != config.IssuerIdentifier {
+		t.Errorf("Issuer identifier was incorrect, got %s, want %s", metadata.Issuer, config.IssuerIdentifier)
+	}
+	if metadata.TokenEndpoint != provider.makeIssURL(config.TokenPath) {
+		t.Errorf("TokenEndpoint was incorrect, got %s, want %s", metadata.TokenEndpoint, provider.makeIssURL(config.TokenPath))
+	}
+	if metadata.IntrospectionEndpoint != provider.makeIssURL(config.IntrospectionPath) {
+		t.Errorf("IntrospectionEndpoint was incorrect, got %s, want %s", metadata.IntrospectionEndpoint, provider.makeIssURL(config.IntrospectionPath))
+	}
+	if metadata.RevocationEndpoint != provider.makeIssURL(config.RevocationPath) {
+		t.Errorf("RevocationEndpoint was incorrect, got %s, want %s", metadata.RevocationEndpoint, provider.makeIssURL(config.RevocationPath))
+	}
+	for _, method := range []string{oidc.AuthMethodClientSecretBasic, oidc.AuthMethodClientSecretJWT, oidc.AuthMethodPrivateKeyJWT} {
+		if !containsString(metadata.IntrospectionEndpointAuthMethodsSupported, method) {
+			t.Errorf("IntrospectionEndpointAuthMethodsSupported must contain %s, got %v", method, metadata.IntrospectionEndpointAuthMethodsSupported)
+		}
+		if !containsString(metadata.RevocationEndpointAuthMethodsSupported, method) {
+			t.Errorf("RevocationEndpointAuthMethodsSupported must contain %s, got %v", method, metadata.RevocationEndpointAuthMethodsSupported)
+		}
+	}
+	if containsString(metadata.IntrospectionEndpointAuthMethodsSupported, oidc.AuthMethodNone) {
+		t.Errorf("IntrospectionEndpointAuthMethodsSupported must not contain %s", oidc.AuthMethodNone)
+	}
+	if len(metadata.CodeChallengeMethodsSupported) != 2 || metadata.CodeChallengeMethodsSupported[0] != oidc.S256CodeChallengeMethod {
+		t.Errorf("CodeChallengeMethodsSupported was incorrect, got %v", metadata.CodeChallengeMethodsSupported)
+	}
+	if metadata.SignedMetadata != "" {
+		t.Errorf("SignedMetadata must be empty when not enabled")
+	}
+
+	// Without TLS listener or trusted proxies, no client certificates can
+	// arrive, so mutual TLS must not be advertised.
+	if metadata.TLSClientCertificateBoundAccessTokens {
+		t.Errorf("TLSClientCertificateBoundAccessTokens must not be advertised without client certificates")
+	}
+	if containsString(metadata.TokenEndpointAuthMethodsSupported, konnectoidc.AuthMethodSelfSignedTLSClientAuth) {
+		t.Errorf("TokenEndpointAuthMethodsSupported must not contain %s without client certificates", konnectoidc.AuthMethodSelfSignedTLSClientAuth)
+	}
+
+	proxyIP := net.ParseIP("192.0.2.1")
+	provider.Config.Config.TrustedProxyIPs = []*net.IP{&proxyIP}
+	provider.Config.SignedMetadata = true
+	if err := provider.InitializeMetadata(); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata = getMetadata()
+	if metadata.SignedMetadata == "" {
+		t.Fatalf("SignedMetadata must not be empty when enabled")
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(metadata.SignedMetadata, claims, func(token *jwt.Token) (interface{}, error) {
+		return provider.validateJWT(token)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if claims[oidc.IssuerIdentifierClaim] != config.IssuerIdentifier {
+		t.Errorf("signed metadata issuer was incorrect, got %v, want %s", claims[oidc.IssuerIdentifierClaim], config.IssuerIdentifier)
+	}
+	if claims["token_endpoint"] != metadata.TokenEndpoint {
+		t.Errorf("signed metadata token_endpoint was incorrect, got %v, want %s", claims["token_endpoint"], metadata.TokenEndpoint)
+	}
+	if !metadata.TLSClientCertificateBoundAccessTokens || !containsString(metadata.TokenEndpointAuthMethodsSupported, konnectoidc.AuthMethodSelfSignedTLSClientAuth) {
+		t.Errorf("mutual TLS must be advertised with trusted proxies")
+	}
+}
+
+func TestTokenHandlerClientCredentials(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:         "service",
+		Secret:     "secret",
+		GrantTypes: []string{konnectoidc.GrantTypeClientCredentials},
+		Scopes:     []string{"scope-a", "scope-b"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "public",
+		RedirectURIs: []string{"https://example.com/callback"},
+		GrantTypes:   []string{konnectoidc.GrantTypeClientCredentials},
+		Scopes:       []string{"scope-a"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clientID     string
+		clientSecret string
+		scope        string
+		status       int
+		errorID      string
+		scopes       []string
+	}{
+		{"service", "secret", "", http.StatusOK, "", []string{"scope-a", "scope-b"}},
+		{"service", "secret", "scope-b", http.StatusOK, "", []string{"scope-b"}},
+		{"service", "secret", "scope-c", http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2InvalidScope, nil},
+		{"service", "wrong", "", http.StatusBadRequest, oidc.ErrorCodeOAuth2AccessDenied, nil},
+		{"public", "", "", http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2UnauthorizedClient, nil},
+	}
+
+	for _, test := range tests {
+		values := url.Values{}
+		values.Set("grant_type", konnectoidc.GrantTypeClientCredentials)
+		if test.scope != "" {
+			values.Set("scope", test.scope)
+		}
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(test.clientID, test.clientSecret)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Fatalf("handler returned wrong status code for %s: got %v want %v", test.clientID, status, test.status)
+		}
+
+		if test.errorID != "" {
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if oauth2Error.ErrorID != test.errorID {
+				t.Errorf("error was incorrect, got %s, want %s", oauth2Error.ErrorID, test.errorID)
+			}
+			continue
+		}
+
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		if response.RefreshToken != "" || response.IDToken != "" {
+			t.Errorf("only an access token must be issued")
+		}
+
+		claims := &konnect.AccessTokenClaims{}
+		if _, err := jwt.ParseWithClaims(response.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return provider.validateJWT(token)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != test.clientID {
+			t.Errorf("subject was incorrect, got %s, want %s", claims.Subject, test.clientID)
+		}
+		authorizedScopes := claims.AuthorizedScopes()
+		if len(authorizedScopes) != len(test.scopes) {
+			t.Errorf("scopes were incorrect, got %v, want %v", claims.AuthorizedScopesList, test.scopes)
+		}
+		for _, scope := range test.scopes {
+			if !authorizedScopes[scope] {
+				t.Errorf("scope %s missing, got %v", scope, claims.AuthorizedScopesList)
+			}
+		}
+	}
+}
+
+func TestDeviceAuthorizationHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:              "device",
+		ApplicationType: oidc.ApplicationTypeNative,
+		GrantTypes:      []string{konnectoidc.GrantTypeDeviceCode},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path string, values url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post(config.DeviceAuthorizationPath, url.Values{"client_id": {"device"}, "scope": {"openid"}})
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	response := &payload.DeviceAuthorizationResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if response.DeviceCode == "" || response.UserCode == "" {
+		t.Fatalf("device_code and user_code must not be empty")
+	}
+	if response.VerificationURI != provider.makeIssURL(config.DeviceVerificationPath) {
+		t.Errorf("VerificationURI was incorrect, got %s, want %s", response.VerificationURI, provider.makeIssURL(config.DeviceVerificationPath))
+	}
+
+	// Polling without approval.
+	for _, errorID := range []string{konnectoidc.ErrorCodeOAuth2AuthorizationPending, konnectoidc.ErrorCodeOAuth2SlowDown} {
+		rr = post(config.TokenPath, url.Values{"grant_type": {konnectoidc.GrantTypeDeviceCode}, "client_id": {"device"}, "device_code": {response.DeviceCode}})
+		oauth2Error := &konnectoidc.OAuth2Error{}
+		if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+			t.Fatal(err)
+		}
+		if oauth2Error.ErrorID != errorID {
+			t.Errorf("error was incorrect, got %s, want %s", oauth2Error.ErrorID, errorID)
+		}
+	}
+
+	// Verification always requires consent, so the device is not approved
+	// without user interaction.
+	for _, prompt := range []string{"", oidc.PromptNone} {
+		values := url.Values{"user_code": {response.UserCode}}
+		if prompt != "" {
+			values.Set("prompt", prompt)
+		}
+		req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if strings.Contains(rr.Header().Get("Location"), "result=approved") {
+			t.Errorf("device was approved without consent with prompt %#v", prompt)
+		}
+	}
+	if _, err := provider.deviceManager.Poll(response.DeviceCode); err == nil {
+		t.Errorf("device must not be approved without consent")
+	}
+
+	// Unregistered grant type.
+	rr = post(config.DeviceAuthorizationPath, url.Values{"client_id": {"unknown"}})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for unknown client: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestTokenHandlerTokenExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:         "service",
+			Secret:     "secret",
+			GrantTypes: []string{konnectoidc.GrantTypeClientCredentials, konnectoidc.GrantTypeTokenExchange},
+			Scopes:     []string{"scope-a", "scope-b"},
+		},
+		{
+			ID:         "gateway",
+			Secret:     "secret",
+			GrantTypes: []string{konnectoidc.GrantTypeClientCredentials, konnectoidc.GrantTypeTokenExchange},
+		},
+		{
+			ID:         "backend",
+			Secret:     "secret",
+			GrantTypes: []string{konnectoidc.GrantTypeClientCredentials},
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requestTokenWithProof := func(clientID string, values url.Values, proof string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, "secret")
+		if proof != "" {
+			req.Header.Set(konnectoidc.DPoPHeader, proof)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	requestToken := func(clientID string, values url.Values) *httptest.ResponseRecorder {
+		return requestTokenWithProof(clientID, values, "")
+	}
+	parseToken := func(rr *httptest.ResponseRecorder) (*payload.TokenSuccess, *konnect.AccessTokenClaims) {
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body.String())
+		}
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		claims := &konnect.AccessTokenClaims{}
+		if _, err := jwt.ParseWithClaims(response.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return provider.validateJWT(token)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return response, claims
+	}
+
+	serviceResponse, _ := parseToken(requestToken("service", url.Values{
+		"grant_type": {konnectoidc.GrantTypeClientCredentials},
+	}))
+	// Subject tokens must be issued to the client which exchanges them.
+	subjectResponse, _ := parseToken(requestToken("service", url.Values{
+		"grant_type":         {konnectoidc.GrantTypeTokenExchange},
+		"subject_token":      {serviceResponse.AccessToken},
+		"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+		"audience":           {"gateway"},
+	}))
+	actorResponse, _ := parseToken(requestToken("gateway", url.Values{
+		"grant_type": {konnectoidc.GrantTypeClientCredentials},
+	}))
+
+	tests := []struct {
+		clientID string
+		values   url.Values
+		errorID  string
+	}{
+		{"gateway", url.Values{
+			"subject_token":      {subjectResponse.AccessToken},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+			"actor_token":        {actorResponse.AccessToken},
+			"actor_token_type":   {konnectoidc.TokenTypeIdentifierAccessToken},
+			"audience":           {"backend"},
+			"scope":              {"scope-a"},
+		}, ""},
+		{"gateway", url.Values{
+			"subject_token":      {subjectResponse.AccessToken},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+			"scope":              {"scope-c"},
+		}, konnectoidc.ErrorCodeOAuth2InvalidScope},
+		{"gateway", url.Values{
+			"subject_token":      {subjectResponse.AccessToken},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+			"audience":           {"unknown"},
+		}, konnectoidc.ErrorCodeOAuth2InvalidTarget},
+		{"gateway", url.Values{
+			"subject_token":      {serviceResponse.AccessToken},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+		}, oidc.ErrorCodeOAuth2InvalidGrant},
+		{"gateway", url.Values{
+			"subject_token":      {"invalid"},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+		}, oidc.ErrorCodeOAuth2InvalidGrant},
+		{"gateway", url.Values{
+			"subject_token": {subjectResponse.AccessToken},
+		}, oidc.ErrorCodeOAuth2InvalidRequest},
+		{"backend", url.Values{
+			"subject_token":      {subjectResponse.AccessToken},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+		}, konnectoidc.ErrorCodeOAuth2UnauthorizedClient},
+	}
+
+	for idx, test := range tests {
+		test.values.Set("grant_type", konnectoidc.GrantTypeTokenExchange)
+		rr := requestToken(test.clientID, test.values)
+
+		if test.errorID != "" {
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code for test %d: got %v want %v", idx, status, http.StatusBadRequest)
+			}
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if oauth2Error.ErrorID != test.errorID {
+				t.Errorf("error was incorrect for test %d, got %s, want %s", idx, oauth2Error.ErrorID, test.errorID)
+			}
+			continue
+		}
+
+		response, claims := parseToken(rr)
+		if response.IssuedTokenType != konnectoidc.TokenTypeIdentifierAccessToken {
+			t.Errorf("issued_token_type was incorrect, got %s", response.IssuedTokenType)
+		}
+		if response.Scope != "scope-a" {
+			t.Errorf("scope was incorrect, got %s, want scope-a", response.Scope)
+		}
+		if claims.Subject != "service" {
+			t.Errorf("subject was incorrect, got %s, want service", claims.Subject)
+		}
+		if !claims.VerifyAudience("backend", true) {
+			t.Errorf("audience was incorrect, got %v, want backend", claims.Audience)
+		}
+		if claims.Actor == nil || claims.Actor.Subject != "gateway" {
+			t.Errorf("actor was incorrect, got %v, want gateway", claims.Actor)
+		}
+	}
+
+	// Sender-constrained subject tokens require proof of possession and the
+	// issued token stays bound.
+	dpopKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenURI := provider.makeIssURL(config.TokenPath)
+	boundSubject, boundClaims := parseToken(requestTokenWithProof("service", url.Values{
+		"grant_type": {konnectoidc.GrantTypeClientCredentials},
+	}, makeTestDPoPProof(t, dpopKey, http.MethodPost, tokenURI, "")))
+	if boundClaims.Confirmation == nil || boundClaims.Confirmation.JKT == "" {
+		t.Fatalf("subject token must be bound")
+	}
+	for idx, proofKey := range []*ecdsa.PrivateKey{nil, otherKey} {
+		proof := ""
+		if proofKey != nil {
+			proof = makeTestDPoPProof(t, proofKey, http.MethodPost, tokenURI, "")
+		}
+		rr := requestTokenWithProof("service", url.Values{
+			"grant_type":         {konnectoidc.GrantTypeTokenExchange},
+			"subject_token":      {boundSubject.AccessToken},
+			"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+		}, proof)
+		oauth2Error := &konnectoidc.OAuth2Error{}
+		if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil || oauth2Error.ErrorID != konnectoidc.ErrorCodeOAuth2InvalidDPoPProof {
+			t.Errorf("exchange of bound subject token %d without proof of possession must fail, got %v %s", idx, rr.Code, rr.Body.String())
+		}
+	}
+	_, exchangedClaims := parseToken(requestTokenWithProof("service", url.Values{
+		"grant_type":         {konnectoidc.GrantTypeTokenExchange},
+		"subject_token":      {boundSubject.AccessToken},
+		"subject_token_type": {konnectoidc.TokenTypeIdentifierAccessToken},
+	}, makeTestDPoPProof(t, dpopKey, http.MethodPost, tokenURI, "")))
+	if exchangedClaims.Confirmation == nil || exchangedClaims.Confirmation.JKT != boundClaims.Confirmation.JKT {
+		t.Errorf("exchanged token must be bound to the subject token key, got %v", exchangedClaims.Confirmation)
+	}
+}
+
+func TestTokenHandlerJWTBearer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	// Create trusted issuer with static keys.
+	assertionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryData, err := json.Marshal(map[string]interface{}{
+		"authorities": []interface{}{
+			map[string]interface{}{
+				"id":             "ci",
+				"authority_type": authorities.AuthorityTypeJWTBearer,
+				"iss":            "https://ci.example.com",
+				"client_id":      "workloads",
+				"scopes":         []string{"scope-a", "scope-b"},
+				"jwks": &jose.JSONWebKeySet{
+					Keys: []jose.JSONWebKey{{
+						Key:   assertionKey.Public(),
+						KeyID: "ci-key",
+						Use:   "sig",
+					}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryFile, err := ioutil.TempFile("", "lico-authorities-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(registryFile.Name())
+	if _, err := registryFile.Write(registryData); err != nil {
+		t.Fatal(err)
+	}
+	registryFile.Close()
+	provider.authorities, err = authorities.NewRegistry(ctx, nil, registryFile.Name(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:         "workloads",
+			GrantTypes: []string{konnectoidc.GrantTypeJWTBearer},
+		},
+		{
+			ID:         "other",
+			GrantTypes: []string{konnectoidc.GrantTypeJWTBearer},
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signAssertion := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "ci-key"
+		assertion, err := token.SignedString(assertionKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return assertion
+	}
+	makeAssertion := func(iss string, aud string, jti string) string {
+		return signAssertion(jwt.MapClaims{
+			"iss": iss,
+			"sub": "system:serviceaccount:default:backup",
+			"aud": aud,
+			"jti": jti,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+	}
+	makeLongLivedAssertion := func(jti string, iat time.Time, exp time.Time) string {
+		return signAssertion(jwt.MapClaims{
+			"iss": "https://ci.example.com",
+			"sub": "system:serviceaccount:default:backup",
+			"aud": config.IssuerIdentifier,
+			"jti": jti,
+			"iat": iat.Unix(),
+			"exp": exp.Unix(),
+		})
+	}
+
+	assertion := makeAssertion("https://ci.example.com", config.IssuerIdentifier, "jti-1")
+
+	tests := []struct {
+		clientID  string
+		assertion string
+		scope     string
+		errorID   string
+	}{
+		{"workloads", assertion, "scope-a", ""},
+		{"workloads", assertion, "", oidc.ErrorCodeOAuth2InvalidGrant},
+		{"workloads", makeAssertion("https://ci.example.com", provider.makeIssURL(config.TokenPath), "jti-2"), "scope-c", konnectoidc.ErrorCodeOAuth2InvalidScope},
+		{"workloads", makeAssertion("https://ci.example.com", "https://other.example.com", "jti-3"), "", oidc.ErrorCodeOAuth2InvalidGrant},
+		{"workloads", makeAssertion("https://unknown.example.com", config.IssuerIdentifier, "jti-4"), "", oidc.ErrorCodeOAuth2InvalidGrant},
+		{"workloads", makeAssertion("https://ci.example.com", config.IssuerIdentifier, ""), "", oidc.ErrorCodeOAuth2InvalidGrant},
+		{"other", makeAssertion("https://ci.example.com", config.IssuerIdentifier, "jti-5"), "", konnectoidc.ErrorCodeOAuth2UnauthorizedClient},
+		{"workloads", makeLongLivedAssertion("jti-6", time.Now(), time.Now().Add(24*time.Hour)), "", oidc.ErrorCodeOAuth2InvalidGrant},
+		{"workloads", makeLongLivedAssertion("jti-7", time.Now().Add(-time.Hour), time.Now().Add(time.Minute)), "", oidc.ErrorCodeOAuth2InvalidGrant},
+		{"workloads", makeLongLivedAssertion("jti-8", time.Now().Add(time.Hour), time.Now().Add(time.Minute)), "", oidc.ErrorCodeOAuth2InvalidGrant},
+	}
+
+	for idx, test := range tests {
+		values := url.Values{}
+		values.Set("grant_type", konnectoidc.GrantTypeJWTBearer)
+		values.Set("client_id", test.clientID)
+		values.Set("assertion", test.assertion)
+		if test.scope != "" {
+			values.Set("scope", test.scope)
+		}
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if test.errorID != "" {
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code for test %d: got %v want %v", idx, status, http.StatusBadRequest)
+			}
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if oauth2Error.ErrorID != test.errorID {
+				t.Errorf("error was incorrect for test %d, got %s, want %s", idx, oauth2Error.ErrorID, test.errorID)
+			}
+			continue
+		}
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code for test %d: got %v want %v: %s", idx, status, http.StatusOK, rr.Body.String())
+		}
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		claims := &konnect.AccessTokenClaims{}
+		if _, err := jwt.ParseWithClaims(response.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return provider.validateJWT(token)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "system:serviceaccount:default:backup" {
+			t.Errorf("subject was incorrect, got %s", claims.Subject)
+		}
+		if len(claims.AuthorizedScopesList) != 1 || claims.AuthorizedScopesList[0] != test.scope {
+			t.Errorf("scopes were incorrect, got %v, want %s", claims.AuthorizedScopesList, test.scope)
+		}
+	}
+}
+
+func TestIntrospectionHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:         "service",
+			Secret:     "secret",
+			GrantTypes: []string{konnectoidc.GrantTypeClientCredentials, konnectoidc.GrantTypeTokenExchange},
+			Scopes:     []string{"scope-a", "scope-b"},
+		},
+		{
+			ID:           "public",
+			RedirectURIs: []string{"https://example.com/callback"},
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accessTokenString, err := provider.makeAccessToken(ctx, "service", identity.NewAuthRecord(nil, "service", map[string]bool{"scope-a": true}, nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clientID     string
+		clientSecret string
+		token        string
+		errorID      string
+		active       bool
+	}{
+		{"service", "secret", accessTokenString, "", true},
+		{"service", "secret", "invalid", "", false},
+		{"service", "secret", "", oidc.ErrorCodeOAuth2InvalidRequest, false},
+		{"service", "wrong", accessTokenString, konnectoidc.ErrorCodeOAuth2InvalidClient, false},
+		{"public", "", accessTokenString, konnectoidc.ErrorCodeOAuth2InvalidClient, false},
+	}
+
+	for idx, test := range tests {
+		values := url.Values{}
+		values.Set("token", test.token)
+		req, err := http.NewRequest(http.MethodPost, config.IntrospectionPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(test.clientID, test.clientSecret)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if test.errorID != "" {
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code for test %d: got %v want %v", idx, status, http.StatusBadRequest)
+			}
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if oauth2Error.ErrorID != test.errorID {
+				t.Errorf("error was incorrect for test %d, got %s, want %s", idx, oauth2Error.ErrorID, test.errorID)
+			}
+			continue
+		}
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code for test %d: got %v want %v", idx, status, http.StatusOK)
+		}
+		response := &payload.IntrospectionResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Active != test.active {
+			t.Errorf("active was incorrect for test %d, got %v, want %v", idx, response.Active, test.active)
+		}
+		if !test.active {
+			continue
+		}
+		if response.Subject != "service" || response.ClientID != "service" || response.Scope != "scope-a" || response.ExpiresAt == 0 {
+			t.Errorf("response was incorrect for test %d, got %+v", idx, response)
+		}
+	}
+}
+
+func TestRevocationHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:         "service",
+			Secret:     "secret",
+			GrantTypes: []string{konnectoidc.GrantTypeClientCredentials},
+		},
+		{
+			ID:         "other",
+			Secret:     "secret",
+			GrantTypes: []string{konnectoidc.GrantTypeClientCredentials},
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auth := identity.NewAuthRecord(provider.identityManager, "service", map[string]bool{"scope-a": true}, nil, nil)
+	accessTokenString, err := provider.makeAccessToken(ctx, "service", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshTokenString, err := provider.makeRefreshToken(ctx, "service", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoke := func(clientID string, token string, tokenTypeHint string) {
+		values := url.Values{}
+		values.Set("token", token)
+		values.Set("token_type_hint", tokenTypeHint)
+		req, err := http.NewRequest(http.MethodPost, config.RevocationPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, "secret")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+	}
+	isActive := func(token string) bool {
+		return provider.introspectToken(ctx, token, "", "service").Active
+	}
+
+	// Tokens of other clients are ignored.
+	revoke("other", accessTokenString, payload.TokenTypeHintAccessToken)
+	revoke("other", refreshTokenString, payload.TokenTypeHintRefreshToken)
+	if !isActive(accessTokenString) || !isActive(refreshTokenString) {
+		t.Fatal("tokens must still be active after revocation by other client")
+	}
+
+	// Invalid tokens are ignored.
+	revoke("service", "invalid", "")
+
+	revoke("service", accessTokenString, payload.TokenTypeHintAccessToken)
+	if isActive(accessTokenString) {
+		t.Error("access token must not be active after revocation")
+	}
+	req, _ := http.NewRequest(http.MethodGet, config.UserInfoPath, nil)
+	req.Header.Set("Authorization", "Bearer "+accessTokenString)
+	if _, err := provider.GetAccessTokenClaimsFromRequest(req); err == nil {
+		t.Error("revoked access token must not be accepted")
+	}
+
+	if !isActive(refreshTokenString) {
+		t.Fatal("refresh token must still be active after revocation of access token")
+	}
+
+	revoke("service", refreshTokenString, "")
+	if isActive(refreshTokenString) {
+		t.Error("refresh token must not be active after revocation")
+	}
+
+	// Access tokens issued with a refresh token are revoked together with it.
+	userAuth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userAuth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+	refreshTokenString, err = provider.makeRefreshToken(ctx, "service", userAuth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("grant_type", oidc.GrantTypeRefreshToken)
+	values.Set("refresh_token", refreshTokenString)
+	req, _ = http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("service", "secret")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("refresh returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body.String())
+	}
+	response := &payload.TokenSuccess{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if !isActive(response.AccessToken) {
+		t.Fatal("refreshed access token must be active")
+	}
+
+	revoke("service", refreshTokenString, "")
+	if isActive(response.AccessToken) {
+		t.Error("refreshed access token must not be active after revocation of refresh token")
+	}
+	req, _ = http.NewRequest(http.MethodGet, config.UserInfoPath, nil)
+	req.Header.Set("Authorization", "Bearer "+response.AccessToken)
+	if _, err := provider.GetAccessTokenClaimsFromRequest(req); err == nil {
+		t.Error("access token of revoked refresh token must not be accepted")
+	}
+}
+
+func TestTokenHandlerRefreshTokenRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                  "app",
+		RedirectURIs:        []string{"https://example.com/callback"},
+		RotateRefreshTokens: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+	refreshTokenString, err := provider.makeRefreshToken(ctx, "app", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(refreshToken string) (*payload.TokenSuccess, *konnectoidc.OAuth2Error) {
+		values := url.Values{}
+		values.Set("grant_type", oidc.GrantTypeRefreshToken)
+		values.Set("client_id", "app")
+		values.Set("refresh_token", refreshToken)
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatalf("failed to parse error response %s: %v", rr.Body.String(), err)
+			}
+			return nil, oauth2Error
+		}
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		return response, nil
+	}
+
+	response, oauth2Error := refresh(refreshTokenString)
+	if oauth2Error != nil {
+		t.Fatalf("refresh failed: %v", oauth2Error)
+	}
+	if response.RefreshToken == "" || response.RefreshToken == refreshTokenString {
+		t.Fatal("refresh must return a new refresh token")
+	}
+	rotatedRefreshTokenString := response.RefreshToken
+	rotatedAccessTokenString := response.AccessToken
+
+	response, oauth2Error = refresh(rotatedRefreshTokenString)
+	if oauth2Error != nil {
+		t.Fatalf("refresh with rotated token failed: %v", oauth2Error)
+	}
+	latestRefreshTokenString := response.RefreshToken
+
+	// Reuse of a rotated token revokes the whole family.
+	if _, oauth2Error = refresh(refreshTokenString); oauth2Error == nil || oauth2Error.ErrorID != oidc.ErrorCodeOAuth2InvalidGrant {
+		t.Fatalf("reuse of rotated refresh token must fail with invalid_grant, got %v", oauth2Error)
+	}
+	if _, oauth2Error = refresh(latestRefreshTokenString); oauth2Error == nil || oauth2Error.ErrorID != oidc.ErrorCodeOAuth2InvalidGrant {
+		t.Fatalf("refresh token of revoked family must fail with invalid_grant, got %v", oauth2Error)
+	}
+	if provider.introspectToken(ctx, rotatedAccessTokenString, "", "app").Active {
+		t.Fatal("access token of revoked family must not be active")
+	}
+
+	// Concurrent use of the same refresh token, only one request must win and
+	// the others are detected as reuse.
+	refreshTokenString, err = provider.makeRefreshToken(ctx, "app", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	results := make(chan *payload.TokenSuccess, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, _ := refresh(refreshTokenString)
+			results <- response
+		}()
+	}
+	wg.Wait()
+	close(results)
+	succeeded := 0
+	for response := range results {
+		if response != nil {
+			succeeded++
+			latestRefreshTokenString = response.RefreshToken
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("exactly one concurrent refresh must succeed, got %d", succeeded)
+	}
+	if _, oauth2Error = refresh(latestRefreshTokenString); oauth2Error == nil || oauth2Error.ErrorID != oidc.ErrorCodeOAuth2InvalidGrant {
+		t.Fatalf("refresh token of family with concurrent reuse must fail with invalid_grant, got %v", oauth2Error)
+	}
+}
+
+func TestPushedAuthorizationRequestHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:              "pushing",
+		Secret:          "secret",
+		ApplicationType: oidc.ApplicationTypeWeb,
+		RedirectURIs:    []string{"https://app.example.com/cb"},
+
+		RequirePushedAuthorizationRequests: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(clientSecret string, values url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, config.PushedAuthorizationRequestPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("pushing", clientSecret)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	authorize := func(values url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	authorizationRequest := url.Values{
+		"response_type": {oidc.ResponseTypeCode},
+		"scope":         {oidc.ScopeOpenID},
+		"redirect_uri":  {"https://app.example.com/cb"},
+		"state":         {"pushed-state"},
+	}
+
+	for _, test := range []struct {
+		name         string
+		clientSecret string
+		values       url.Values
+		errorID      string
+	}{
+		{"wrong secret", "wrong", authorizationRequest, konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"unregistered redirect_uri", "secret", url.Values{"response_type": {oidc.ResponseTypeCode}, "redirect_uri": {"https://evil.example.com/cb"}}, oidc.ErrorCodeOAuth2InvalidRequest},
+		{"with request_uri", "secret", url.Values{"response_type": {oidc.ResponseTypeCode}, "request_uri": {"https://app.example.com/request"}}, oidc.ErrorCodeOAuth2InvalidRequest},
+		{"unsupported response_type", "secret", url.Values{"response_type": {"unknown"}, "redirect_uri": {"https://app.example.com/cb"}}, oidc.ErrorCodeOAuth2UnsupportedResponseType},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := push(test.clientSecret, test.values)
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+			}
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if oauth2Error.ErrorID != test.errorID {
+				t.Errorf("error was incorrect, got %s, want %s", oauth2Error.ErrorID, test.errorID)
+			}
+		})
+	}
+
+	// Client requires pushed authorization requests.
+	direct := url.Values{"client_id": {"pushing"}}
+	for key, value := range authorizationRequest {
+		direct[key] = value
+	}
+	if rr := authorize(direct); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for direct request: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr := push("secret", authorizationRequest)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	response := &payload.PushedAuthorizationResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(response.RequestURI, par.RequestURIPrefix) {
+		t.Errorf("request_uri was incorrect, got %s", response.RequestURI)
+	}
+	if response.ExpiresIn <= 0 {
+		t.Errorf("expires_in was incorrect, got %d", response.ExpiresIn)
+	}
+
+	// Request URI is bound to the client.
+	if rr := authorize(url.Values{"client_id": {"other"}, "request_uri": {response.RequestURI}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for other client: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = authorize(url.Values{"client_id": {"pushing"}, "request_uri": {response.RequestURI}})
+	if status := rr.Code; status != http.StatusFound {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusFound)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Host != "app.example.com" || location.Query().Get("code") == "" {
+		t.Errorf("authorize response was incorrect, got %s", location)
+	}
+	if state := location.Query().Get("state"); state != "pushed-state" {
+		t.Errorf("state was incorrect, got %s, want %s", state, "pushed-state")
+	}
+
+	// Request URI can only be used once.
+	if rr := authorize(url.Values{"client_id": {"pushing"}, "request_uri": {response.RequestURI}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for used request_uri: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// The pushed prompt cannot be removed in the front channel, only the
+	// return from the sign-in and consent flow replaces it.
+	withConsent := url.Values{"prompt": {oidc.PromptConsent}}
+	for key, value := range authorizationRequest {
+		withConsent[key] = value
+	}
+	for _, test := range []struct {
+		values  url.Values
+		errorID string
+	}{
+		{url.Values{"prompt": {oidc.PromptNone}}, oidc.ErrorCodeOIDCInteractionRequired},
+		{url.Values{"prompt": {oidc.PromptLogin}}, oidc.ErrorCodeOIDCInteractionRequired},
+		{url.Values{"prompt": {oidc.PromptNone}, "konnect": {"consent-state"}}, ""},
+	} {
+		rr := push("secret", withConsent)
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		}
+		response := &payload.PushedAuthorizationResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		test.values.Set("client_id", "pushing")
+		test.values.Set("request_uri", response.RequestURI)
+		rr = authorize(test.values)
+		location, err := url.Parse(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errorID := location.Query().Get("error"); errorID != test.errorID {
+			t.Errorf("authorize error with front channel %v was incorrect, got %s, want %s", test.values, errorID, test.errorID)
+		}
+		if test.errorID == "" && location.Query().Get("code") == "" {
+			t.Errorf("authorize response with front channel %v was incorrect, got %s", test.values, location)
+		}
+	}
+}
+
+func TestAuthorizeHandlerRequestURI(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	request, err := jwt.NewWithClaims(jwt.SigningMethodNone, &payload.RequestObjectClaims{
+		RawScope:        oidc.ScopeOpenID,
+		RawResponseType: oidc.ResponseTypeCode,
+		ClientID:        "referencing",
+		RawRedirectURI:  "https://app.example.com/cb",
+		State:           "referenced-state",
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetched int32
+	requestServer := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		rw.Header().Set("Content-Type", "application/oauth-authz-req+jwt")
+		switch req.URL.Path {
+		case "/request.jwt":
+			rw.Write([]byte(request))
+		case "/large.jwt":
+			rw.Write([]byte(strings.Repeat("a", requestObjectSizeLimit+1)))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer requestServer.Close()
+	provider.requestObjectClient.Transport = requestServer.Client().Transport
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:              "referencing",
+		ApplicationType: oidc.ApplicationTypeWeb,
+		RedirectURIs:    []string{"https://app.example.com/cb"},
+		RequestURIs:     []string{requestServer.URL + "/request.jwt", requestServer.URL + "/large.jwt", requestServer.URL + "/missing.jwt"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(requestURI string, extra url.Values) *httptest.ResponseRecorder {
+		values := url.Values{
+			"client_id":     {"referencing"},
+			"response_type": {oidc.ResponseTypeCode},
+			"scope":         {oidc.ScopeOpenID},
+			"request_uri":   {requestURI},
+		}
+		for key, value := range extra {
+			values[key] = value
+		}
+		req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, test := range []struct {
+		name       string
+		requestURI string
+		extra      url.Values
+	}{
+		{"unregistered", requestServer.URL + "/other.jwt", nil},
+		{"not https", strings.Replace(requestServer.URL, "https://", "http://", 1) + "/request.jwt", nil},
+		{"too large", requestServer.URL + "/large.jwt", nil},
+		{"not found", requestServer.URL + "/missing.jwt", nil},
+		{"with request", requestServer.URL + "/request.jwt", url.Values{"request": {request}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if rr := authorize(test.requestURI, test.extra); rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	atomic.StoreInt32(&fetched, 0)
+	for i := 0; i < 2; i++ {
+		rr := authorize(requestServer.URL+"/request.jwt#v1", nil)
+		if status := rr.Code; status != http.StatusFound {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusFound)
+		}
+		location, err := url.Parse(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Host != "app.example.com" || location.Query().Get("code") == "" {
+			t.Errorf("authorize response was incorrect, got %s", location)
+		}
+		if state := location.Query().Get("state"); state != "referenced-state" {
+			t.Errorf("state was incorrect, got %s, want %s", state, "referenced-state")
+		}
+	}
+	if count := atomic.LoadInt32(&fetched); count != 1 {
+		t.Errorf("request object must be cached, fetched %d times", count)
+	}
+}
+
+func TestAuthorizeHandlerResponseModes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:              "spa",
+		ApplicationType: oidc.ApplicationTypeWeb,
+		RedirectURIs:    []string{"https://app.example.com/cb"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		responseMode string
+		contains     []string
+	}{
+		{konnectoidc.ResponseModeFormPost, []string{`<form method="post" action="https://app.example.com/cb">`, `name="code"`, `name="state" value="mode-state"`}},
+		{konnectoidc.ResponseModeWebMessage, []string{`type: 'authorization_response'`, `"state":"mode-state"`, `"code":`, `app.example.com`}},
+	} {
+		t.Run(test.responseMode, func(t *testing.T) {
+			values := url.Values{
+				"client_id":     {"spa"},
+				"response_type": {oidc.ResponseTypeCode},
+				"response_mode": {test.responseMode},
+				"scope":         {oidc.ScopeOpenID},
+				"redirect_uri":  {"https://app.example.com/cb"},
+				"state":         {"mode-state"},
+			}
+			req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+			if location := rr.Header().Get("Location"); location != "" {
+				t.Errorf("handler must not redirect, got %s", location)
+			}
+			body := rr.Body.String()
+			for _, expected := range test.contains {
+				if !strings.Contains(body, expected) {
+					t.Errorf("response body does not contain %s, got %s", expected, body)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeHandlerJARM(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:              "jarm",
+		ApplicationType: oidc.ApplicationTypeWeb,
+		RedirectURIs:    []string{"https://app.example.com/cb"},
+
+		RawAuthorizationSignedResponseAlg: jwt.SigningMethodRS256.Alg(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(responseType string, responseMode string) *httptest.ResponseRecorder {
+		values := url.Values{
+			"client_id":     {"jarm"},
+			"response_type": {responseType},
+			"response_mode": {responseMode},
+			"scope":         {oidc.ScopeOpenID},
+			"redirect_uri":  {"https://app.example.com/cb"},
+			"state":         {"jarm-state"},
+			"nonce":         {"jarm-nonce"},
+		}
+		req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	parseResponse := func(response string) jwt.MapClaims {
+		claims := make(jwt.MapClaims)
+		if _, err := jwt.ParseWithClaims(response, claims, provider.validateJWT); err != nil {
+			t.Fatal(err)
+		}
+		if iss := claims[oidc.IssuerIdentifierClaim]; iss != provider.issuerIdentifier {
+			t.Errorf("iss was incorrect, got %v, want %v", iss, provider.issuerIdentifier)
+		}
+		if aud := claims[oidc.AudienceClaim]; aud != "jarm" {
+			t.Errorf("aud was incorrect, got %v, want %v", aud, "jarm")
+		}
+		if state := claims["state"]; state != "jarm-state" {
+			t.Errorf("state was incorrect, got %v, want %v", state, "jarm-state")
+		}
+		return claims
+	}
+
+	for _, test := range []struct {
+		responseType string
+		responseMode string
+		fragment     bool
+	}{
+		{oidc.ResponseTypeCode, konnectoidc.ResponseModeJWT, false},
+		{oidc.ResponseTypeCode, konnectoidc.ResponseModeQueryJWT, false},
+		{oidc.ResponseTypeCode, konnectoidc.ResponseModeFragmentJWT, true},
+		{oidc.ResponseTypeCodeIDToken, konnectoidc.ResponseModeJWT, true},
+	} {
+		t.Run(test.responseType+" "+test.responseMode, func(t *testing.T) {
+			rr := authorize(test.responseType, test.responseMode)
+			if status := rr.Code; status != http.StatusFound {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusFound)
+			}
+			location, err := url.Parse(rr.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := location.Query()
+			if test.fragment {
+				values, _ = url.ParseQuery(location.Fragment)
+			}
+			if len(values) != 1 {
+				t.Errorf("response must only contain the response parameter, got %v", values)
+			}
+			claims := parseResponse(values.Get("response"))
+			if code, _ := claims["code"].(string); code == "" {
+				t.Errorf("code must not be empty")
+			}
+		})
+	}
+
+	t.Run("form_post.jwt", func(t *testing.T) {
+		rr := authorize(oidc.ResponseTypeCode, konnectoidc.ResponseModeFormPostJWT)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if body := rr.Body.String(); !strings.Contains(body, `name="response"`) || strings.Contains(body, `name="code"`) {
+			t.Errorf("response body is incorrect, got %s", body)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rr := authorize("unknown", konnectoidc.ResponseModeQueryJWT)
+		if status := rr.Code; status != http.StatusFound {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusFound)
+		}
+		location, _ := url.Parse(rr.Header().Get("Location"))
+		claims := parseResponse(location.Query().Get("response"))
+		if errorID := claims["error"]; errorID != oidc.ErrorCodeOAuth2UnsupportedResponseType {
+			t.Errorf("error was incorrect, got %v, want %v", errorID, oidc.ErrorCodeOAuth2UnsupportedResponseType)
+		}
+	})
+
+	t.Run("query.jwt with token", func(t *testing.T) {
+		if rr := authorize(oidc.ResponseTypeCodeIDToken, konnectoidc.ResponseModeQueryJWT); rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func makeTestDPoPProof(t *testing.T, key *ecdsa.PrivateKey, method string, uri string, accessToken string) string {
+	claims := jwt.MapClaims{
+		"jti": rndm.GenerateRandomString(16),
+		"htm": method,
+		"htu": uri,
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header[konnectoidc.JWTHeaderType] = konnectoidc.DPoPProofType
+	token.Header[konnectoidc.JWTHeaderJWK] = &jose.JSONWebKey{Key: &key.PublicKey}
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestTokenHandlerDPoP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                  "app",
+		RedirectURIs:        []string{"https://example.com/callback"},
+		RotateRefreshTokens: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dpopKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenURI := provider.makeIssURL(config.TokenPath)
+	userInfoURI := provider.makeIssURL(config.UserInfoPath)
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+	refreshTokenString, err := provider.makeRefreshToken(ctx, "app", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(refreshToken string, proof string) (*payload.TokenSuccess, *konnectoidc.OAuth2Error) {
+		values := url.Values{}
+		values.Set("grant_type", oidc.GrantTypeRefreshToken)
+		values.Set("client_id", "app")
+		values.Set("refresh_token", refreshToken)
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if proof != "" {
+			req.Header.Set(konnectoidc.DPoPHeader, proof)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatalf("failed to parse error response %s: %v", rr.Body.String(), err)
+			}
+			return nil, oauth2Error
+		}
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		return response, nil
+	}
+
+	proof := makeTestDPoPProof(t, dpopKey, http.MethodPost, tokenURI, "")
+	response, oauth2Error := refresh(refreshTokenString, proof)
+	if oauth2Error != nil {
+		t.Fatalf("refresh with DPoP proof failed: %v", oauth2Error)
+	}
+	if response.TokenType != konnectoidc.TokenTypeDPoP {
+		t.Errorf("token_type must be %s, got %s", konnectoidc.TokenTypeDPoP, response.TokenType)
+	}
+	accessTokenString := response.AccessToken
+	boundRefreshTokenString := response.RefreshToken
+
+	claims := &konnect.AccessTokenClaims{}
+	if _, _, err = new(jwt.Parser).ParseUnverified(accessTokenString, claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Confirmation == nil || claims.Confirmation.JKT == "" {
+		t.Fatal("access token must be bound with cnf.jkt")
+	}
+
+	if _, oauth2Error = refresh(boundRefreshTokenString, proof); oauth2Error == nil || oauth2Error.ErrorID != konnectoidc.ErrorCodeOAuth2InvalidDPoPProof {
+		t.Errorf("replayed DPoP proof must fail with invalid_dpop_proof, got %v", oauth2Error)
+	}
+	if _, oauth2Error = refresh(boundRefreshTokenString, ""); oauth2Error == nil || oauth2Error.ErrorID != konnectoidc.ErrorCodeOAuth2InvalidDPoPProof {
+		t.Errorf("bound refresh token without DPoP proof must fail with invalid_dpop_proof, got %v", oauth2Error)
+	}
+	if _, oauth2Error = refresh(boundRefreshTokenString, makeTestDPoPProof(t, otherKey, http.MethodPost, tokenURI, "")); oauth2Error == nil || oauth2Error.ErrorID != konnectoidc.ErrorCodeOAuth2InvalidDPoPProof {
+		t.Errorf("bound refresh token with DPoP proof of other key must fail with invalid_dpop_proof, got %v", oauth2Error)
+	}
+	if _, oauth2Error = refresh(boundRefreshTokenString, makeTestDPoPProof(t, dpopKey, http.MethodPost, userInfoURI, "")); oauth2Error == nil || oauth2Error.ErrorID != konnectoidc.ErrorCodeOAuth2InvalidDPoPProof {
+		t.Errorf("DPoP proof for other uri must fail with invalid_dpop_proof, got %v", oauth2Error)
+	}
+	if _, oauth2Error = refresh(boundRefreshTokenString, makeTestDPoPProof(t, dpopKey, http.MethodPost, tokenURI, "")); oauth2Error != nil {
+		t.Errorf("refresh of bound refresh token with DPoP proof failed: %v", oauth2Error)
+	}
+
+	userInfo := func(scheme string, proof string) int {
+		req, err := http.NewRequest(http.MethodGet, config.UserInfoPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", scheme+" "+accessTokenString)
+		if proof != "" {
+			req.Header.Set(konnectoidc.DPoPHeader, proof)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := userInfo(oidc.TokenTypeBearer, ""); code != http.StatusUnauthorized {
+		t.Errorf("userinfo with DPoP bound token as Bearer must fail, got status %d", code)
+	}
+	if code := userInfo(konnectoidc.TokenTypeDPoP, makeTestDPoPProof(t, dpopKey, http.MethodGet, userInfoURI, "")); code != http.StatusUnauthorized {
+		t.Errorf("userinfo with DPoP proof without ath must fail, got status %d", code)
+	}
+	if code := userInfo(konnectoidc.TokenTypeDPoP, makeTestDPoPProof(t, otherKey, http.MethodGet, userInfoURI, accessTokenString)); code != http.StatusUnauthorized {
+		t.Errorf("userinfo with DPoP proof of other key must fail, got status %d", code)
+	}
+	if code := userInfo(konnectoidc.TokenTypeDPoP, makeTestDPoPProof(t, dpopKey, http.MethodGet, userInfoURI, accessTokenString)); code != http.StatusOK {
+		t.Errorf("userinfo with DPoP proof failed with status %d", code)
+	}
+}
+
+func makeTestClientCertificate(t *testing.T, commonName string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestTokenHandlerTLSClientAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	selfSignedCert, selfSignedKey := makeTestClientCertificate(t, "self-signed")
+	pkiCert, _ := makeTestClientCertificate(t, "pki")
+	otherCert, _ := makeTestClientCertificate(t, "other")
+
+	jwk, err := gojwk.PublicKey(&selfSignedKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                         "self-signed",
+		RawTokenEndpointAuthMethod: konnectoidc.AuthMethodSelfSignedTLSClientAuth,
+		JWKS:                       &gojwk.Key{Keys: []*gojwk.Key{jwk}},
+		GrantTypes:                 []string{konnectoidc.GrantTypeClientCredentials},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                         "pki",
+		RawTokenEndpointAuthMethod: konnectoidc.AuthMethodTLSClientAuth,
+		TLSClientAuthSubjectDN:     pkiCert.Subject.String(),
+		GrantTypes:                 []string{konnectoidc.GrantTypeClientCredentials},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.Config.Config.TLSClientCAs = x509.NewCertPool()
+	provider.Config.Config.TLSClientCAs.AddCert(pkiCert)
+	proxyIP := net.ParseIP("192.0.2.1")
+	provider.Config.Config.TrustedProxyIPs = []*net.IP{&proxyIP}
+
+	tests := []struct {
+		clientID   string
+		cert       *x509.Certificate
+		viaProxy   bool
+		remoteAddr string
+		errorID    string
+	}{
+		{"self-signed", selfSignedCert, false, "", ""},
+		{"self-signed", nil, false, "", konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"self-signed", otherCert, false, "", konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"pki", pkiCert, true, "192.0.2.1:1234", ""},
+		{"pki", pkiCert, true, "198.51.100.1:1234", konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"pki", otherCert, true, "192.0.2.1:1234", konnectoidc.ErrorCodeOAuth2InvalidClient},
+	}
+
+	for _, test := range tests {
+		values := url.Values{}
+		values.Set("grant_type", konnectoidc.GrantTypeClientCredentials)
+		values.Set("client_id", test.clientID)
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = test.remoteAddr
+		if test.cert != nil {
+			if test.viaProxy {
+				req.Header.Set("Client-Cert", ":"+base64.StdEncoding.EncodeToString(test.cert.Raw)+":")
+			} else {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.cert}}
+			}
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if test.errorID != "" {
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if oauth2Error.ErrorID != test.errorID {
+				t.Errorf("error was incorrect for %s, got %s, want %s", test.clientID, oauth2Error.ErrorID, test.errorID)
+			}
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code for %s: got %v want %v: %s", test.clientID, rr.Code, http.StatusOK, rr.Body.String())
+		}
+
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		claims := &konnect.AccessTokenClaims{}
+		if _, err := jwt.ParseWithClaims(response.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return provider.validateJWT(token)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if claims.Confirmation == nil || claims.Confirmation.X5tS256 != getCertificateThumbprint(test.cert) {
+			t.Errorf("access token must be bound to the client certificate, got %v", claims.Confirmation)
+		}
+	}
+}
+
+func TestTokenHandlerClientAssertion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := gojwk.PublicKey(&clientKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                         "keys",
+		RawTokenEndpointAuthMethod: oidc.AuthMethodPrivateKeyJWT,
+		JWKS:                       &gojwk.Key{Keys: []*gojwk.Key{jwk}},
+		GrantTypes:                 []string{konnectoidc.GrantTypeClientCredentials},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                         "hmac",
+		Secret:                     "secret",
+		RawTokenEndpointAuthMethod: oidc.AuthMethodClientSecretJWT,
+		GrantTypes:                 []string{konnectoidc.GrantTypeClientCredentials},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenURI := provider.makeIssURL(config.TokenPath)
+	makeAssertion := func(clientID string, method jwt.SigningMethod, key interface{}, audience string, jti string) string {
+		claims := jwt.RegisteredClaims{
+			Issuer:    clientID,
+			Subject:   clientID,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			ID:        jti,
+		}
+		assertion, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return assertion
+	}
+	replayedAssertion := makeAssertion("keys", jwt.SigningMethodES256, clientKey, tokenURI, "replayed")
+	makeLongLivedAssertion := func(jti string, iat time.Time, exp time.Time) string {
+		claims := jwt.RegisteredClaims{
+			Issuer:    "keys",
+			Subject:   "keys",
+			Audience:  jwt.ClaimStrings{tokenURI},
+			IssuedAt:  jwt.NewNumericDate(iat),
+			ExpiresAt: jwt.NewNumericDate(exp),
+			ID:        jti,
+		}
+		assertion, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return assertion
+	}
+
+	tests := []struct {
+		name         string
+		clientID     string
+		clientSecret string
+		assertion    string
+		errorID      string
+	}{
+		{"private_key_jwt", "", "", makeAssertion("keys", jwt.SigningMethodES256, clientKey, tokenURI, "1"), ""},
+		{"private_key_jwt with issuer audience", "keys", "", makeAssertion("keys", jwt.SigningMethodES256, clientKey, provider.issuerIdentifier, "2"), ""},
+		{"first use", "", "", replayedAssertion, ""},
+		{"replay", "", "", replayedAssertion, konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"unknown key", "", "", makeAssertion("keys", jwt.SigningMethodES256, otherKey, tokenURI, "3"), konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"wrong audience", "", "", makeAssertion("keys", jwt.SigningMethodES256, clientKey, "https://example.com", "4"), konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"missing jti", "", "", makeAssertion("keys", jwt.SigningMethodES256, clientKey, tokenURI, ""), konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"client_id mismatch", "hmac", "", makeAssertion("keys", jwt.SigningMethodES256, clientKey, tokenURI, "5"), oidc.ErrorCodeOAuth2InvalidRequest},
+		{"client_secret_jwt", "", "", makeAssertion("hmac", jwt.SigningMethodHS256, []byte("secret"), tokenURI, "1"), ""},
+		{"client_secret_jwt wrong secret", "", "", makeAssertion("hmac", jwt.SigningMethodHS256, []byte("wrong"), tokenURI, "2"), konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"client_secret_basic for client_secret_jwt client", "hmac", "secret", "", konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"far future exp", "", "", makeLongLivedAssertion("6", time.Now(), time.Now().Add(24*time.Hour)), konnectoidc.ErrorCodeOAuth2InvalidClient},
+		{"long lifetime", "", "", makeLongLivedAssertion("7", time.Now().Add(-time.Hour), time.Now().Add(time.Minute)), konnectoidc.ErrorCodeOAuth2InvalidClient},
+	}
+
+	for _, test := range tests {
+		values := url.Values{}
+		values.Set("grant_type", konnectoidc.GrantTypeClientCredentials)
+		if test.clientID != "" {
+			values.Set("client_id", test.clientID)
+		}
+		if test.clientSecret != "" {
+			values.Set("client_secret", test.clientSecret)
+		}
+		if test.assertion != "" {
+			values.Set("client_assertion_type", konnectoidc.ClientAssertionTypeJWTBearer)
+			values.Set("client_assertion", test.assertion)
+		}
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if test.errorID == "" {
+			if rr.Code != http.StatusOK {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v: %s", test.name, rr.Code, http.StatusOK, rr.Body.String())
+			}
+			continue
+		}
+		oauth2Error := &konnectoidc.OAuth2Error{}
+		if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+			t.Fatalf("%s: failed to parse error response %s: %v", test.name, rr.Body.String(), err)
+		}
+		if oauth2Error.ErrorID != test.errorID {
+			t.Errorf("%s: error was incorrect, got %s (%s), want %s", test.name, oauth2Error.ErrorID, oauth2Error.ErrorDescription, test.errorID)
+		}
+	}
+}
+
+func TestPairwiseSubjects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, registration := range []*clients.ClientRegistration{
+		{ID: "public", RedirectURIs: []string{"https://a.example.com/cb"}},
+		{ID: "pairwise-a1", RedirectURIs: []string{"https://a.example.com/cb"}, SubjectType: konnectoidc.SubjectIDPairwise},
+		{ID: "pairwise-a2", RedirectURIs: []string{"https://a.example.com/other"}, SubjectType: konnectoidc.SubjectIDPairwise},
+		{ID: "pairwise-b", RedirectURIs: []string{"https://b.example.com/cb"}, SubjectType: konnectoidc.SubjectIDPairwise},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+
+	subjects := make(map[string]string)
+	for _, clientID := range []string{"public", "pairwise-a1", "pairwise-a2", "pairwise-b"} {
+		sub, err := provider.ClientSubjectFromAuth(ctx, auth, clientID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subjects[clientID] = sub
+	}
+	if subjects["public"] != auth.Subject() {
+		t.Errorf("public client must get public subject, got %v", subjects["public"])
+	}
+	if subjects["pairwise-a1"] == auth.Subject() || subjects["pairwise-a1"] != subjects["pairwise-a2"] {
+		t.Errorf("pairwise clients of the same sector must get the same pairwise subject, got %v and %v", subjects["pairwise-a1"], subjects["pairwise-a2"])
+	}
+	if subjects["pairwise-b"] == subjects["pairwise-a1"] || subjects["pairwise-b"] == auth.Subject() {
+		t.Errorf("pairwise clients of different sectors must get different subjects, got %v", subjects["pairwise-b"])
+	}
+
+	// Access tokens, userinfo and refresh tokens use the pairwise subject.
+	accessTokenString, err := provider.makeAccessToken(ctx, "pairwise-b", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessTokenClaims := &konnect.AccessTokenClaims{}
+	if _, _, err = new(jwt.Parser).ParseUnverified(accessTokenString, accessTokenClaims); err != nil {
+		t.Fatal(err)
+	}
+	if accessTokenClaims.Subject != subjects["pairwise-b"] {
+		t.Errorf("access token sub was incorrect, got %v, want %v", accessTokenClaims.Subject, subjects["pairwise-b"])
+	}
+
+	req, err := http.NewRequest(http.MethodGet, config.UserInfoPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessTokenString)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("userinfo returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	userinfo := make(map[string]interface{})
+	if err := json.Unmarshal(rr.Body.Bytes(), &userinfo); err != nil {
+		t.Fatal(err)
+	}
+	if userinfo[oidc.SubjectIdentifierClaim] != subjects["pairwise-b"] {
+		t.Errorf("userinfo sub was incorrect, got %v, want %v", userinfo[oidc.SubjectIdentifierClaim], subjects["pairwise-b"])
+	}
+
+	refreshTokenString, err := provider.makeRefreshToken(ctx, "pairwise-b", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("grant_type", oidc.GrantTypeRefreshToken)
+	values.Set("client_id", "pairwise-b")
+	values.Set("refresh_token", refreshTokenString)
+	req, err = http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("refresh returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	response := &payload.TokenSuccess{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	accessTokenClaims = &konnect.AccessTokenClaims{}
+	if _, _, err = new(jwt.Parser).ParseUnverified(response.AccessToken, accessTokenClaims); err != nil {
+		t.Fatal(err)
+	}
+	if accessTokenClaims.Subject != subjects["pairwise-b"] {
+		t.Errorf("refreshed access token sub was incorrect, got %v, want %v", accessTokenClaims.Subject, subjects["pairwise-b"])
+	}
+
+	// Sector identifier URIs must include all redirect URIs.
+	sectorServer := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`["https://a.example.com/cb", "https://b.example.com/cb"]`))
+	}))
+	defer sectorServer.Close()
+	provider.requestObjectClient.Transport = sectorServer.Client().Transport
+
+	for _, test := range []struct {
+		redirectURIs []string
+		valid        bool
+	}{
+		{[]string{"https://a.example.com/cb", "https://b.example.com/cb"}, true},
+		{[]string{"https://a.example.com/cb", "https://c.example.com/cb"}, false},
+	} {
+		err := provider.validateSectorIdentifierURI(ctx, &payload.ClientRegistrationRequest{
+			RedirectURIs:        test.redirectURIs,
+			SubjectType:         konnectoidc.SubjectIDPairwise,
+			SectorIdentifierURI: sectorServer.URL + "/sector.json",
+		})
+		if test.valid && err != nil {
+			t.Errorf("sector identifier validation failed for %v: %v", test.redirectURIs, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("sector identifier validation must fail for %v", test.redirectURIs)
+		}
+	}
+}
+
+func TestPairwiseSubjectsWithoutSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	// Without configured secret, pairwise subjects are not supported.
+	provider.pairwiseSubjectSecret = nil
+	if err := provider.InitializeMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	if containsString(provider.metadata.SubjectTypesSupported, konnectoidc.SubjectIDPairwise) {
+		t.Errorf("pairwise subject type must not be advertised, got %v", provider.metadata.SubjectTypesSupported)
+	}
+	err := provider.validateClientRegistrationRequest(ctx, &payload.ClientRegistrationRequest{
+		RedirectURIs: []string{"https://a.example.com/cb"},
+		SubjectType:  konnectoidc.SubjectIDPairwise,
+	})
+	if oauth2Error, ok := err.(*konnectoidc.OAuth2Error); !ok || oauth2Error.ErrorID != oidc.ErrorCodeOIDCInvalidClientMetadata {
+		t.Errorf("registration with pairwise subject type must fail, got %v", err)
+	}
+	if _, err := provider.makePairwiseSubject("a.example.com", "sub"); err == nil {
+		t.Errorf("pairwise subject without secret must fail")
+	}
+}
+
+func TestPairwiseSubjectsWithLongSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	// Secrets longer than 64 bytes, like hex encoded secrets with a trailing
+	// newline, must be usable.
+	provider.pairwiseSubjectSecret = []byte(strings.Repeat("a1", 32) + "\n")
+	sub, err := provider.makePairwiseSubject("a.example.com", "sub")
+	if err != nil {
+		t.Fatalf("pairwise subject with long secret failed: %v", err)
+	}
+	if again, _ := provider.makePairwiseSubject("a.example.com", "sub"); again != sub {
+		t.Errorf("pairwise subject must be stable, got %s and %s", sub, again)
+	}
+	if other, _ := provider.makePairwiseSubject("b.example.com", "sub"); other == sub {
+		t.Errorf("pairwise subjects of different sectors must differ")
+	}
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	var requests int32
+	logoutTokens := make(chan string, 2)
+	rpServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// Fail first request, to trigger retry.
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := req.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		logoutTokens <- req.PostForm.Get("logout_token")
+	}))
+	defer rpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                   "rp",
+		RedirectURIs:         []string{"https://rp.example.com/cb"},
+		BackchannelLogoutURI: rpServer.URL + "/logout",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:           "other",
+		RedirectURIs: []string{"https://other.example.com/cb"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/konnect/v1/authorize", nil)
+	var session *payload.Session
+	for _, clientID := range []string{"rp", "other", "rp"} {
+		session, err = provider.updateOrCreateSession(httptest.NewRecorder(), req, &payload.AuthenticationRequest{
+			ClientID: clientID,
+			Session:  session,
+		}, auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(session.Clients) != 1 || session.Clients[0] != "rp" {
+		t.Fatalf("session clients were incorrect, got %v", session.Clients)
+	}
+
+	provider.endSession(ctx, session)
+	provider.endSession(ctx, session)
+
+	var logoutToken string
+	select {
+	case logoutToken = <-logoutTokens:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no logout token received")
+	}
+
+	claims := &konnectoidc.LogoutTokenClaims{}
+	token, err := jwt.ParseWithClaims(logoutToken, claims, provider.validateJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := token.Header[konnectoidc.JWTHeaderType]; typ != konnectoidc.LogoutTokenType {
+		t.Errorf("logout token typ was incorrect, got %v", typ)
+	}
+	if claims.Audience != "rp" || claims.Subject != auth.Subject() || claims.SessionClaims == nil || claims.SessionID != session.ID {
+		t.Errorf("logout token claims were incorrect, got %#v", claims)
+	}
+	if _, ok := claims.Events[konnectoidc.BackChannelLogoutEvent]; !ok {
+		t.Errorf("logout token events were incorrect, got %v", claims.Events)
+	}
+
+	select {
+	case <-logoutTokens:
+		t.Error("logout must be sent only once per session")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEndSessionHandlerFrontchannelLogout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, _, _ := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                    "rp",
+		RedirectURIs:          []string{"https://rp.example.com/cb"},
+		FrontchannelLogoutURI: "https://rp.example.com/logout?v=1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	provider.sessionCookieName = "test-session"
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	session, err := provider.updateOrCreateSession(rr, httptest.NewRequest(http.MethodGet, "/konnect/v1/authorize", nil), &payload.AuthenticationRequest{
+		ClientID: "rp",
+	}, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+
+	req := httptest.NewRequest(http.MethodGet, "/konnect/v1/endsession?"+url.Values{
+		"post_logout_redirect_uri": {"https://rp.example.com/signed-out"},
+		"state":                    {"logout-state"},
+	}.Encode(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rr = httptest.NewRecorder()
+	provider.EndSessionHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-src https://rp.example.com") {
+		t.Errorf("content security policy was incorrect, got %v", csp)
+	}
+	body := rr.Body.String()
+	frameURI := "https://rp.example.com/logout?" + url.Values{
+		"iss": {"http://localhost:8777"},
+		"sid": {session.ID},
+		"v":   {"1"},
+	}.Encode()
+	if !strings.Contains(body, `<iframe src="`+strings.ReplaceAll(frameURI, "&", "&amp;")+`" hidden>`) {
+		t.Errorf("response must include frontchannel logout iframe %v, got %s", frameURI, body)
+	}
+	if !strings.Contains(body, `"https://rp.example.com/signed-out?state=logout-state"`) {
+		t.Errorf("response must include post logout redirect uri, got %s", body)
+	}
+}
+
+func TestEncryptedResponses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecJWK, err := gojwk.PublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecJWK.Use = "enc"
+	ecJWK.Kid = "ec-enc"
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK, err := gojwk.PublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK.Use = "enc"
+	rsaJWK.Kid = "rsa-enc"
+	jwks := &gojwk.Key{Keys: []*gojwk.Key{ecJWK, rsaJWK}}
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:                              "encrypted-ec",
+			RedirectURIs:                    []string{"https://a.example.com/cb"},
+			JWKS:                            jwks,
+			RawIDTokenEncryptedResponseAlg:  "ECDH-ES+A128KW",
+			RawIDTokenEncryptedResponseEnc:  "A128GCM",
+			RawUserInfoEncryptedResponseAlg: "ECDH-ES",
+			RawUserInfoEncryptedResponseEnc: "A128CBC-HS256",
+		},
+		{
+			ID:                              "encrypted-rsa",
+			RedirectURIs:                    []string{"https://a.example.com/cb"},
+			JWKS:                            jwks,
+			RawIDTokenEncryptedResponseAlg:  "RSA-OAEP",
+			RawIDTokenEncryptedResponseEnc:  "A256GCM",
+			RawUserInfoSignedResponseAlg:    jwt.SigningMethodPS256.Alg(),
+			RawUserInfoEncryptedResponseAlg: "RSA-OAEP-256",
+			RawUserInfoEncryptedResponseEnc: "A128CBC-HS256",
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+
+	for _, test := range []struct {
+		clientID   string
+		decryptKey interface{}
+		signed     bool
+	}{
+		{"encrypted-ec", ecKey, false},
+		{"encrypted-rsa", rsaKey, true},
+	} {
+		idTokenString, err := provider.makeIDToken(ctx, &payload.AuthenticationRequest{ClientID: test.clientID}, auth, nil, "", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, err := jose.ParseEncrypted(idTokenString)
+		if err != nil {
+			t.Fatalf("%s: id token is not encrypted: %v", test.clientID, err)
+		}
+		if object.Header.ExtraHeaders[jose.HeaderContentType] != "JWT" {
+			t.Errorf("%s: id token cty was incorrect, got %v", test.clientID, object.Header.ExtraHeaders[jose.HeaderContentType])
+		}
+		plaintext, err := object.Decrypt(test.decryptKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idTokenClaims := &konnectoidc.IDTokenClaims{}
+		if _, err = jwt.ParseWithClaims(string(plaintext), idTokenClaims, provider.validateJWT); err != nil {
+			t.Fatalf("%s: nested id token is invalid: %v", test.clientID, err)
+		}
+		if idTokenClaims.Audience != test.clientID {
+			t.Errorf("%s: id token aud was incorrect, got %v", test.clientID, idTokenClaims.Audience)
+		}
+
+		accessTokenString, err := provider.makeAccessToken(ctx, test.clientID, auth, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodGet, config.UserInfoPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessTokenString)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: userinfo returned wrong status code: got %v want %v: %s", test.clientID, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/jwt" {
+			t.Errorf("%s: userinfo returned wrong content type: %v", test.clientID, contentType)
+		}
+		object, err = jose.ParseEncrypted(rr.Body.String())
+		if err != nil {
+			t.Fatalf("%s: userinfo is not encrypted: %v", test.clientID, err)
+		}
+		plaintext, err = object.Decrypt(test.decryptKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		userinfo := jwt.MapClaims{}
+		if test.signed {
+			if _, err = jwt.ParseWithClaims(string(plaintext), userinfo, provider.validateJWT); err != nil {
+				t.Fatalf("%s: nested userinfo is invalid: %v", test.clientID, err)
+			}
+		} else if err = json.Unmarshal(plaintext, &userinfo); err != nil {
+			t.Fatal(err)
+		}
+		if userinfo[oidc.SubjectIdentifierClaim] != auth.Subject() {
+			t.Errorf("%s: userinfo sub was incorrect, got %v", test.clientID, userinfo[oidc.SubjectIdentifierClaim])
+		}
+		if userinfo[oidc.IssuerIdentifierClaim] != provider.issuerIdentifier || userinfo[oidc.AudienceClaim] != test.clientID {
+			t.Errorf("%s: userinfo iss/aud was incorrect, got %v/%v", test.clientID, userinfo[oidc.IssuerIdentifierClaim], userinfo[oidc.AudienceClaim])
+		}
+	}
+
+	// Registration requires keys for encryption.
+	crr := &payload.ClientRegistrationRequest{
+		RedirectURIs:                   []string{"https://a.example.com/cb"},
+		RawIDTokenEncryptedResponseAlg: "RSA-OAEP",
+	}
+	if err := crr.Validate(); err == nil {
+		t.Errorf("registration without jwks must fail")
+	}
+	crr.JWKS = jwks
+	if err := crr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if crr.RawIDTokenEncryptedResponseEnc != konnectoidc.DefaultEncryptionEnc {
+		t.Errorf("registration enc default was incorrect, got %v", crr.RawIDTokenEncryptedResponseEnc)
+	}
+}
+
+func TestUserInfoHandlerSigned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, registration := range []*clients.ClientRegistration{
+		{ID: "plain", RedirectURIs: []string{"https://a.example.com/cb"}},
+		{ID: "signed", RedirectURIs: []string{"https://a.example.com/cb"}, RawUserInfoSignedResponseAlg: jwt.SigningMethodRS256.Alg()},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+
+	userinfo := func(clientID string) *httptest.ResponseRecorder {
+		accessTokenString, err := provider.makeAccessToken(ctx, clientID, auth, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodGet, config.UserInfoPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessTokenString)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: userinfo returned wrong status code: got %v want %v: %s", clientID, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		return rr
+	}
+
+	rr := userinfo("plain")
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("plain userinfo returned wrong content type: %v", contentType)
+	}
+
+	rr = userinfo("signed")
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/jwt" {
+		t.Errorf("signed userinfo returned wrong content type: %v", contentType)
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(rr.Body.String(), claims, provider.validateJWT)
+	if err != nil {
+		t.Fatalf("signed userinfo is invalid: %v", err)
+	}
+	if token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+		t.Errorf("signed userinfo alg was incorrect, got %v", token.Method.Alg())
+	}
+	if claims[oidc.SubjectIdentifierClaim] != auth.Subject() {
+		t.Errorf("signed userinfo sub was incorrect, got %v", claims[oidc.SubjectIdentifierClaim])
+	}
+	if claims[oidc.IssuerIdentifierClaim] != provider.issuerIdentifier || claims[oidc.AudienceClaim] != "signed" {
+		t.Errorf("signed userinfo iss/aud was incorrect, got %v/%v", claims[oidc.IssuerIdentifierClaim], claims[oidc.AudienceClaim])
+	}
+
+	// Registration rejects algs the provider cannot sign with.
+	body, _ := json.Marshal(map[string]interface{}{
+		"redirect_uris":                []string{"https://a.example.com/cb"},
+		"userinfo_signed_response_alg": jwt.SigningMethodHS256.Alg(),
+	})
+	req, err := http.NewRequest(http.MethodPost, "/register", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	provider.RegistrationHandler(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "userinfo_signed_response_alg") {
+		t.Errorf("registration with unsupported userinfo_signed_response_alg must fail, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAuthContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:              "spa",
+		ApplicationType: oidc.ApplicationTypeWeb,
+		RedirectURIs:    []string{"https://app.example.com/cb"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		acr      string
+		values   []string
+		expected bool
+	}{
+		{konnectoidc.ACRPassword, []string{konnectoidc.ACRPassword}, true},
+		{konnectoidc.ACRPassword, []string{konnectoidc.ACRFederated}, true},
+		{konnectoidc.ACRFederated, []string{konnectoidc.ACRPassword}, false},
+		{konnectoidc.ACRFederated, []string{"unknown", konnectoidc.ACRFederated}, true},
+		{konnectoidc.ACRNone, []string{konnectoidc.ACRFederated}, false},
+		{"", []string{konnectoidc.ACRNone}, false},
+		{konnectoidc.ACRPassword, []string{"unknown"}, false},
+	} {
+		if satisfied := konnectoidc.ACRSatisfies(test.acr, test.values); satisfied != test.expected {
+			t.Errorf("acr %v for %v was incorrect, got %v, want %v", test.acr, test.values, satisfied, test.expected)
+		}
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+	auth.SetAuthContext(konnectoidc.ACRPassword, []string{konnectoidc.AMRPassword})
+
+	checkAuthContext := func(name string, claims *konnectoidc.AuthContextClaims) {
+		if claims == nil {
+			t.Errorf("%s has no acr and amr", name)
+			return
+		}
+		if claims.AuthContextClassReference != konnectoidc.ACRPassword {
+			t.Errorf("%s acr was incorrect, got %v", name, claims.AuthContextClassReference)
+		}
+		if len(claims.AuthMethodsReferences) != 1 || claims.AuthMethodsReferences[0] != konnectoidc.AMRPassword {
+			t.Errorf("%s amr was incorrect, got %v", name, claims.AuthMethodsReferences)
+		}
+	}
+
+	idTokenString, err := provider.makeIDToken(ctx, &payload.AuthenticationRequest{ClientID: "spa"}, auth, nil, "accesstoken", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idTokenClaims := &konnectoidc.IDTokenClaims{}
+	if _, err = jwt.ParseWithClaims(idTokenString, idTokenClaims, provider.validateJWT); err != nil {
+		t.Fatal(err)
+	}
+	checkAuthContext("id token", idTokenClaims.AuthContextClaims)
+
+	accessTokenString, err := provider.makeAccessToken(ctx, "spa", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessTokenClaims := &konnect.AccessTokenClaims{}
+	if _, err = jwt.ParseWithClaims(accessTokenString, accessTokenClaims, provider.validateJWT); err != nil {
+		t.Fatal(err)
+	}
+	checkAuthContext("access token", accessTokenClaims.AuthContextClaims)
+
+	refreshTokenString, err := provider.makeRefreshToken(ctx, "spa", auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshTokenClaims := &konnect.RefreshTokenClaims{}
+	if _, err = jwt.ParseWithClaims(refreshTokenString, refreshTokenClaims, provider.validateJWT); err != nil {
+		t.Fatal(err)
+	}
+	checkAuthContext("refresh token", refreshTokenClaims.AuthContextClaims)
+
+	// The dummy identity manager has no authentication context, so only
+	// voluntary acr requests pass.
+	for _, test := range []struct {
+		name   string
+		values url.Values
+		error  string
+	}{
+		{"voluntary acr_values", url.Values{"acr_values": {konnectoidc.ACRPassword}}, ""},
+		{"voluntary claims request", url.Values{"claims": {`{"id_token":{"acr":{"values":["` + konnectoidc.ACRPassword + `"]}}}`}}, ""},
+		{"essential claims request", url.Values{"claims": {`{"id_token":{"acr":{"essential":true,"values":["` + konnectoidc.ACRPassword + `"]}}}`}}, oidc.ErrorCodeOAuth2AccessDenied},
+	} {
+		values := url.Values{
+			"client_id":     {"spa"},
+			"response_type": {oidc.ResponseTypeCode},
+			"scope":         {oidc.ScopeOpenID},
+			"redirect_uri":  {"https://app.example.com/cb"},
+			"state":         {"acr-state"},
+		}
+		for k, v := range test.values {
+			values[k] = v
+		}
+		req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		if err != nil || location.Host != "app.example.com" {
+			t.Fatalf("%s: handler returned wrong redirect: %v %s", test.name, rr.Code, rr.Header().Get("Location"))
+		}
+		query := location.Query()
+		if query.Get("error") != test.error {
+			t.Errorf("%s: handler returned wrong error: got %v want %v", test.name, query.Get("error"), test.error)
+		}
+		if test.error == "" && query.Get("code") == "" {
+			t.Errorf("%s: handler returned no code", test.name)
+		}
+	}
+}
+
+func TestTokenHandlerResources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, registration := range []*clients.ClientRegistration{
+		{
+			ID:           "service",
+			Secret:       "secret",
+			RedirectURIs: []string{"https://example.com/callback"},
+			GrantTypes:   []string{konnectoidc.GrantTypeClientCredentials},
+			Scopes:       []string{"scope-a"},
+		},
+		{
+			ID:                "service-jwt",
+			Secret:            "secret",
+			GrantTypes:        []string{konnectoidc.GrantTypeClientCredentials},
+			Scopes:            []string{"scope-a"},
+			AccessTokenFormat: konnectoidc.AccessTokenFormatJWT,
+		},
+	} {
+		if err := provider.clients.Register(registration); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, resource := range []*clients.ResourceRegistration{
+		{URI: "https://api.example.com"},
+		{URI: "https://jwt.example.com/", AccessTokenFormat: konnectoidc.AccessTokenFormatJWT},
+	} {
+		if err := provider.clients.RegisterResource(resource); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.clients.RegisterResource(&clients.ResourceRegistration{URI: "https://api.example.com#fragment"}); err == nil {
+		t.Errorf("resource with fragment must be rejected")
+	}
+
+	auth, err := provider.identityManager.Authenticate(ctx, nil, nil, &payload.AuthenticationRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.AuthorizeScopes(map[string]bool{oidc.ScopeOpenID: true})
+	refreshTokenString, err := provider.makeRefreshToken(ctx, "service", auth, nil, withRefreshResources([]string{"https://api.example.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clientID  string
+		grantType string
+		resources []string
+		errorID   string
+		audience  string
+		client    string
+		jwt       bool
+	}{
+		{"service", konnectoidc.GrantTypeClientCredentials, nil, "", "service", "", false},
+		{"service", konnectoidc.GrantTypeClientCredentials, []string{"https://api.example.com"}, "", "https://api.example.com", "service", false},
+		{"service", konnectoidc.GrantTypeClientCredentials, []string{"https://jwt.example.com/"}, "", "https://jwt.example.com/", "service", true},
+		{"service-jwt", konnectoidc.GrantTypeClientCredentials, nil, "", "service-jwt", "service-jwt", true},
+		{"service", konnectoidc.GrantTypeClientCredentials, []string{"https://unknown.example.com"}, konnectoidc.ErrorCodeOAuth2InvalidTarget, "", "", false},
+		{"service", konnectoidc.GrantTypeClientCredentials, []string{"https://api.example.com#fragment"}, konnectoidc.ErrorCodeOAuth2InvalidTarget, "", "", false},
+		{"service", konnectoidc.GrantTypeClientCredentials, []string{"https://api.example.com", "https://jwt.example.com/"}, konnectoidc.ErrorCodeOAuth2InvalidTarget, "", "", false},
+		{"service", oidc.GrantTypeRefreshToken, nil, "", "https://api.example.com", "service", false},
+		{"service", oidc.GrantTypeRefreshToken, []string{"https://jwt.example.com/"}, konnectoidc.ErrorCodeOAuth2InvalidTarget, "", "", false},
+	}
+
+	for idx, test := range tests {
+		values := url.Values{}
+		values.Set("grant_type", test.grantType)
+		if test.grantType == oidc.GrantTypeRefreshToken {
+			values.Set("refresh_token", refreshTokenString)
+		}
+		for _, resource := range test.resources {
+			values.Add("resource", resource)
+		}
+		req, err := http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(test.clientID, "secret")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if test.errorID != "" {
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil {
+				t.Fatal(err)
+			}
+			if rr.Code != http.StatusBadRequest || oauth2Error.ErrorID != test.errorID {
+				t.Errorf("test %d error was incorrect, got %v %s, want %s", idx, rr.Code, oauth2Error.ErrorID, test.errorID)
+			}
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			t.Fatalf("test %d handler returned wrong status code: got %v want %v: %s", idx, rr.Code, http.StatusOK, rr.Body.String())
+		}
+
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		claims := &konnect.AccessTokenClaims{}
+		token, err := jwt.ParseWithClaims(response.AccessToken, claims, provider.validateJWT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Audience != test.audience {
+			t.Errorf("test %d audience was incorrect, got %s, want %s", idx, claims.Audience, test.audience)
+		}
+		if claims.Client() != test.clientID {
+			t.Errorf("test %d client was incorrect, got %s, want %s", idx, claims.Client(), test.clientID)
+		}
+		typ, _ := token.Header[konnectoidc.JWTHeaderType].(string)
+		if test.jwt {
+			if typ != konnectoidc.AccessTokenTypeJWT || claims.ClientID != test.client || claims.AuthorizedParty != "" || claims.Scope == "" {
+				t.Errorf("test %d access token is not in jwt format, got typ %s, client_id %s, azp %s, scope %s", idx, typ, claims.ClientID, claims.AuthorizedParty, claims.Scope)
+			}
+		} else {
+			if typ == konnectoidc.AccessTokenTypeJWT || claims.ClientID != "" || claims.AuthorizedParty != test.client {
+				t.Errorf("test %d access token is not in default format, got typ %s, client_id %s, azp %s", idx, typ, claims.ClientID, claims.AuthorizedParty)
+			}
+		}
+	}
+}
+
+func TestAuthorizationDetails(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	for _, detailsType := range []*clients.AuthorizationDetailsTypeRegistration{
+		{
+			Type:     "payment_initiation",
+			Fields:   []string{"instructedAmount", "creditorName"},
+			Required: []string{"instructedAmount"},
+		},
+		{
+			Type: "document_signing",
+		},
+	} {
+		if err := provider.clients.RegisterAuthorizationDetailsType(detailsType); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.clients.RegisterAuthorizationDetailsType(&clients.AuthorizationDetailsTypeRegistration{
+		Type:     "broken",
+		Required: []string{"unknown"},
+	}); err == nil {
+		t.Errorf("authorization details type with unknown required field must be rejected")
+	}
+	if err := provider.clients.Register(&clients.ClientRegistration{
+		ID:                        "payments",
+		ApplicationType:           oidc.ApplicationTypeWeb,
+		RedirectURIs:              []string{"https://app.example.com/cb"},
+		AuthorizationDetailsTypes: []string{"payment_initiation"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.InitializeMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	if supported := provider.metadata.AuthorizationDetailsTypesSupported; len(supported) != 2 || supported[0] != "document_signing" || supported[1] != "payment_initiation" {
+		t.Errorf("authorization_details_types_supported was incorrect, got %v", supported)
+	}
+
+	for idx, test := range []struct {
+		authorizationDetails string
+		errorID              string
+	}{
+		{`[{"type":"payment_initiation","actions":["initiate"],"locations":["https://bank.example.com/payments"],"instructedAmount":{"currency":"EUR","amount":"123.50"},"creditorName":"Merchant A"}]`, ""},
+		{`[{"type":"payment_initiation","creditorName":"Merchant A"}]`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+		{`[{"type":"payment_initiation","instructedAmount":{},"debtorName":"Someone"}]`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+		{`[{"type":"payment_initiation","instructedAmount":{},"actions":"initiate"}]`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+		{`[{"type":"document_signing"}]`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+		{`[{"type":"unknown"}]`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+		{`[{"actions":["initiate"]}]`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+		{`{"type":"payment_initiation"}`, konnectoidc.ErrorCodeOAuth2InvalidAuthorizationDetails},
+	} {
+		values := url.Values{
+			"client_id":             {"payments"},
+			"response_type":         {oidc.ResponseTypeCode},
+			"scope":                 {oidc.ScopeOpenID},
+			"redirect_uri":          {"https://app.example.com/cb"},
+			"state":                 {"details-state"},
+			"authorization_details": {test.authorizationDetails},
+		}
+		req, err := http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if test.errorID != "" {
+			location, _ := url.Parse(rr.Header().Get("Location"))
+			if !strings.Contains(rr.Body.String(), test.errorID) && (location == nil || location.Query().Get("error") != test.errorID) {
+				t.Errorf("test %d error was incorrect, got %v %s %s", idx, rr.Code, rr.Header().Get("Location"), rr.Body.String())
+			}
+			continue
+		}
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		if err != nil || location.Query().Get("code") == "" {
+			t.Fatalf("test %d authorize must redirect with code, got %v %s", idx, rr.Code, rr.Header().Get("Location"))
+		}
+
+		tokenValues := url.Values{}
+		tokenValues.Set("grant_type", oidc.GrantTypeAuthorizationCode)
+		tokenValues.Set("client_id", "payments")
+		tokenValues.Set("redirect_uri", "https://app.example.com/cb")
+		tokenValues.Set("code", location.Query().Get("code"))
+		req, err = http.NewRequest(http.MethodPost, config.TokenPath, strings.NewReader(tokenValues.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("test %d token request failed: %v %s", idx, rr.Code, rr.Body.String())
+		}
+		response := &payload.TokenSuccess{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.AuthorizationDetails) != 1 || response.AuthorizationDetails[0].Type() != "payment_initiation" {
+			t.Errorf("test %d token response authorization_details was incorrect, got %v", idx, response.AuthorizationDetails)
+		}
+
+		introspection := provider.introspectToken(ctx, response.AccessToken, "", "payments")
+		if !introspection.Active || len(introspection.AuthorizationDetails) != 1 || introspection.AuthorizationDetails[0]["creditorName"] != "Merchant A" {
+			t.Errorf("test %d introspection authorization_details was incorrect, got %v", idx, introspection.AuthorizationDetails)
+		}
+	}
+}
+
+func TestClientConfigurationHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	request := func(method string, target string, registrationAccessToken string, body interface{}) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != nil {
+			b, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = bytes.NewReader(b)
+		}
+		req, err := http.NewRequest(method, target, reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if registrationAccessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+registrationAccessToken)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	decode := func(rr *httptest.ResponseRecorder) *payload.ClientRegistrationResponse {
+		response := &payload.ClientRegistrationResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	// Register.
+	rr := request(http.MethodPost, config.RegistrationPath, "", map[string]interface{}{
+		"client_name":   "Managed",
+		"redirect_uris": []string{"https://app.example.com/cb"},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("registration failed: %v %s", rr.Code, rr.Body.String())
+	}
+	registered := decode(rr)
+	if registered.RegistrationAccessToken == "" {
+		t.Fatalf("registration_access_token must not be empty")
+	}
+	registrationClientURI, err := url.Parse(registered.RegistrationClientURI)
+	if err != nil || registrationClientURI.Query().Get("client_id") != registered.ClientID {
+		t.Fatalf("registration_client_uri was incorrect, got %s", registered.RegistrationClientURI)
+	}
+	target := registrationClientURI.RequestURI()
+
+	// Read.
+	if rr = request(http.MethodGet, target, "invalid", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("read with invalid registration access token must fail, got %v", rr.Code)
+	}
+	rr = request(http.MethodGet, target, registered.RegistrationAccessToken, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("read failed: %v %s", rr.Code, rr.Body.String())
+	}
+	if read := decode(rr); read.ClientID != registered.ClientID || read.ClientName != "Managed" || read.ClientSecret != "" {
+		t.Errorf("read response was incorrect, got %s", rr.Body.String())
+	}
+
+	// Update without changing the name keeps the client secret.
+	rr = request(http.MethodPut, target, registered.RegistrationAccessToken, map[string]interface{}{
+		"client_id":     registered.ClientID,
+		"client_name":   "Managed",
+		"redirect_uris": []string{"https://app.example.com/cb2"},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update failed: %v %s", rr.Code, rr.Body.String())
+	}
+	if updated := decode(rr); updated.ClientSecret != "" {
+		t.Errorf("update must not issue a new client secret")
+	}
+	registration, ok := provider.clients.Get(ctx, registered.ClientID)
+	if !ok || len(registration.RedirectURIs) != 1 || registration.RedirectURIs[0] != "https://app.example.com/cb2" {
+		t.Fatalf("update did not take effect, got %v", registration)
+	}
+	if err := provider.clients.Validate(registration, registered.ClientSecret, "", "", false); err != nil {
+		t.Errorf("client secret must stay valid after update: %v", err)
+	}
+
+	// Update with mismatching client_id fails.
+	rr = request(http.MethodPut, target, registered.RegistrationAccessToken, map[string]interface{}{
+		"client_id":     "other",
+		"redirect_uris": []string{"https://app.example.com/cb"},
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("update with wrong client_id must fail, got %v", rr.Code)
+	}
+
+	// Update of the name issues a new client secret.
+	rr = request(http.MethodPut, target, registered.RegistrationAccessToken, map[string]interface{}{
+		"client_id":     registered.ClientID,
+		"client_secret": registered.ClientSecret,
+		"client_name":   "Renamed",
+		"redirect_uris": []string{"https://app.example.com/cb2"},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update failed: %v %s", rr.Code, rr.Body.String())
+	}
+	renamed := decode(rr)
+	if renamed.ClientSecret == "" || renamed.ClientSecret == registered.ClientSecret {
+		t.Fatalf("rename must issue a new client secret")
+	}
+	registration, _ = provider.clients.Get(ctx, registered.ClientID)
+	if err := provider.clients.Validate(registration, renamed.ClientSecret, "", "", false); err != nil {
+		t.Errorf("new client secret must be valid: %v", err)
+	}
+
+	// Delete.
+	if rr = request(http.MethodDelete, target, registered.RegistrationAccessToken, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete failed: %v %s", rr.Code, rr.Body.String())
+	}
+	if _, ok := provider.clients.Get(ctx, registered.ClientID); ok {
+		t.Errorf("deleted client must not be found")
+	}
+	if rr = request(http.MethodGet, target, registered.RegistrationAccessToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("read of deleted client must fail, got %v", rr.Code)
+	}
+}
+
+func TestRegistrationHandlerPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create our server.
+	httpServer, provider, router, config := NewTestProvider(ctx, t)
+	defer httpServer.Close()
+
+	publisherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := gojwk.PublicKey(&publisherKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.clients.SetRegistrationPolicy(&clients.RegistrationPolicy{
+		InitialAccessTokens: []string{"initial-access-token"},
+		SoftwareStatementIssuers: []*clients.SoftwareStatementIssuer{
+			{
+				Issuer: "https://publisher.example.com",
+				JWKS:   &gojwk.Key{Keys: []*gojwk.Key{jwk}},
+			},
+		},
+		RedirectURIPatterns: []string{"https://*.example.com/*"},
+		GrantTypes:          []string{oidc.GrantTypeAuthorizationCode, oidc.GrantTypeRefreshToken},
+		Scopes:              []string{oidc.ScopeOpenID, oidc.ScopeProfile},
+		MaxSecretLifetime:   3600,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	makeSoftwareStatement := func(iss string, key *ecdsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			oidc.IssuerIdentifierClaim: iss,
+			"software_id":              "publisher-app",
+			"client_name":              "Publisher App",
+		})
+		statement, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return statement
+	}
+
+	for idx, test := range []struct {
+		initialAccessToken string
+		metadata           map[string]interface{}
+		status             int
+		errorID            string
+	}{
+		{"", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}}, http.StatusUnauthorized, ""},
+		{"invalid", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}}, http.StatusUnauthorized, ""},
+		{"initial-access-token", map[string]interface{}{"redirect_uris": []string{"https://app.other.com/cb"}}, http.StatusBadRequest, oidc.ErrorCodeOIDCInvalidRedirectURI},
+		{"initial-access-token", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}, "response_types": []string{oidc.ResponseTypeIDToken}}, http.StatusBadRequest, oidc.ErrorCodeOIDCInvalidClientMetadata},
+		{"initial-access-token", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}, "scope": "openid email"}, http.StatusBadRequest, oidc.ErrorCodeOIDCInvalidClientMetadata},
+		{"initial-access-token", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}, "software_statement": makeSoftwareStatement("https://unknown.example.com", publisherKey)}, http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2UnapprovedSoftwareStatement},
+		{"initial-access-token", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}, "software_statement": makeSoftwareStatement("https://publisher.example.com", otherKey)}, http.StatusBadRequest, konnectoidc.ErrorCodeOAuth2InvalidSoftwareStatement},
+		{"initial-access-token", map[string]interface{}{"redirect_uris": []string{"https://app.example.com/cb"}, "client_name": "Other", "software_statement": makeSoftwareStatement("https://publisher.example.com", publisherKey)}, http.StatusCreated, ""},
+	} {
+		body, _ := json.Marshal(test.metadata)
+		req, err := http.NewRequest(http.MethodPost, config.RegistrationPath, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if test.initialAccessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+test.initialAccessToken)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != test.status {
+			t.Fatalf("test %d status was incorrect, got %v want %v: %s", idx, rr.Code, test.status, rr.Body.String())
+		}
+		if test.errorID != "" {
+			oauth2Error := &konnectoidc.OAuth2Error{}
+			if err := json.Unmarshal(rr.Body.Bytes(), oauth2Error); err != nil || oauth2Error.ErrorID != test.errorID {
+				t.Errorf("test %d error was incorrect, got %s want %s", idx, rr.Body.String(), test.errorID)
+			}
+			continue
+		}
+		if rr.Code != http.StatusCreated {
+			continue
+		}
+
+		response := &payload.ClientRegistrationResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		if response.ClientName != "Publisher App" || response.SoftwareID != "publisher-app" {
+			t.Errorf("test %d software statement values must take precedence, got %s", idx, rr.Body.String())
+		}
+		if response.Scope != "openid profile" {
+			t.Errorf("test %d scope was incorrect, got %s", idx, response.Scope)
+		}
+		if response.ClientSecretExpiresAt == 0 || response.ClientSecretExpiresAt > time.Now().Add(time.Hour).Unix() {
+			t.Errorf("test %d client_secret_expires_at must be limited, got %d", idx, response.ClientSecretExpiresAt)
+		}
+
+		// Dynamic clients are limited to their registered scopes.
+		values := url.Values{
+			"client_id":     {response.ClientID},
+			"response_type": {oidc.ResponseTypeCode},
+			"scope":         {"openid email"},
+			"redirect_uri":  {"https://app.example.com/cb"},
+			"state":         {"policy-state"},
+		}
+		req, err = http.NewRequest(http.MethodGet, config.AuthorizationPath+"?"+values.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), konnectoidc.ErrorCodeOAuth2InvalidScope) {
+			t.Errorf("test %d authorize with unregistered scope must fail, got %v %s", idx, rr.Code, rr.Body.String())
+		}
+
+		// Updates must carry the software statement again when required.
+		provider.clients.RegistrationPolicy().RequireSoftwareStatement = true
+		for _, update := range []struct {
+			softwareStatement string
+			status            int
+		}{
+			{"", http.StatusBadRequest},
+			{makeSoftwareStatement("https://publisher.example.com", publisherKey), http.StatusOK},
+		} {
+			metadata := map[string]interface{}{
+				"client_id":     response.ClientID,
+				"client_name":   "Other",
+				"redirect_uris": []string{"https://app.example.com/cb"},
+			}
+			if update.softwareStatement != "" {
+				metadata["software_statement"] = update.softwareStatement
+			}
+			body, _ := json.Marshal(metadata)
+			req, err = http.NewRequest(http.MethodPut, config.RegistrationPath+"?"+url.Values{"client_id": {response.ClientID}}.Encode(), bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+response.RegistrationAccessToken)
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != update.status {
+				t.Errorf("test %d update status was incorrect, got %v want %v: %s", idx, rr.Code, update.status, rr.Body.String())
+			}
+		}
+		if registration, ok := provider.clients.Get(ctx, response.ClientID); !ok || registration.Name != "Publisher App" {
+			t.Errorf("test %d update must keep software statement values", idx)
+		}
+	}
+}
@@ -199,3 +199,82 @@ c.u(b.B());c.u(n.substr(0,64-(d.f[1]+8&63)));c.c(d.f[0]<<3|d.f[0]>>>28);c.c(d.f[
 </body>
 </html>
 `))
+
+var formPostTemplate = template.Must(template.New("form-post.html").Parse(`
+<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Submit This Form</title>
+</head>
+<body>
+<form method="post" action="{{.URI}}">
+{{range .Fields}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}<noscript><button type="submit">Continue</button></noscript>
+</form>
+<script type="text/javascript" nonce={{.Nonce}}>
+// This implements the OAuth 2.0 Form Post Response Mode as specified in
+// https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+document.forms[0].submit();
+</script>
+</body>
+</html>
+`))
+
+var webMessageTemplate = template.Must(template.New("web-message.html").Parse(`
+<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+</head>
+<body>
+<script type="text/javascript" nonce={{.Nonce}}>
+// This implements the OAuth 2.0 Web Message Response Mode as specified in
+// https://tools.ietf.org/html/draft-sakimura-oauth-wmrm-00
+(function() {
+	var target = window.opener || window.parent;
+	if (target && target !== window) {
+		target.postMessage({
+			type: 'authorization_response',
+			response: {{.Response}}
+		}, {{.Origin}});
+	}
+})();
+</script>
+</body>
+</html>
+`))
+
+var frontchannelLogoutTemplate = template.Must(template.New("frontchannel-logout.html").Parse(`
+<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Signed Out</title>
+</head>
+<body>
+{{range .URIs}}<iframe src="{{.}}" hidden></iframe>
+{{end}}{{if .RedirectURI}}<noscript><a href="{{.RedirectURI}}">Continue</a></noscript>{{else}}<p>You have been signed out.</p>{{end}}
+<script type="text/javascript" nonce={{.Nonce}}>
+// This implements OpenID Connect Front-Channel Logout as specified in
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html#OPLogout
+(function() {
+	var uri = {{.RedirectURI}};
+	if (!uri) {
+		return;
+	}
+	var done = false;
+	var redirect = function() {
+		if (!done) {
+			done = true;
+			window.location.replace(uri);
+		}
+	};
+	// The load event fires once all iframes have loaded.
+	window.addEventListener('load', redirect, false);
+	window.setTimeout(redirect, {{.Timeout}});
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"fmt"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+)
+
+// encryptForClient encrypts the provided plaintext to a key of the provided
+// client registration with the provided JWE alg and enc as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#Encryption and returns
+// the compact serialization. If nested is true, the plaintext is expected to
+// be a signed JWT and the content type is set accordingly.
+func (p *Provider) encryptForClient(registration *clients.ClientRegistration, alg string, enc string, plaintext []byte, nested bool) (string, error) {
+	if enc == "" {
+		enc = konnectoidc.DefaultEncryptionEnc
+	}
+	kid, key, err := registration.EncryptionKey(alg)
+	if err != nil {
+		return "", err
+	}
+
+	options := &jose.EncrypterOptions{}
+	if nested {
+		options = options.WithContentType("JWT")
+	}
+	encrypter, err := jose.NewEncrypter(jose.ContentEncryption(enc), jose.Recipient{
+		Algorithm: jose.KeyAlgorithm(alg),
+		Key:       key,
+		KeyID:     kid,
+	}, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to create encrypter: %w", err)
+	}
+
+	object, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	return object.CompactSerialize()
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/utils"
+)
+
+// Request headers used by trusted proxies to pass on the client certificate
+// of TLS connections they terminate as specified at
+// https://datatracker.ietf.org/doc/html/rfc9440#section-2.
+const (
+	clientCertHeader      = "Client-Cert"
+	clientCertChainHeader = "Client-Cert-Chain"
+)
+
+// clientCertificatesAvailable returns true if client certificates can reach
+// the accociated provider, either with a TLS listener which requests client
+// certificates or from trusted proxies which pass them on in headers.
+func (p *Provider) clientCertificatesAvailable() bool {
+	return p.Config.Config.TLSCertFile != "" || len(p.Config.Config.TrustedProxyIPs) > 0 || len(p.Config.Config.TrustedProxyNets) > 0
+}
+
+// getClientCertificates returns the client certificate chain of the provided
+// request with the leaf certificate first. Certificates are taken from the
+// TLS connection if it has any or from the headers set by a trusted proxy.
+func (p *Provider) getClientCertificates(req *http.Request) ([]*x509.Certificate, error) {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		return req.TLS.PeerCertificates, nil
+	}
+
+	value := req.Header.Get(clientCertHeader)
+	if value == "" {
+		return nil, nil
+	}
+	if trusted, _ := utils.IsRequestFromTrustedSource(req, p.Config.Config.TrustedProxyIPs, p.Config.Config.TrustedProxyNets); !trusted {
+		return nil, nil
+	}
+
+	cert, err := parseClientCertHeaderValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %w", clientCertHeader, err)
+	}
+	certificates := []*x509.Certificate{cert}
+	if chain := req.Header.Get(clientCertChainHeader); chain != "" {
+		for _, v := range strings.Split(chain, ",") {
+			cert, err = parseClientCertHeaderValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s header: %w", clientCertChainHeader, err)
+			}
+			certificates = append(certificates, cert)
+		}
+	}
+
+	return certificates, nil
+}
+
+// parseClientCertHeaderValue parses a DER certificate encoded as byte
+// sequence structured field value.
+func parseClientCertHeaderValue(value string) (*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+		return nil, fmt.Errorf("not a byte sequence")
+	}
+	der, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// authenticateTLSClient validates the client certificate of the provided
+// request for clients which are registered to authenticate with mutual TLS as
+// specified at https://tools.ietf.org/html/rfc8705#section-2 and returns the
+// client certificate. Returns nil without error for other clients.
+func (p *Provider) authenticateTLSClient(req *http.Request, clientDetails *clients.Details) (*x509.Certificate, error) {
+	if clientDetails == nil || clientDetails.Registration == nil || !clientDetails.Registration.UsesTLSClientAuth() {
+		return nil, nil
+	}
+	registration := clientDetails.Registration
+
+	certificates, err := p.getClientCertificates(req)
+	if err != nil {
+		return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+	}
+	if len(certificates) == 0 {
+		return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client certificate required")
+	}
+	cert := certificates[0]
+
+	switch registration.RawTokenEndpointAuthMethod {
+	case konnectoidc.AuthMethodTLSClientAuth:
+		// PKI method, see https://tools.ietf.org/html/rfc8705#section-2.1
+		if p.Config.Config.TLSClientCAs == nil {
+			return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "tls_client_auth is not supported")
+		}
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range certificates[1:] {
+			intermediates.AddCert(intermediate)
+		}
+		if _, err = cert.Verify(x509.VerifyOptions{
+			Roots:         p.Config.Config.TLSClientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, err.Error())
+		}
+		if registration.TLSClientAuthSubjectDN == "" || cert.Subject.String() != registration.TLSClientAuthSubjectDN {
+			return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client certificate subject mismatch")
+		}
+
+	case konnectoidc.AuthMethodSelfSignedTLSClientAuth:
+		// Self-signed certificate method, see https://tools.ietf.org/html/rfc8705#section-2.2
+		now := time.Now()
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client certificate expired or not yet valid")
+		}
+		if !registration.HasPublicKey(cert.PublicKey) {
+			return nil, konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidClient, "client certificate not registered")
+		}
+	}
+
+	return cert, nil
+}
+
+// getCertificateThumbprint returns the base64url encoded SHA-256 thumbprint
+// of the provided certificate as used in x5t#S256 confirmation claims.
+func getCertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -24,24 +24,32 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-querystring/query"
 	"github.com/libregraph/oidc-go"
+	"github.com/longsleep/rndm"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ed25519"
 
 	konnect "github.com/libregraph/lico"
 	"github.com/libregraph/lico/identity"
+	"github.com/libregraph/lico/identity/authorities"
 	"github.com/libregraph/lico/identity/clients"
 	identityManagers "github.com/libregraph/lico/identity/managers"
 	"github.com/libregraph/lico/managers"
 	konnectoidc "github.com/libregraph/lico/oidc"
 	"github.com/libregraph/lico/oidc/code"
+	"github.com/libregraph/lico/oidc/device"
+	"github.com/libregraph/lico/oidc/par"
+	"github.com/libregraph/lico/oidc/revocation"
 	"github.com/libregraph/lico/signing"
 	"github.com/libregraph/lico/utils"
 )
@@ -50,10 +58,12 @@ import (
 type Provider struct {
 	Config *Config
 
-	issuerIdentifier string
-	metadata         *oidc.WellKnown
+	issuerIdentifier            string
+	metadata                    *WellKnown
+	authorizationServerMetadata *AuthorizationServerMetadata
 
 	wellKnownPath          string
+	metadataPath           string
 	jwksPath               string
 	authorizationPath      string
 	tokenPath              string
@@ -62,17 +72,39 @@ type Provider struct {
 	checkSessionIframePath string
 	registrationPath       string
 
+	deviceAuthorizationPath string
+	deviceVerificationPath  string
+	introspectionPath       string
+	revocationPath          string
+
+	pushedAuthorizationRequestPath string
+
 	identityManager   identity.Manager
 	guestManager      identity.Manager
 	codeManager       code.Manager
+	deviceManager     device.Manager
+	revocationStore   revocation.Store
+	parManager        par.Manager
 	encryptionManager *identityManagers.EncryptionManager
 	clients           *clients.Registry
+	authorities       *authorities.Registry
 
 	signingKeys          map[jwt.SigningMethod]*SigningKey
 	signingMethodDefault jwt.SigningMethod
 	validationKeys       map[string]crypto.PublicKey
 	certificates         map[string][]*x509.Certificate
 
+	requestObjectClient *http.Client
+	requestObjectCache  *requestObjectCache
+
+	dpopReplayCache            *replayCache
+	clientAssertionReplayCache *replayCache
+
+	pairwiseSubjectSecret []byte
+
+	backchannelLogoutClient *http.Client
+	endedSessionsCache      *replayCache
+
 	browserStateCookiePath     string
 	browserStateCookieName     string
 	browserStateCookieSameSite http.SameSite
@@ -95,6 +127,7 @@ func NewProvider(c *Config) (*Provider, error) {
 
 		issuerIdentifier:       c.IssuerIdentifier,
 		wellKnownPath:          c.WellKnownPath,
+		metadataPath:           c.MetadataPath,
 		jwksPath:               c.JwksPath,
 		authorizationPath:      c.AuthorizationPath,
 		tokenPath:              c.TokenPath,
@@ -103,10 +136,34 @@ func NewProvider(c *Config) (*Provider, error) {
 		checkSessionIframePath: c.CheckSessionIframePath,
 		registrationPath:       c.RegistrationPath,
 
+		deviceAuthorizationPath: c.DeviceAuthorizationPath,
+		deviceVerificationPath:  c.DeviceVerificationPath,
+		introspectionPath:       c.IntrospectionPath,
+		revocationPath:          c.RevocationPath,
+
+		pushedAuthorizationRequestPath: c.PushedAuthorizationRequestPath,
+
 		signingKeys:    make(map[jwt.SigningMethod]*SigningKey),
 		validationKeys: make(map[string]crypto.PublicKey),
 		certificates:   make(map[string][]*x509.Certificate),
 
+		requestObjectClient: &http.Client{
+			Timeout:   requestObjectFetchTimeout,
+			Transport: c.Config.HTTPTransport,
+		},
+		requestObjectCache: newRequestObjectCache(),
+
+		dpopReplayCache:            newReplayCache(),
+		clientAssertionReplayCache: newReplayCache(),
+
+		pairwiseSubjectSecret: c.PairwiseSubjectSecret,
+
+		backchannelLogoutClient: &http.Client{
+			Timeout:   backchannelLogoutTimeout,
+			Transport: c.Config.HTTPTransport,
+		},
+		endedSessionsCache: newReplayCache(),
+
 		browserStateCookiePath:     c.BrowserStateCookiePath,
 		browserStateCookieName:     c.BrowserStateCookieName,
 		browserStateCookieSameSite: c.BrowserStateCookieSameSite,
@@ -142,9 +199,16 @@ func (p *Provider) RegisterManagers(mgrs *managers.Managers) error {
 		// redirects whenever the same user signs in again.
 		return p.removeBrowserStateCookie(rw)
 	}
-	onUnsetLogon := func(ctx context.Context, rw http.ResponseWriter) error {
+	onUnsetLogon := func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 		var err error
 
+		// Notify clients of the OIDC client session.
+		if req != nil {
+			if session, _ := p.getSession(req); session != nil {
+				p.endSession(ctx, session)
+			}
+		}
+
 		// Remove browser state cookie.
 		if errBsc := p.removeBrowserStateCookie(rw); errBsc != nil {
 			err = errBsc
@@ -166,6 +230,26 @@ func (p *Provider) RegisterManagers(mgrs *managers.Managers) error {
 		p.guestManager.OnUnsetLogon(onUnsetLogon)
 	}
 
+	// Add device manager if any can be found.
+	if deviceManager, _ := mgrs.Get("device"); deviceManager != nil {
+		p.deviceManager = deviceManager.(device.Manager)
+	}
+
+	// Add revocation store if any can be found.
+	if revocationStore, _ := mgrs.Get("revocation"); revocationStore != nil {
+		p.revocationStore = revocationStore.(revocation.Store)
+	}
+
+	// Add pushed authorization request manager if any can be found.
+	if parManager, _ := mgrs.Get("par"); parManager != nil {
+		p.parManager = parManager.(par.Manager)
+	}
+
+	// Add authorities registry if any can be found.
+	if authorityRegistry, _ := mgrs.Get("authorities"); authorityRegistry != nil {
+		p.authorities = authorityRegistry.(*authorities.Registry)
+	}
+
 	if p.Config.RegistrationPath != "" {
 		// NOTE(longsleep): This is hackish. Find a better way to propagate our
 		// provides JWT stuff to the client registry.
@@ -380,7 +464,7 @@ func (p *Provider) SetCertificate(id string, certificates []*x509.Certificate) e
 // this once all other settings at the provider have been done.
 func (p *Provider) InitializeMetadata() error {
 	// Create well-known document.
-	p.metadata = &oidc.WellKnown{
+	p.metadata = &WellKnown{WellKnown: &oidc.WellKnown{
 		Issuer:                p.issuerIdentifier,
 		AuthorizationEndpoint: p.makeIssURL(p.authorizationPath),
 		TokenEndpoint:         p.makeIssURL(p.tokenPath),
@@ -398,9 +482,7 @@ func (p *Provider) InitializeMetadata() error {
 			oidc.ResponseTypeCodeIDToken,
 			oidc.ResponseTypeCodeIDTokenToken,
 		},
-		SubjectTypesSupported: []string{
-			oidc.SubjectIDPublic,
-		},
+		SubjectTypesSupported:    p.subjectTypesSupported(),
 		ClaimsParameterSupported: true,
 		ClaimsSupported: uniqueStrings(append([]string{
 			oidc.IssuerIdentifierClaim,
@@ -408,16 +490,24 @@ func (p *Provider) InitializeMetadata() error {
 			oidc.AudienceClaim,
 			oidc.ExpirationClaim,
 			oidc.IssuedAtClaim,
+			konnectoidc.ACRClaim,
+			konnectoidc.AMRClaim,
 		}, p.identityManager.ClaimsSupported(nil)...)),
 		RequestParameterSupported:    true,
-		RequestURIParameterSupported: false,
-	}
+		RequestURIParameterSupported: true,
+	}}
 
 	p.metadata.IDTokenSigningAlgValuesSupported = make([]string, 0)
 	for alg := range p.signingKeys {
 		p.metadata.IDTokenSigningAlgValuesSupported = append(p.metadata.IDTokenSigningAlgValuesSupported, alg.Alg())
 	}
 	p.metadata.UserInfoSigningAlgValuesSupported = p.metadata.IDTokenSigningAlgValuesSupported
+	p.metadata.ACRValuesSupported = konnectoidc.ACRValuesSupported
+	p.metadata.AuthorizationDetailsTypesSupported = p.clients.AuthorizationDetailsTypes()
+	p.metadata.IDTokenEncryptionAlgValuesSupported = konnectoidc.EncryptionAlgValuesSupported
+	p.metadata.IDTokenEncryptionEncValuesSupported = konnectoidc.EncryptionEncValuesSupported
+	p.metadata.UserInfoEncryptionAlgValuesSupported = konnectoidc.EncryptionAlgValuesSupported
+	p.metadata.UserInfoEncryptionEncValuesSupported = konnectoidc.EncryptionEncValuesSupported
 	p.metadata.RequestObjectSigningAlgValuesSupported = []string{
 		jwt.SigningMethodES256.Alg(),
 		jwt.SigningMethodES384.Alg(),
@@ -433,9 +523,86 @@ func (p *Provider) InitializeMetadata() error {
 	}
 	p.metadata.TokenEndpointAuthMethodsSupported = []string{
 		oidc.AuthMethodClientSecretBasic,
+		oidc.AuthMethodClientSecretPost,
+		oidc.AuthMethodClientSecretJWT,
+		oidc.AuthMethodPrivateKeyJWT,
 		oidc.AuthMethodNone,
 	}
-	p.metadata.TokenEndpointAuthSigningAlgValuesSupported = p.metadata.IDTokenSigningAlgValuesSupported
+	if p.clientCertificatesAvailable() {
+		p.metadata.TokenEndpointAuthMethodsSupported = append(p.metadata.TokenEndpointAuthMethodsSupported, konnectoidc.AuthMethodSelfSignedTLSClientAuth)
+		if p.Config.Config.TLSClientCAs != nil {
+			p.metadata.TokenEndpointAuthMethodsSupported = append(p.metadata.TokenEndpointAuthMethodsSupported, konnectoidc.AuthMethodTLSClientAuth)
+		}
+		p.metadata.TLSClientCertificateBoundAccessTokens = true
+	}
+	if p.endSessionPath != "" {
+		p.metadata.BackchannelLogoutSupported = true
+		p.metadata.BackchannelLogoutSessionSupported = true
+		p.metadata.FrontchannelLogoutSupported = true
+		p.metadata.FrontchannelLogoutSessionSupported = true
+	}
+	p.metadata.TokenEndpointAuthSigningAlgValuesSupported = clientAssertionSigningAlgValuesSupported
+	p.metadata.GrantTypesSupported = []string{
+		oidc.GrantTypeAuthorizationCode,
+		oidc.GrantTypeImplicit,
+		oidc.GrantTypeRefreshToken,
+		konnectoidc.GrantTypeClientCredentials,
+		konnectoidc.GrantTypeTokenExchange,
+	}
+	p.metadata.ResponseModesSupported = []string{
+		oidc.ResponseModeQuery,
+		oidc.ResponseModeFragment,
+		konnectoidc.ResponseModeFormPost,
+		konnectoidc.ResponseModeWebMessage,
+		konnectoidc.ResponseModeJWT,
+		konnectoidc.ResponseModeQueryJWT,
+		konnectoidc.ResponseModeFragmentJWT,
+		konnectoidc.ResponseModeFormPostJWT,
+	}
+	p.metadata.AuthorizationSigningAlgValuesSupported = p.metadata.IDTokenSigningAlgValuesSupported
+	p.metadata.DPoPSigningAlgValuesSupported = dpopSigningAlgValuesSupported
+	if p.introspectionPath != "" {
+		p.metadata.IntrospectionEndpoint = p.makeIssURL(p.introspectionPath)
+		// Introspection authenticates clients like the token endpoint, but
+		// requires confidential clients.
+		p.metadata.IntrospectionEndpointAuthMethodsSupported = []string{}
+		for _, method := range p.metadata.TokenEndpointAuthMethodsSupported {
+			if method != oidc.AuthMethodNone {
+				p.metadata.IntrospectionEndpointAuthMethodsSupported = append(p.metadata.IntrospectionEndpointAuthMethodsSupported, method)
+			}
+		}
+	}
+	if p.revocationPath != "" && p.revocationStore != nil {
+		p.metadata.RevocationEndpoint = p.makeIssURL(p.revocationPath)
+		// Revocation authenticates clients like the token endpoint.
+		p.metadata.RevocationEndpointAuthMethodsSupported = append([]string{}, p.metadata.TokenEndpointAuthMethodsSupported...)
+	}
+	if p.authorities != nil {
+		p.metadata.GrantTypesSupported = append(p.metadata.GrantTypesSupported, konnectoidc.GrantTypeJWTBearer)
+	}
+	if p.deviceAuthorizationPath != "" && p.deviceManager != nil {
+		p.metadata.DeviceAuthorizationEndpoint = p.makeIssURL(p.deviceAuthorizationPath)
+		p.metadata.GrantTypesSupported = append(p.metadata.GrantTypesSupported, konnectoidc.GrantTypeDeviceCode)
+	}
+	if p.pushedAuthorizationRequestPath != "" && p.parManager != nil {
+		p.metadata.PushedAuthorizationRequestEndpoint = p.makeIssURL(p.pushedAuthorizationRequestPath)
+	}
+	p.metadata.CodeChallengeMethodsSupported = []string{
+		oidc.S256CodeChallengeMethod,
+		oidc.PlainCodeChallengeMethod,
+	}
+
+	// Create OAuth 2.0 authorization server meta data document.
+	p.authorizationServerMetadata = &AuthorizationServerMetadata{
+		WellKnown: p.metadata,
+	}
+	if p.Config.SignedMetadata {
+		signedMetadata, err := p.makeSignedMetadata(p.metadata)
+		if err != nil {
+			return fmt.Errorf("failed to create signed metadata: %w", err)
+		}
+		p.authorizationServerMetadata.SignedMetadata = signedMetadata
+	}
 
 	return nil
 }
@@ -445,6 +612,8 @@ func (p *Provider) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	switch path := req.URL.Path; {
 	case path == p.wellKnownPath:
 		cors.Default().ServeHTTP(rw, req, p.WellKnownHandler)
+	case path == p.metadataPath:
+		cors.Default().ServeHTTP(rw, req, p.MetadataHandler)
 	case path == p.jwksPath:
 		cors.Default().ServeHTTP(rw, req, p.JwksHandler)
 	case path == p.authorizationPath:
@@ -460,6 +629,14 @@ func (p *Provider) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		p.CheckSessionIframeHandler(rw, req)
 	case path == p.registrationPath:
 		p.RegistrationHandler(rw, req)
+	case path == p.deviceAuthorizationPath:
+		cors.Default().ServeHTTP(rw, req, p.DeviceAuthorizationHandler)
+	case path == p.introspectionPath:
+		p.IntrospectionHandler(rw, req)
+	case path == p.revocationPath:
+		cors.Default().ServeHTTP(rw, req, p.RevocationHandler)
+	case path == p.pushedAuthorizationRequestPath:
+		p.PushedAuthorizationRequestHandler(rw, req)
 	default:
 		http.NotFound(rw, req)
 	}
@@ -481,6 +658,89 @@ func (p *Provider) Found(rw http.ResponseWriter, uri *url.URL, params interface{
 	}
 }
 
+// FormPost writes a HTML page to the provided ResponseWriter which submits the
+// provided params to the provided uri with HTTP POST as specified at
+// https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+func (p *Provider) FormPost(rw http.ResponseWriter, uri *url.URL, params interface{}) {
+	values, err := query.Values(params)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to encode form post parameters")
+		p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	type field struct {
+		Name  string
+		Value string
+	}
+	fields := make([]*field, 0, len(values))
+	for name := range values {
+		fields = append(fields, &field{
+			Name:  name,
+			Value: values.Get(name),
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+
+	nonce := rndm.GenerateRandomString(32)
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	rw.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; script-src 'nonce-%s'", nonce))
+
+	data := struct {
+		URI    template.URL
+		Fields []*field
+		Nonce  string
+	}{
+		// NOTE(longsleep): The uri is a validated redirect URI, so it is safe
+		// to use it even when it has a custom scheme.
+		URI:    template.URL(uri.String()),
+		Fields: fields,
+		Nonce:  nonce,
+	}
+	formPostTemplate.Execute(rw, data)
+}
+
+// WebMessage writes a HTML page to the provided ResponseWriter which posts
+// the provided params to the window which opened or embeds it, restricted to
+// the origin of the provided uri as specified at
+// https://tools.ietf.org/html/draft-sakimura-oauth-wmrm-00
+func (p *Provider) WebMessage(rw http.ResponseWriter, uri *url.URL, params interface{}) {
+	values, err := query.Values(params)
+	if err != nil {
+		p.logger.WithError(err).Debugln("failed to encode web message parameters")
+		p.ErrorPage(rw, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	response := make(map[string]string)
+	for name := range values {
+		response[name] = values.Get(name)
+	}
+
+	nonce := rndm.GenerateRandomString(32)
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	rw.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'none'; script-src 'nonce-%s'", nonce))
+
+	data := struct {
+		Response map[string]string
+		Origin   string
+		Nonce    string
+	}{
+		Response: response,
+		Origin:   uri.Scheme + "://" + uri.Host,
+		Nonce:    nonce,
+	}
+	webMessageTemplate.Execute(rw, data)
+}
+
 // LoginRequiredPage writes a HTTP 30 to the provided ResponseWrite with the
 // URL of the provided request (set to the scheme and host of issuer) as
 // continue parameter.
@@ -511,9 +771,11 @@ func (p *Provider) GetAccessTokenClaimsFromRequest(req *http.Request) (*konnect.
 
 	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
 	switch auth[0] {
+	case konnectoidc.TokenTypeDPoP:
+		fallthrough
 	case oidc.TokenTypeBearer:
 		if len(auth) != 2 {
-			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "Invalid Bearer authorization header format")
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, fmt.Sprintf("Invalid %s authorization header format", auth[0]))
 			break
 		}
 		claims = &konnect.AccessTokenClaims{}
@@ -524,10 +786,49 @@ func (p *Provider) GetAccessTokenClaimsFromRequest(req *http.Request) (*konnect.
 		if err != nil {
 			// Wrap as OAuth2 error.
 			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, err.Error())
+			break
+		}
+		if revoked, revokedErr := p.isRevoked(claims.Id, claims.Family); revokedErr != nil {
+			err = revokedErr
+			break
+		} else if revoked {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "token revoked")
+			break
+		}
+
+		// Certificate bound access tokens must be presented with the bound
+		// client certificate as specified at
+		// https://tools.ietf.org/html/rfc8705#section-3
+		if claims.Confirmation != nil && claims.Confirmation.X5tS256 != "" {
+			certificates, certificatesErr := p.getClientCertificates(req)
+			if certificatesErr != nil || len(certificates) == 0 || getCertificateThumbprint(certificates[0]) != claims.Confirmation.X5tS256 {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "client certificate mismatch")
+				break
+			}
+		}
+
+		// DPoP bound access tokens must be presented with the DPoP scheme
+		// and a proof for the bound key as specified at
+		// https://datatracker.ietf.org/doc/html/rfc9449#section-7.1
+		if claims.Confirmation == nil || claims.Confirmation.JKT == "" {
+			if auth[0] == konnectoidc.TokenTypeDPoP {
+				err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "token is not DPoP bound")
+			}
+			break
+		}
+		if auth[0] != konnectoidc.TokenTypeDPoP {
+			err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidToken, "DPoP bound token requires DPoP authorization")
+			break
+		}
+		jkt, proofErr := p.validateDPoPProof(req, req.URL.Path, auth[1])
+		if proofErr != nil {
+			err = proofErr
+		} else if jkt != claims.Confirmation.JKT {
+			err = konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "DPoP proof key mismatch")
 		}
 
 	default:
-		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "Bearer authorization required")
+		err = konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "Bearer or DPoP authorization required")
 	}
 
 	return claims, err
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
+
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/oidc/payload"
+)
+
+// validateClientRegistrationRequest validates the provided client
+// registration request, as sent to register or to update a dynamic client.
+func (p *Provider) validateClientRegistrationRequest(ctx context.Context, crr *payload.ClientRegistrationRequest) error {
+	err := crr.Validate()
+	if err != nil {
+		return err
+	}
+	if crr.SubjectType != "" && !containsString(p.metadata.SubjectTypesSupported, crr.SubjectType) {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported subject_type")
+	}
+	if crr.SectorIdentifierURI != "" {
+		err = p.validateSectorIdentifierURI(ctx, crr)
+		if err != nil {
+			return err
+		}
+	}
+	if crr.RawUserInfoSignedResponseAlg != "" {
+		// Only allow algs which can be signed with, so userinfo requests of
+		// the client do not fail later.
+		if _, ok := p.getSigningKey(jwt.GetSigningMethod(crr.RawUserInfoSignedResponseAlg)); !ok {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "unsupported userinfo_signed_response_alg")
+		}
+	}
+
+	return nil
+}
+
+// makeRegistrationClientURI returns the client configuration endpoint URL of
+// the dynamic client with the provided client ID as specified at
+// https://tools.ietf.org/html/rfc7592#section-3
+func (p *Provider) makeRegistrationClientURI(clientID string) string {
+	return p.makeIssURL(p.registrationPath) + "?" + url.Values{"client_id": {clientID}}.Encode()
+}
+
+// applySoftwareStatement verifies the software statement of the provided
+// client registration request with the keys of its trusted issuer and applies
+// its client metadata to the request as specified at
+// https://tools.ietf.org/html/rfc7591#section-3.1.1
+func (p *Provider) applySoftwareStatement(ctx context.Context, policy *clients.RegistrationPolicy, crr *payload.ClientRegistrationRequest) error {
+	if crr.SoftwareStatement == "" {
+		if policy != nil && policy.RequireSoftwareStatement {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidSoftwareStatement, "software_statement required")
+		}
+		return nil
+	}
+	if policy == nil {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnapprovedSoftwareStatement, "no trusted software statement issuers")
+	}
+
+	var untrusted bool
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(crr.SoftwareStatement, claims, func(token *jwt.Token) (interface{}, error) {
+		iss, _ := claims[oidc.IssuerIdentifierClaim].(string)
+		key, keyErr := policy.SoftwareStatementKey(iss, token.Header[oidc.JWTHeaderKeyID])
+		untrusted = keyErr != nil
+		return key, keyErr
+	})
+	if err != nil {
+		if untrusted {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2UnapprovedSoftwareStatement, err.Error())
+		}
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidSoftwareStatement, err.Error())
+	}
+
+	if err = crr.ApplySoftwareStatementClaims(claims); err != nil {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidSoftwareStatement, err.Error())
+	}
+
+	return nil
+}
+
+// applyRegistrationPolicy checks the provided client registration against the
+// dynamic client registration policy and limits its scopes accordingly.
+func (p *Provider) applyRegistrationPolicy(ctx context.Context, policy *clients.RegistrationPolicy, cr *clients.ClientRegistration) error {
+	if policy == nil {
+		return nil
+	}
+
+	if err := policy.ValidateRedirectURIs(cr.RedirectURIs); err != nil {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidRedirectURI, err.Error())
+	}
+	if err := policy.ValidateRedirectURIs(cr.PostLogoutRedirectURIs); err != nil {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, err.Error())
+	}
+	if err := policy.ValidateGrantTypes(cr.GrantTypes); err != nil {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, err.Error())
+	}
+	scopes, err := policy.ApplyScopes(cr.Scopes)
+	if err != nil {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, err.Error())
+	}
+	cr.Scopes = scopes
+
+	return nil
+}
+
+// getBearerToken returns the Bearer token of the Authorization header of the
+// provided request, if any.
+func getBearerToken(req *http.Request) string {
+	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != oidc.TokenTypeBearer {
+		return ""
+	}
+	return auth[1]
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package provider
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	replayCachePurgeSize     = 1024
+	replayCachePurgeInterval = 10 * time.Second
+	replayCacheMaxSize       = 65536
+)
+
+// errReplayCacheFull is returned by replayCache.Add when the cache is full of
+// entries which did not expire yet.
+var errReplayCacheFull = errors.New("replay cache is full")
+
+// replayCache remembers seen one-time use values like the jti of JWTs until
+// they expire. The number of remembered values is limited and expired values
+// are purged at most once per purge interval, so adding stays cheap even when
+// the cache is full.
+type replayCache struct {
+	sync.Mutex
+
+	entries    map[string]time.Time
+	lastPurged time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Add adds the provided key to the cache and returns true if the key was not
+// already found in the cache. If the cache is full, the key is not added and
+// errReplayCacheFull is returned, so callers can fail closed.
+func (c *replayCache) Add(key string, expiresAt time.Time) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if seenExpiresAt, ok := c.entries[key]; ok && now.Before(seenExpiresAt) {
+		return false, nil
+	}
+	if len(c.entries) >= replayCachePurgeSize && now.Sub(c.lastPurged) >= replayCachePurgeInterval {
+		for k, entryExpiresAt := range c.entries {
+			if now.After(entryExpiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastPurged = now
+	}
+	if len(c.entries) >= replayCacheMaxSize {
+		return false, errReplayCacheFull
+	}
+
+	c.entries[key] = expiresAt
+	return true, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package provider
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplayCache(t *testing.T) {
+	cache := newReplayCache()
+
+	if added, err := cache.Add("key", time.Now().Add(time.Minute)); err != nil || !added {
+		t.Fatalf("first add must succeed, got %v %v", added, err)
+	}
+	if added, err := cache.Add("key", time.Now().Add(time.Minute)); err != nil || added {
+		t.Fatalf("second add must report replay, got %v %v", added, err)
+	}
+
+	// A full cache fails closed.
+	for i := len(cache.entries); i < replayCacheMaxSize; i++ {
+		cache.entries[strconv.Itoa(i)] = time.Now().Add(time.Minute)
+	}
+	if added, err := cache.Add("other", time.Now().Add(time.Minute)); err != errReplayCacheFull || added {
+		t.Fatalf("add to full cache must fail, got %v %v", added, err)
+	}
+
+	// Expired entries are purged, making room again.
+	for k := range cache.entries {
+		cache.entries[k] = time.Now().Add(-time.Second)
+	}
+	cache.lastPurged = time.Time{}
+	if added, err := cache.Add("other", time.Now().Add(time.Minute)); err != nil || !added {
+		t.Fatalf("add after purge must succeed, got %v %v", added, err)
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("expired entries must be purged, got %d entries", len(cache.entries))
+	}
+}
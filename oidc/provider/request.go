@@ -0,0 +1,311 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/libregraph/oidc-go"
+
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/oidc/par"
+	"github.com/libregraph/lico/oidc/payload"
+	"github.com/libregraph/lico/utils"
+)
+
+const (
+	requestObjectSizeLimit     = 1024 * 64
+	requestObjectFetchTimeout  = 5 * time.Second
+	requestObjectCacheDuration = 5 * time.Minute
+	requestObjectCacheSize     = 1024
+)
+
+// pushedAuthorizationRequestInteractionParameters lists the parameters which
+// are added by the sign-in and consent flow when redirecting back to the
+// authorization endpoint. Those are taken from the actual request instead of
+// the pushed authorization request.
+var pushedAuthorizationRequestInteractionParameters = []string{
+	"konnect",
+	"identifier",
+	"error",
+	"error_description",
+}
+
+// pushedAuthorizationRequestReturnParameters lists the parameters which mark
+// that the sign-in and consent flow returns to the authorization endpoint.
+var pushedAuthorizationRequestReturnParameters = []string{
+	"konnect",
+	"identifier",
+}
+
+// requestObjectKeyFunc returns a jwt.Keyfunc which looks up the keys to
+// validate signed request objects according to the spec defined at
+// https://openid.net/specs/openid-connect-core-1_0.html#SignedRequestObject
+func (p *Provider) requestObjectKeyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if claims, ok := token.Claims.(*payload.RequestObjectClaims); ok {
+			registration, _ := p.clients.Get(ctx, claims.ClientID)
+			if registration != nil {
+				if registration.RawRequestObjectSigningAlg != "" {
+					if token.Method.Alg() != registration.RawRequestObjectSigningAlg {
+						return nil, fmt.Errorf("token alg does not match client registration")
+					}
+				}
+				if token.Method == jwt.SigningMethodNone {
+					// Request parameters do not need to be signed to be valid, so
+					// none is allowed in this special case.
+					return jwt.UnsafeAllowNoneSignatureType, nil
+				}
+				// Get secure client.
+				if registration.JWKS != nil {
+					secureClient, err := registration.Secure(token.Header[oidc.JWTHeaderKeyID])
+					if err != nil {
+						return nil, err
+					}
+					if err := claims.SetSecure(secureClient); err != nil {
+						return nil, err
+					}
+					return secureClient.PublicKey, err
+				}
+				return nil, fmt.Errorf("no client keys registered")
+			} else {
+				// Also allow, when client is not registered and the token is unsigned.
+				if token.Method == jwt.SigningMethodNone {
+					// Request parameters do not need to be signed to be valid, so
+					// none is allowed in this special case.
+					return jwt.UnsafeAllowNoneSignatureType, nil
+				}
+			}
+		}
+
+		return nil, fmt.Errorf("not validated")
+	}
+}
+
+// resolvePushedAuthorizationRequest replaces the form data of the provided
+// authorization request with the parameters of the pushed authorization
+// request referenced by its request_uri parameter as specified at
+// https://tools.ietf.org/html/rfc9126#section-4 and returns the request URI.
+// An empty request URI is returned for requests which do not reference a
+// pushed authorization request.
+func (p *Provider) resolvePushedAuthorizationRequest(req *http.Request) (string, error) {
+	requestURI := req.Form.Get("request_uri")
+	if !strings.HasPrefix(requestURI, par.RequestURIPrefix) {
+		return "", nil
+	}
+
+	if p.parManager == nil {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOIDCInvalidRequestURI, "pushed authorization requests are not supported")
+	}
+	record, found := p.parManager.Get(requestURI)
+	if !found {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOIDCInvalidRequestURI, "request_uri not found or expired")
+	}
+	if req.Form.Get("client_id") != record.ClientID {
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOIDCInvalidRequestURI, "request_uri was issued to another client")
+	}
+
+	values := make(url.Values)
+	for key, value := range record.Values {
+		values[key] = value
+	}
+	for _, key := range pushedAuthorizationRequestInteractionParameters {
+		if value, ok := req.Form[key]; ok {
+			values[key] = value
+		}
+	}
+	// The prompt of the pushed authorization request is kept, so it cannot be
+	// removed in the front channel. Only the sign-in and consent flow returns
+	// with prompt=none, once the requested interaction has happened.
+	if req.Form.Get("prompt") == oidc.PromptNone {
+		for _, key := range pushedAuthorizationRequestReturnParameters {
+			if req.Form.Get(key) != "" {
+				values.Set("prompt", oidc.PromptNone)
+				break
+			}
+		}
+	}
+	req.Form = values
+
+	// Replace the query as well, since the sign-in and consent flow build
+	// their URLs from it and eventually return here with the same request
+	// URI which is then resolved again.
+	query := make(url.Values)
+	for key, value := range values {
+		query[key] = value
+	}
+	query.Set("request_uri", requestURI)
+	req.URL.RawQuery = query.Encode()
+
+	return requestURI, nil
+}
+
+// resolveRequestURI fetches the request object referenced by the request_uri
+// parameter of the provided authorization request as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#RequestUriParameter
+// and replaces the request_uri parameter in the request's form data with a
+// request parameter holding the fetched request object. Only https URIs which
+// are registered for the requesting client are fetched.
+func (p *Provider) resolveRequestURI(req *http.Request) error {
+	requestURIString := req.Form.Get("request_uri")
+	if requestURIString == "" {
+		return nil
+	}
+	if req.Form.Get("request") != "" {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidRequest, "request and request_uri must not be used together")
+	}
+
+	requestURI, err := url.Parse(requestURIString)
+	if err != nil || requestURI.Scheme != "https" || requestURI.Host == "" {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOIDCInvalidRequestURI, "request_uri must be an absolute https URI")
+	}
+
+	registration, _ := p.clients.Get(req.Context(), req.Form.Get("client_id"))
+	if registration == nil || !registration.HasRequestURI(requestURI) {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOIDCInvalidRequestURI, "request_uri is not registered for client")
+	}
+
+	request, err := p.fetchRequestObject(req.Context(), requestURI)
+	if err != nil {
+		p.logger.WithError(err).WithField("request_uri", requestURIString).Debugln("failed to fetch request object")
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOIDCInvalidRequestURI, "failed to fetch request_uri")
+	}
+
+	// Continue as if the request object was passed by value, so it gets
+	// validated and applied the same way.
+	req.Form.Del("request_uri")
+	req.Form.Set("request", request)
+
+	return nil
+}
+
+// fetchRequestObject returns the request object found at the provided URI,
+// either from cache or by retrieving it with a size and time limit.
+func (p *Provider) fetchRequestObject(ctx context.Context, requestURI *url.URL) (string, error) {
+	// The fragment is part of the cache key, allowing clients to change the
+	// request object contents without registering a new request URI.
+	key := requestURI.String()
+	if request, ok := p.requestObjectCache.Get(key); ok {
+		return request, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestObjectFetchTimeout)
+	defer cancel()
+
+	fetchURI := *requestURI
+	fetchURI.Fragment = ""
+	fetchURI.RawFragment = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURI.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/oauth-authz-req+jwt, application/jwt")
+	req.Header.Set("User-Agent", utils.DefaultHTTPUserAgent)
+
+	response, err := p.requestObjectClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status: %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, requestObjectSizeLimit+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > requestObjectSizeLimit {
+		return "", fmt.Errorf("request object too large")
+	}
+
+	request := strings.TrimSpace(string(body))
+	p.requestObjectCache.Set(key, request)
+
+	return request, nil
+}
+
+// requestObjectCache is a size limited cache for request objects fetched by
+// reference. Its methods are safe to call from multiple Go routines.
+type requestObjectCache struct {
+	sync.Mutex
+
+	entries map[string]*requestObjectCacheEntry
+}
+
+type requestObjectCacheEntry struct {
+	request   string
+	expiresAt time.Time
+}
+
+func newRequestObjectCache() *requestObjectCache {
+	return &requestObjectCache{
+		entries: make(map[string]*requestObjectCacheEntry),
+	}
+}
+
+// Get returns the cached request object for the provided key plus true if
+// found and not expired.
+func (c *requestObjectCache) Get(key string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+
+	return entry.request, true
+}
+
+// Set adds the provided request object to the cache. Expired entries are
+// purged when the cache is full and nothing is added if that does not help.
+func (c *requestObjectCache) Set(key string, request string) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= requestObjectCacheSize {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= requestObjectCacheSize {
+			return
+		}
+	}
+
+	c.entries[key] = &requestObjectCacheEntry{
+		request:   request,
+		expiresAt: now.Add(requestObjectCacheDuration),
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+)
+
+// validateResources checks that all the provided resource indicators are
+// valid as specified at https://tools.ietf.org/html/rfc8707#section-2 and
+// refer to registered resources.
+func (p *Provider) validateResources(ctx context.Context, resources []string) error {
+	for _, resource := range resources {
+		if err := clients.ValidateResourceURI(resource); err != nil {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, err.Error())
+		}
+		if _, ok := p.clients.GetResource(ctx, resource); !ok {
+			return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, fmt.Sprintf("unknown resource: %s", resource))
+		}
+	}
+
+	return nil
+}
+
+// selectResource returns the resource an access token is issued for, from the
+// resources requested at the token endpoint and the resources granted for the
+// authorization. Requested resources must have been granted, if the grant
+// carries any. Access tokens have a single audience, so more than one resource
+// is rejected.
+func (p *Provider) selectResource(ctx context.Context, requested []string, granted []string) (string, error) {
+	if err := p.validateResources(ctx, requested); err != nil {
+		return "", err
+	}
+
+	resources := requested
+	if len(resources) == 0 {
+		resources = granted
+	} else if len(granted) > 0 {
+		for _, resource := range requested {
+			if !containsString(granted, resource) {
+				return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, fmt.Sprintf("resource not granted: %s", resource))
+			}
+		}
+	}
+
+	resources = uniqueStrings(resources)
+	switch len(resources) {
+	case 0:
+		return "", nil
+	case 1:
+		return resources[0], nil
+	default:
+		return "", konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidTarget, "only a single resource is supported per access token")
+	}
+}
+
+// accessTokenResourceOptions returns the access token options to issue an
+// access token to the client identified by the provided ID for the provided
+// resource. The access token format of the resource registration takes
+// precedence over the one of the client registration.
+func (p *Provider) accessTokenResourceOptions(ctx context.Context, clientID string, resource string) []accessTokenOption {
+	var options []accessTokenOption
+	var format string
+
+	if registration, _ := p.clients.Get(ctx, clientID); registration != nil {
+		format = registration.AccessTokenFormat
+	}
+	if resource != "" {
+		options = append(options, withResource(resource))
+		if resourceRegistration, ok := p.clients.GetResource(ctx, resource); ok && resourceRegistration.AccessTokenFormat != "" {
+			format = resourceRegistration.AccessTokenFormat
+		}
+	}
+	if format == konnectoidc.AccessTokenFormatJWT {
+		options = append(options, withJWTProfile())
+	}
+
+	return options
+}
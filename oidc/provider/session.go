@@ -19,6 +19,7 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/gob"
 	"net/http"
@@ -32,7 +33,10 @@ import (
 	"github.com/libregraph/lico/oidc/payload"
 )
 
-const sessionVersion = 2
+const (
+	sessionVersion      = 2
+	sessionClientsLimit = 16
+)
 
 func (p *Provider) getSession(req *http.Request) (*payload.Session, error) {
 	serialized, err := p.getSessionCookie(req)
@@ -52,15 +56,18 @@ func (p *Provider) updateOrCreateSession(rw http.ResponseWriter, req *http.Reque
 	session := ar.Session
 	if session != nil && session.Version == sessionVersion && session.Sub == auth.Subject() {
 		// Existing session with same sub.
-		return session, nil
-	}
-
-	// Create new session.
-	session = &payload.Session{
-		Version:  sessionVersion,
-		ID:       rndm.GenerateRandomString(32),
-		Sub:      auth.Subject(),
-		Provider: auth.Manager().Name(),
+		if !p.addSessionClient(req.Context(), session, ar.ClientID) {
+			return session, nil
+		}
+	} else {
+		// Create new session.
+		session = &payload.Session{
+			Version:  sessionVersion,
+			ID:       rndm.GenerateRandomString(32),
+			Sub:      auth.Subject(),
+			Provider: auth.Manager().Name(),
+		}
+		p.addSessionClient(req.Context(), session, ar.ClientID)
 	}
 
 	serialized, err := p.serializeSession(session)
@@ -72,6 +79,24 @@ func (p *Provider) updateOrCreateSession(rw http.ResponseWriter, req *http.Reque
 	return session, err
 }
 
+// addSessionClient adds the client identified by the provided clientID to the
+// provided session, if the client needs to be notified when the session ends.
+// Returns true if the session was changed.
+func (p *Provider) addSessionClient(ctx context.Context, session *payload.Session, clientID string) bool {
+	if len(session.Clients) >= sessionClientsLimit {
+		return false
+	}
+
+	registration, _ := p.clients.Get(ctx, clientID)
+	if registration == nil || registration.Dynamic || (registration.BackchannelLogoutURI == "" && registration.FrontchannelLogoutURI == "") {
+		// Dynamic clients are not tracked, since their IDs are too large to
+		// be kept in the session cookie.
+		return false
+	}
+
+	return session.AddClient(clientID)
+}
+
 func (p *Provider) serializeSession(session *payload.Session) (string, error) {
 	var b bytes.Buffer
 	enc := gob.NewEncoder(&b)
@@ -112,8 +137,8 @@ func (p *Provider) unserializeSession(value string) (*payload.Session, error) {
 	return &session, nil
 }
 
-func (p *Provider) getUserIDAndSessionRefFromClaims(claims *jwt.StandardClaims, sessionClaims *oidc.SessionClaims, identityClaims jwt.MapClaims) (string, *string) {
-	if claims == nil || identityClaims == nil {
+func (p *Provider) getUserIDAndSessionRefFromClaims(clientID string, sessionClaims *oidc.SessionClaims, identityClaims jwt.MapClaims) (string, *string) {
+	if identityClaims == nil {
 		return "", nil
 	}
 
@@ -136,5 +161,5 @@ func (p *Provider) getUserIDAndSessionRefFromClaims(claims *jwt.StandardClaims,
 	// NOTE(longsleep): Return the userID from claims and generate a session ref
 	// for it. Session refs use the userClaim if available and set by the
 	// underlaying backend.
-	return userIDClaim, identity.GetSessionRef(p.identityManager.Name(), claims.Audience, userClaim)
+	return userIDClaim, identity.GetSessionRef(p.identityManager.Name(), clientID, userClaim)
 }
@@ -18,10 +18,27 @@
 package provider
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/libregraph/oidc-go"
+	"golang.org/x/crypto/blake2b"
 
 	konnect "github.com/libregraph/lico"
 	"github.com/libregraph/lico/identity"
+	"github.com/libregraph/lico/identity/clients"
+	konnectoidc "github.com/libregraph/lico/oidc"
+	"github.com/libregraph/lico/oidc/payload"
+	"github.com/libregraph/lico/utils"
+)
+
+const (
+	sectorIdentifierSizeLimit = 1024 * 64
 )
 
 // PublicSubjectFromAuth creates the provideds auth Subject value with the
@@ -41,3 +58,140 @@ func (p *Provider) PublicSubjectFromAuth(auth identity.AuthRecord) (string, erro
 
 	return auth.Subject(), nil
 }
+
+// ClientSubjectFromAuth creates the provided auth Subject value as seen by the
+// client identified by the provided clientID. Clients which are registered
+// with the pairwise subject type get a different subject value per sector
+// identifier.
+func (p *Provider) ClientSubjectFromAuth(ctx context.Context, auth identity.AuthRecord, clientID string) (string, error) {
+	authorizedScopes := auth.AuthorizedScopes()
+	if ok, _ := authorizedScopes[konnect.ScopeRawSubject]; ok {
+		return p.PublicSubjectFromAuth(auth)
+	}
+
+	return p.subjectForClient(ctx, auth, clientID)
+}
+
+// subjectForClient returns the Subject value of the provided auth for the
+// client identified by the provided clientID. Auth records without user are
+// returned as is, since their subject does not identify an end-user.
+func (p *Provider) subjectForClient(ctx context.Context, auth identity.AuthRecord, clientID string) (string, error) {
+	sub := auth.Subject()
+	if auth.User() == nil || clientID == "" {
+		return sub, nil
+	}
+
+	registration, _ := p.clients.Get(ctx, clientID)
+	if registration == nil || !registration.UsesPairwiseSubject() {
+		return sub, nil
+	}
+
+	return p.makePairwiseSubject(registration.SectorIdentifier(), sub)
+}
+
+// subjectTypesSupported returns the supported subject types. Pairwise
+// subjects are only supported with a configured secret, since they must not
+// change when the secret changes.
+func (p *Provider) subjectTypesSupported() []string {
+	if len(p.pairwiseSubjectSecret) == 0 {
+		return []string{oidc.SubjectIDPublic}
+	}
+
+	return []string{oidc.SubjectIDPublic, konnectoidc.SubjectIDPairwise}
+}
+
+// makePairwiseSubject returns the pairwise Subject value for the provided
+// sector identifier and subject as specified at
+// https://openid.net/specs/openid-connect-core-1_0.html#PairwiseAlg
+func (p *Provider) makePairwiseSubject(sectorIdentifier string, sub string) (string, error) {
+	if len(p.pairwiseSubjectSecret) == 0 {
+		return "", fmt.Errorf("no pairwise subject secret")
+	}
+
+	// Secrets longer than the maximum blake2b key size are hashed to a key
+	// of that size, so secret files of any size can be used.
+	key := p.pairwiseSubjectSecret
+	if len(key) > blake2b.Size {
+		sum := blake2b.Sum512(key)
+		key = sum[:]
+	}
+
+	hasher, err := blake2b.New512(key)
+	if err != nil {
+		return "", err
+	}
+
+	hasher.Write([]byte(konnectoidc.LibreGraphPairwiseSubjectSaltV1))
+	hasher.Write([]byte(" "))
+	hasher.Write([]byte(sectorIdentifier))
+	hasher.Write([]byte(" "))
+	hasher.Write([]byte(sub))
+
+	// Use the same format as public subjects, so pairwise subjects pass the
+	// same validation patterns in third party applications.
+	s := base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+	return s[:16] + "@" + s[16:], nil
+}
+
+// makePairwiseSubjectMapper returns a function which maps public subjects to
+// the pairwise subjects of the provided client registration.
+func (p *Provider) makePairwiseSubjectMapper(registration *clients.ClientRegistration) func(string) (string, error) {
+	sectorIdentifier := registration.SectorIdentifier()
+	return func(sub string) (string, error) {
+		return p.makePairwiseSubject(sectorIdentifier, sub)
+	}
+}
+
+// validateSectorIdentifierURI retrieves the JSON array of redirect URIs found
+// at the sector_identifier_uri of the provided client registration request and
+// validates that all the requested redirect_uris are included as specified at
+// https://openid.net/specs/openid-connect-registration-1_0.html#SectorIdentifierValidation
+func (p *Provider) validateSectorIdentifierURI(ctx context.Context, crr *payload.ClientRegistrationRequest) error {
+	redirectURIs, err := p.fetchSectorIdentifierURIs(ctx, crr.SectorIdentifierURI)
+	if err != nil {
+		p.logger.WithError(err).WithField("sector_identifier_uri", crr.SectorIdentifierURI).Debugln("failed to fetch sector identifier")
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "failed to fetch sector_identifier_uri")
+	}
+
+	registered := make(map[string]bool)
+	for _, uriString := range redirectURIs {
+		registered[uriString] = true
+	}
+	for _, uriString := range crr.RedirectURIs {
+		if !registered[uriString] {
+			return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOIDCInvalidClientMetadata, "redirect_uris not included in sector_identifier_uri")
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) fetchSectorIdentifierURIs(ctx context.Context, sectorIdentifierURI string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestObjectFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sectorIdentifierURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", utils.DefaultHTTPUserAgent)
+
+	response, err := p.requestObjectClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %d", response.StatusCode)
+	}
+
+	var redirectURIs []string
+	err = json.NewDecoder(io.LimitReader(response.Body, sectorIdentifierSizeLimit)).Decode(&redirectURIs)
+	if err != nil {
+		return nil, err
+	}
+
+	return redirectURIs, nil
+}
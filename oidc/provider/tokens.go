@@ -19,26 +19,95 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-querystring/query"
 	"github.com/libregraph/oidc-go"
 	"github.com/longsleep/rndm"
 
 	konnect "github.com/libregraph/lico"
 	"github.com/libregraph/lico/identity"
+	"github.com/libregraph/lico/identity/authorities"
 	konnectoidc "github.com/libregraph/lico/oidc"
 	"github.com/libregraph/lico/oidc/payload"
 	"github.com/libregraph/lico/utils"
 )
 
+const (
+	authorizationResponseJWTDuration = 10 * time.Minute
+
+	jwtBearerAssertionMaxLifetime  = 5 * time.Minute
+	jwtBearerAssertionMaxClockSkew = 30 * time.Second
+)
+
 // MakeAccessToken implements the oidc.AccessTokenProvider interface.
 func (p *Provider) MakeAccessToken(ctx context.Context, audience string, auth identity.AuthRecord) (string, error) {
 	return p.makeAccessToken(ctx, audience, auth, nil)
 }
 
-func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth identity.AuthRecord, signingMethod jwt.SigningMethod) (string, error) {
+// An accessTokenOption modifies the claims of an access token before it is
+// signed.
+type accessTokenOption func(claims *konnect.AccessTokenClaims)
+
+// withActor returns an accessTokenOption which sets the provided actor claims.
+func withActor(actor *konnect.ActorClaims) accessTokenOption {
+	return func(claims *konnect.AccessTokenClaims) {
+		claims.Actor = actor
+	}
+}
+
+// withConfirmation returns an accessTokenOption which binds the access token
+// to the keys of the provided confirmation claims.
+func withConfirmation(confirmation *payload.ConfirmationClaims) accessTokenOption {
+	return func(claims *konnect.AccessTokenClaims) {
+		claims.Confirmation = confirmation
+	}
+}
+
+// withAccessTokenFamily returns an accessTokenOption which sets the family of
+// the refresh token grant the access token was issued with, so that the access
+// token is revoked together with that grant.
+func withAccessTokenFamily(family string) accessTokenOption {
+	return func(claims *konnect.AccessTokenClaims) {
+		claims.Family = family
+	}
+}
+
+// withAuthorizationDetails returns an accessTokenOption which sets the provided
+// approved authorization details as specified at
+// https://datatracker.ietf.org/doc/html/rfc9396#section-9.1
+func withAuthorizationDetails(authorizationDetails payload.AuthorizationDetails) accessTokenOption {
+	return func(claims *konnect.AccessTokenClaims) {
+		claims.AuthorizationDetails = authorizationDetails
+	}
+}
+
+// withResource returns an accessTokenOption which issues the access token for
+// the provided resource as specified at https://tools.ietf.org/html/rfc8707.
+// The resource becomes the audience and the client the authorized party.
+func withResource(resource string) accessTokenOption {
+	return func(claims *konnect.AccessTokenClaims) {
+		claims.AuthorizedParty = claims.Audience
+		claims.Audience = resource
+	}
+}
+
+// withJWTProfile returns an accessTokenOption which issues the access token in
+// the format specified at https://datatracker.ietf.org/doc/html/rfc9068 with
+// the standard client_id and scope claims.
+func withJWTProfile() accessTokenOption {
+	return func(claims *konnect.AccessTokenClaims) {
+		claims.ClientID = claims.Client()
+		claims.AuthorizedParty = ""
+		claims.Scope = strings.Join(claims.AuthorizedScopesList, " ")
+	}
+}
+
+func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth identity.AuthRecord, signingMethod jwt.SigningMethod, options ...accessTokenOption) (string, error) {
 	sk, ok := p.getSigningKey(signingMethod)
 	if !ok {
 		return "", fmt.Errorf("no signing key")
@@ -47,13 +116,18 @@ func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth id
 	authorizedScopes := auth.AuthorizedScopes()
 	authorizedScopesList := payload.ScopesValue(makeArrayFromBoolMap(authorizedScopes))
 
+	sub, err := p.subjectForClient(ctx, auth, audience)
+	if err != nil {
+		return "", err
+	}
+
 	accessTokenClaims := konnect.AccessTokenClaims{
 		TokenType:               konnect.TokenTypeAccessToken,
 		AuthorizedScopesList:    authorizedScopesList,
 		AuthorizedClaimsRequest: auth.AuthorizedClaims(),
 		StandardClaims: jwt.StandardClaims{
 			Issuer:    p.issuerIdentifier,
-			Subject:   auth.Subject(),
+			Subject:   sub,
 			Audience:  audience,
 			ExpiresAt: time.Now().Add(p.accessTokenDuration).Unix(),
 			IssuedAt:  time.Now().Unix(),
@@ -61,6 +135,8 @@ func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth id
 		},
 	}
 
+	accessTokenClaims.AuthContextClaims = konnectoidc.NewAuthContextClaims(auth.AuthContext())
+
 	user := auth.User()
 	if user != nil {
 		if userWithClaims, ok := user.(identity.UserWithClaims); ok {
@@ -69,6 +145,10 @@ func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth id
 		accessTokenClaims.IdentityProvider = auth.Manager().Name()
 	}
 
+	for _, option := range options {
+		option(&accessTokenClaims)
+	}
+
 	// Support additional custom user specific claims.
 	var finalAccessTokenClaims jwt.Claims = accessTokenClaims
 	if accessTokenClaims.IdentityClaims != nil {
@@ -109,6 +189,10 @@ func (p *Provider) makeAccessToken(ctx context.Context, audience string, auth id
 
 	accessToken := jwt.NewWithClaims(sk.SigningMethod, finalAccessTokenClaims)
 	accessToken.Header[oidc.JWTHeaderKeyID] = sk.ID
+	if accessTokenClaims.ClientID != "" {
+		// https://datatracker.ietf.org/doc/html/rfc9068#section-2.1
+		accessToken.Header[konnectoidc.JWTHeaderType] = konnectoidc.AccessTokenTypeJWT
+	}
 
 	return accessToken.SignedString(sk.PrivateKey)
 }
@@ -119,7 +203,7 @@ func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRe
 		return "", fmt.Errorf("no signing key")
 	}
 
-	publicSubject, err := p.PublicSubjectFromAuth(auth)
+	publicSubject, err := p.ClientSubjectFromAuth(ctx, auth, ar.ClientID)
 	if err != nil {
 		return "", err
 	}
@@ -144,6 +228,10 @@ func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRe
 		}
 	}
 
+	// Include authentication context, taken before auth is replaced by a
+	// freshly fetched record below.
+	idTokenClaims.AuthContextClaims = konnectoidc.NewAuthContextClaims(auth.AuthContext())
+
 	// Include requested scope data in ID token when no access token is
 	// generated.
 	authorizedClaimsRequest := auth.AuthorizedClaims()
@@ -276,10 +364,60 @@ func (p *Provider) makeIDToken(ctx context.Context, ar *payload.AuthenticationRe
 	idToken := jwt.NewWithClaims(sk.SigningMethod, jwt.MapClaims(idTokenClaimsMap))
 	idToken.Header[oidc.JWTHeaderKeyID] = sk.ID
 
-	return idToken.SignedString(sk.PrivateKey)
+	idTokenString, err := idToken.SignedString(sk.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Encrypt the signed token if the registered client requested it as
+	// specified in https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+	registration, _ := p.clients.Get(ctx, ar.ClientID)
+	if registration != nil && registration.RawIDTokenEncryptedResponseAlg != "" {
+		return p.encryptForClient(registration, registration.RawIDTokenEncryptedResponseAlg, registration.RawIDTokenEncryptedResponseEnc, []byte(idTokenString), true)
+	}
+
+	return idTokenString, nil
+}
+
+// A refreshTokenOption modifies the claims of a refresh token before it is
+// signed.
+type refreshTokenOption func(claims *konnect.RefreshTokenClaims)
+
+// withFamily returns a refreshTokenOption which sets the provided token family,
+// to keep the family when refresh tokens are rotated.
+func withFamily(family string) refreshTokenOption {
+	return func(claims *konnect.RefreshTokenClaims) {
+		claims.Family = family
+	}
+}
+
+// withRefreshConfirmation returns a refreshTokenOption which binds the refresh
+// token to the keys of the provided confirmation claims.
+func withRefreshConfirmation(confirmation *payload.ConfirmationClaims) refreshTokenOption {
+	return func(claims *konnect.RefreshTokenClaims) {
+		claims.Confirmation = confirmation
+	}
+}
+
+// withRefreshResources returns a refreshTokenOption which sets the provided
+// resources granted for the authorization, to keep them for access tokens
+// created with the refresh token.
+func withRefreshResources(resources []string) refreshTokenOption {
+	return func(claims *konnect.RefreshTokenClaims) {
+		claims.Resources = resources
+	}
+}
+
+// withRefreshAuthorizationDetails returns a refreshTokenOption which sets the
+// provided approved authorization details, to keep them for access tokens
+// created with the refresh token.
+func withRefreshAuthorizationDetails(authorizationDetails payload.AuthorizationDetails) refreshTokenOption {
+	return func(claims *konnect.RefreshTokenClaims) {
+		claims.AuthorizationDetails = authorizationDetails
+	}
 }
 
-func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth identity.AuthRecord, signingMethod jwt.SigningMethod) (string, error) {
+func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth identity.AuthRecord, signingMethod jwt.SigningMethod, options ...refreshTokenOption) (string, error) {
 	sk, ok := p.getSigningKey(signingMethod)
 	if !ok {
 		return "", fmt.Errorf("no signing key")
@@ -294,7 +432,12 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		}
 	}
 
-	ref, err := auth.Manager().ApproveScopes(ctx, auth.Subject(), audience, approvedScopes)
+	sub, err := p.subjectForClient(ctx, auth, audience)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := auth.Manager().ApproveScopes(ctx, sub, audience, approvedScopes)
 	if err != nil {
 		return "", err
 	}
@@ -304,9 +447,10 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		ApprovedScopesList:    approvedScopesList,
 		ApprovedClaimsRequest: auth.AuthorizedClaims(),
 		Ref:                   ref,
+		Family:                ref,
 		StandardClaims: jwt.StandardClaims{
 			Issuer:    p.issuerIdentifier,
-			Subject:   auth.Subject(),
+			Subject:   sub,
 			Audience:  audience,
 			ExpiresAt: time.Now().Add(p.refreshTokenDuration).Unix(),
 			IssuedAt:  time.Now().Unix(),
@@ -314,6 +458,10 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		},
 	}
 
+	// Remember authentication context for tokens created with this refresh
+	// token.
+	refreshTokenClaims.AuthContextClaims = konnectoidc.NewAuthContextClaims(auth.AuthContext())
+
 	user := auth.User()
 	if user != nil {
 		if userWithClaims, ok := user.(identity.UserWithClaims); ok {
@@ -322,12 +470,59 @@ func (p *Provider) makeRefreshToken(ctx context.Context, audience string, auth i
 		refreshTokenClaims.IdentityProvider = auth.Manager().Name()
 	}
 
+	for _, option := range options {
+		option(refreshTokenClaims)
+	}
+
 	refreshToken := jwt.NewWithClaims(sk.SigningMethod, refreshTokenClaims)
 	refreshToken.Header[oidc.JWTHeaderKeyID] = sk.ID
 
 	return refreshToken.SignedString(sk.PrivateKey)
 }
 
+// makeAuthorizationResponseJWT returns a signed JWT holding the provided
+// authorization response params as specified at
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.1
+func (p *Provider) makeAuthorizationResponseJWT(ctx context.Context, ar *payload.AuthenticationRequest, params interface{}) (string, error) {
+	values, err := query.Values(params)
+	if err != nil {
+		return "", err
+	}
+
+	claims := make(jwt.MapClaims)
+	for name := range values {
+		claims[name] = values.Get(name)
+	}
+	claims[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
+	claims[oidc.AudienceClaim] = ar.ClientID
+	claims[oidc.ExpirationClaim] = time.Now().Add(authorizationResponseJWTDuration).Unix()
+
+	var signingMethod jwt.SigningMethod
+	if registration, _ := p.clients.Get(ctx, ar.ClientID); registration != nil {
+		signingMethod = jwt.GetSigningMethod(registration.RawAuthorizationSignedResponseAlg)
+	}
+
+	return p.makeJWT(ctx, signingMethod, claims)
+}
+
+// makeSignedMetadata returns a signed JWT holding the provided meta data values
+// as claims as specified at https://tools.ietf.org/html/rfc8414#section-2.1
+func (p *Provider) makeSignedMetadata(metadata *WellKnown) (string, error) {
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	claims := make(jwt.MapClaims)
+	if err = json.Unmarshal(b, &claims); err != nil {
+		return "", err
+	}
+	claims[oidc.IssuerIdentifierClaim] = p.issuerIdentifier
+	claims[oidc.IssuedAtClaim] = time.Now().Unix()
+
+	return p.makeJWT(context.Background(), nil, claims)
+}
+
 func (p *Provider) makeJWT(ctx context.Context, signingMethod jwt.SigningMethod, claims jwt.Claims) (string, error) {
 	sk, ok := p.getSigningKey(signingMethod)
 	if !ok {
@@ -370,3 +565,266 @@ func (p *Provider) validateJWT(token *jwt.Token) (interface{}, error) {
 	}
 	return key, nil
 }
+
+// parseExchangeToken parses and validates the provided token as access token
+// issued by the associated provider, as used for token exchange.
+func (p *Provider) parseExchangeToken(tokenString string) (*konnect.AccessTokenClaims, error) {
+	claims := &konnect.AccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return p.validateJWT(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != p.issuerIdentifier {
+		return nil, fmt.Errorf("issuer mismatch")
+	}
+	if revoked, err := p.isRevoked(claims.Id, claims.Family); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, fmt.Errorf("token revoked")
+	}
+
+	return claims, nil
+}
+
+// verifyConfirmation checks that the token request proves possession of the
+// keys which the provided bound confirmation claims refer to, using the key of
+// the DPoP proof and the client certificate confirmation of the request.
+func verifyConfirmation(bound *payload.ConfirmationClaims, dpopJKT string, confirmation *payload.ConfirmationClaims) error {
+	if bound == nil {
+		return nil
+	}
+	if bound.JKT != "" && bound.JKT != dpopJKT {
+		return konnectoidc.NewOAuth2Error(konnectoidc.ErrorCodeOAuth2InvalidDPoPProof, "DPoP proof key mismatch")
+	}
+	if bound.X5tS256 != "" && (confirmation == nil || bound.X5tS256 != confirmation.X5tS256) {
+		return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "client certificate mismatch")
+	}
+
+	return nil
+}
+
+// parseJWTBearerAssertion parses and validates the provided assertion as
+// specified at https://tools.ietf.org/html/rfc7523#section-3 with the keys of
+// the matching trusted authority.
+func (p *Provider) parseJWTBearerAssertion(ctx context.Context, assertion string) (*authorities.Details, *jwt.Token, error) {
+	if p.authorities == nil {
+		return nil, nil, fmt.Errorf("no trusted issuers")
+	}
+
+	// Find authority by issuer, before validation.
+	unverifiedClaims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, unverifiedClaims); err != nil {
+		return nil, nil, err
+	}
+	iss, _ := unverifiedClaims[oidc.IssuerIdentifierClaim].(string)
+	if iss == "" {
+		return nil, nil, fmt.Errorf("missing iss claim")
+	}
+	registration, found := p.authorities.Find(ctx, func(authority authorities.AuthorityRegistration) bool {
+		return authority.AuthorityType() == authorities.AuthorityTypeJWTBearer && authority.Issuer() == iss
+	})
+	if !found {
+		return nil, nil, fmt.Errorf("untrusted issuer")
+	}
+	authority := registration.Authority()
+	if !authority.IsReady() {
+		return nil, nil, fmt.Errorf("issuer not ready")
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(assertion, claims, authority.JWTKeyfunc())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The assertion must be short lived and aimed at us. Parsing already
+	// rejects iat and nbf values in the future.
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Unix(), true) {
+		return nil, nil, fmt.Errorf("missing exp claim")
+	}
+	exp, _ := claims[oidc.ExpirationClaim].(float64)
+	if time.Unix(int64(exp), 0).After(now.Add(jwtBearerAssertionMaxLifetime + jwtBearerAssertionMaxClockSkew)) {
+		return nil, nil, fmt.Errorf("exp claim too far in the future")
+	}
+	if iat, ok := claims[oidc.IssuedAtClaim].(float64); ok && time.Unix(int64(exp), 0).Sub(time.Unix(int64(iat), 0)) > jwtBearerAssertionMaxLifetime {
+		return nil, nil, fmt.Errorf("assertion lifetime too long")
+	}
+	if !claims.VerifyAudience(p.issuerIdentifier, true) && !claims.VerifyAudience(p.makeIssURL(p.tokenPath), true) {
+		return nil, nil, fmt.Errorf("invalid aud claim")
+	}
+
+	return authority, token, nil
+}
+
+// introspectToken returns the introspection response for the provided token
+// string. Tokens which cannot be validated are returned as inactive. Refresh
+// tokens are only active for the client they were issued to.
+func (p *Provider) introspectToken(ctx context.Context, tokenString string, tokenTypeHint string, clientID string) *payload.IntrospectionResponse {
+	tokenTypes := []string{payload.TokenTypeHintAccessToken, payload.TokenTypeHintRefreshToken}
+	if tokenTypeHint == payload.TokenTypeHintRefreshToken {
+		tokenTypes[0], tokenTypes[1] = tokenTypes[1], tokenTypes[0]
+	}
+
+	for _, tokenType := range tokenTypes {
+		switch tokenType {
+		case payload.TokenTypeHintAccessToken:
+			claims := &konnect.AccessTokenClaims{}
+			if _, err := jwt.ParseWithClaims(tokenString, claims, p.validateJWT); err != nil {
+				continue
+			}
+			if claims.Issuer != p.issuerIdentifier {
+				continue
+			}
+			if revoked, err := p.isRevoked(claims.Id, claims.Family); err != nil || revoked {
+				continue
+			}
+			tokenType := oidc.TokenTypeBearer
+			if claims.Confirmation != nil && claims.Confirmation.JKT != "" {
+				tokenType = konnectoidc.TokenTypeDPoP
+			}
+			return &payload.IntrospectionResponse{
+				Active: true,
+
+				Scope:     strings.Join(claims.AuthorizedScopesList, " "),
+				ClientID:  claims.Client(),
+				TokenType: tokenType,
+				ExpiresAt: claims.ExpiresAt,
+				IssuedAt:  claims.IssuedAt,
+				Subject:   claims.Subject,
+				Audience:  claims.Audience,
+				Issuer:    claims.Issuer,
+				JTI:       claims.Id,
+
+				Confirmation: claims.Confirmation,
+
+				AuthorizationDetails: claims.AuthorizationDetails,
+
+				IdentityProvider: claims.IdentityProvider,
+			}
+
+		case payload.TokenTypeHintRefreshToken:
+			claims := &konnect.RefreshTokenClaims{}
+			if _, err := jwt.ParseWithClaims(tokenString, claims, p.validateJWT); err != nil {
+				continue
+			}
+			if claims.Issuer != p.issuerIdentifier || claims.Audience != clientID {
+				continue
+			}
+			if revoked, err := p.isRevoked(claims.Family, claims.Ref, claims.Id); err != nil || revoked {
+				continue
+			}
+			return &payload.IntrospectionResponse{
+				Active: true,
+
+				Scope:     strings.Join(claims.ApprovedScopesList, " "),
+				ClientID:  claims.Audience,
+				ExpiresAt: claims.ExpiresAt,
+				IssuedAt:  claims.IssuedAt,
+				Subject:   claims.Subject,
+				Audience:  claims.Audience,
+				Issuer:    claims.Issuer,
+				JTI:       claims.Id,
+
+				AuthorizationDetails: claims.AuthorizationDetails,
+
+				IdentityProvider: claims.IdentityProvider,
+			}
+		}
+	}
+
+	return &payload.IntrospectionResponse{
+		Active: false,
+	}
+}
+
+// revokeToken records the provided token string as revoked in the revocation
+// store. Access tokens are revoked by their jti, refresh tokens by their lg.f
+// family which also revokes all other refresh tokens rotated from the same
+// approval and all access tokens issued for it as specified at
+// https://tools.ietf.org/html/rfc7009#section-2.1. Tokens which cannot be
+// validated or which were not issued to the provided client are ignored.
+func (p *Provider) revokeToken(ctx context.Context, tokenString string, tokenTypeHint string, clientID string) error {
+	tokenTypes := []string{payload.TokenTypeHintAccessToken, payload.TokenTypeHintRefreshToken}
+	if tokenTypeHint == payload.TokenTypeHintRefreshToken {
+		tokenTypes[0], tokenTypes[1] = tokenTypes[1], tokenTypes[0]
+	}
+
+	for _, tokenType := range tokenTypes {
+		switch tokenType {
+		case payload.TokenTypeHintAccessToken:
+			claims := &konnect.AccessTokenClaims{}
+			if _, err := jwt.ParseWithClaims(tokenString, claims, p.validateJWT); err != nil {
+				continue
+			}
+			if claims.Issuer != p.issuerIdentifier || claims.Client() != clientID || claims.Id == "" {
+				return nil
+			}
+			return p.revocationStore.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0))
+
+		case payload.TokenTypeHintRefreshToken:
+			claims := &konnect.RefreshTokenClaims{}
+			if _, err := jwt.ParseWithClaims(tokenString, claims, p.validateJWT); err != nil {
+				continue
+			}
+			if claims.Issuer != p.issuerIdentifier || claims.Audience != clientID {
+				return nil
+			}
+			key := claims.Family
+			if key == "" {
+				key = claims.Ref
+			}
+			if key == "" {
+				key = claims.Id
+			}
+			if key == "" {
+				return nil
+			}
+			return p.revocationStore.Revoke(key, time.Unix(claims.ExpiresAt, 0))
+		}
+	}
+
+	return nil
+}
+
+// revokeReusedRefreshToken handles the reuse of a rotated refresh token by
+// revoking its whole family as specified at
+// https://tools.ietf.org/html/draft-ietf-oauth-security-topics#section-4.14.2
+// and returns the error for the token request.
+func (p *Provider) revokeReusedRefreshToken(clientID string, claims *konnect.RefreshTokenClaims) error {
+	family := claims.Family
+	if family == "" {
+		family = claims.Ref
+	}
+	if family != "" {
+		p.logger.WithField("client_id", clientID).Warnln("refresh token reuse detected, revoking token family")
+		if err := p.revocationStore.Revoke(family, time.Now().Add(p.refreshTokenDuration)); err != nil {
+			return err
+		}
+	}
+
+	return konnectoidc.NewOAuth2Error(oidc.ErrorCodeOAuth2InvalidGrant, "refresh_token revoked")
+}
+
+// isRevoked returns true if any of the provided keys was revoked in the
+// revocation store.
+func (p *Provider) isRevoked(keys ...string) (bool, error) {
+	if p.revocationStore == nil {
+		return false, nil
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if revoked, err := p.revocationStore.IsRevoked(key); err != nil {
+			return false, err
+		} else if revoked {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
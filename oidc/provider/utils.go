@@ -83,3 +83,13 @@ func makeArrayFromBoolMap(m map[string]bool) []string {
 
 	return result
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package revocation
+
+import (
+	"time"
+)
+
+// Store is a interface defining a revocation store. Revoked tokens are
+// recorded by key, which is the jti claim of access tokens or the lg.r
+// claim of refresh tokens. Keys only need to be remembered until the
+// revoked token expires.
+//
+// RevokeIfNotRevoked atomically revokes the provided key unless it was revoked
+// already and returns true if the key was revoked by the call, so that only a
+// single caller can consume a key.
+type Store interface {
+	Revoke(key string, expiresAt time.Time) error
+	RevokeIfNotRevoked(key string, expiresAt time.Time) (bool, error)
+	IsRevoked(key string) (bool, error)
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/libregraph/lico/oidc/revocation"
+)
+
+// Store provides the api and state for token revocation persisted to a JSON
+// file, so revocations survive restarts. The file maps keys to the unix
+// expiration time of the revoked token. The Store's methods are safe to call
+// from multiple Go routines, but the file must not be shared between multiple
+// processes.
+type fileStore struct {
+	mutex sync.RWMutex
+	table map[string]int64
+
+	path   string
+	logger logrus.FieldLogger
+}
+
+// NewFileStore creates a new file backed revocation Store, loading existing
+// revocations from the provided path if it exists.
+func NewFileStore(ctx context.Context, path string, logger logrus.FieldLogger) (revocation.Store, error) {
+	s := &fileStore{
+		table: make(map[string]int64),
+
+		path:   path,
+		logger: logger,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, &s.table); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		// breaks
+	default:
+		return nil, err
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *fileStore) purgeExpired() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().Unix()
+	purged := 0
+	for key, expiresAt := range s.table {
+		if expiresAt < now {
+			delete(s.table, key)
+			purged++
+		}
+	}
+	if purged > 0 {
+		if err := s.save(); err != nil {
+			s.logger.WithError(err).Errorln("failed to write revocation store file")
+		}
+	}
+}
+
+// save writes the table of the accociated Store to its file. The caller must
+// hold the write lock.
+func (s *fileStore) save() error {
+	data, err := json.Marshal(s.table)
+	if err != nil {
+		return err
+	}
+
+	// Write to temporary file in the same folder first, then rename to make
+	// the change atomic.
+	f, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// Revoke records the provided key as revoked until the provided expiration
+// time and writes the accociated Store's file.
+func (s *fileStore) Revoke(key string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.table[key] = expiresAt.Unix()
+
+	return s.save()
+}
+
+// RevokeIfNotRevoked records the provided key as revoked until the provided
+// expiration time and writes the accociated Store's file, unless the key is
+// revoked already. Returns true if the key was recorded.
+func (s *fileStore) RevokeIfNotRevoked(key string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.table[key]; ok {
+		return false, nil
+	}
+	s.table[key] = expiresAt.Unix()
+
+	return true, s.save()
+}
+
+// IsRevoked looks up the provided key in the accociated Store's table.
+func (s *fileStore) IsRevoked(key string) (bool, error) {
+	s.mutex.RLock()
+	_, ok := s.table[key]
+	s.mutex.RUnlock()
+
+	return ok, nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package stores
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/libregraph/lico/oidc/revocation"
+)
+
+func TestFileStorePersistence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "lico-revocation-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revocations.json")
+
+	store, err := NewFileStore(ctx, path, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke("key-a", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load again from the same file.
+	store, err = NewFileStore(ctx, path, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := store.IsRevoked("key-a"); !revoked {
+		t.Error("key-a must be revoked after reload")
+	}
+	if revoked, _ := store.IsRevoked("key-b"); revoked {
+		t.Error("key-b must not be revoked")
+	}
+}
+
+func TestFileStoreRevokeIfNotRevoked(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "lico-revocation-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileStore, err := NewFileStore(ctx, filepath.Join(dir, "revocations.json"), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]revocation.Store{
+		"file":   fileStore,
+		"memory": NewMemoryMapStore(ctx),
+	} {
+		if revoked, err := store.RevokeIfNotRevoked("key-a", time.Now().Add(time.Hour)); err != nil || !revoked {
+			t.Errorf("%s: first revocation of key-a must succeed, got %v %v", name, revoked, err)
+		}
+		if revoked, err := store.RevokeIfNotRevoked("key-a", time.Now().Add(time.Hour)); err != nil || revoked {
+			t.Errorf("%s: second revocation of key-a must report already revoked, got %v %v", name, revoked, err)
+		}
+		if revoked, _ := store.IsRevoked("key-a"); !revoked {
+			t.Errorf("%s: key-a must be revoked", name)
+		}
+	}
+}
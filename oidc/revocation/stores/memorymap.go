@@ -0,0 +1,88 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package stores
+
+import (
+	"context"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+
+	"github.com/libregraph/lico/oidc/revocation"
+)
+
+// Store provides the api and state for in-memory token revocation. The
+// Store's methods are safe to call from multiple Go routines.
+type memoryMapStore struct {
+	table cmap.ConcurrentMap
+}
+
+// NewMemoryMapStore creates a new in-memory revocation Store.
+func NewMemoryMapStore(ctx context.Context) revocation.Store {
+	s := &memoryMapStore{
+		table: cmap.New(),
+	}
+
+	// Cleanup function.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *memoryMapStore) purgeExpired() {
+	var expired []string
+	now := time.Now()
+	for entry := range s.table.IterBuffered() {
+		if entry.Val.(time.Time).Before(now) {
+			expired = append(expired, entry.Key)
+		}
+	}
+	for _, key := range expired {
+		s.table.Remove(key)
+	}
+}
+
+// Revoke records the provided key as revoked until the provided expiration
+// time in the accociated Store's table.
+func (s *memoryMapStore) Revoke(key string, expiresAt time.Time) error {
+	s.table.Set(key, expiresAt)
+
+	return nil
+}
+
+// RevokeIfNotRevoked records the provided key as revoked until the provided
+// expiration time in the accociated Store's table, unless the key is revoked
+// already. Returns true if the key was recorded.
+func (s *memoryMapStore) RevokeIfNotRevoked(key string, expiresAt time.Time) (bool, error) {
+	return s.table.SetIfAbsent(key, expiresAt), nil
+}
+
+// IsRevoked looks up the provided key in the accociated Store's table.
+func (s *memoryMapStore) IsRevoked(key string) (bool, error) {
+	return s.table.Has(key), nil
+}
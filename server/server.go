@@ -19,6 +19,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"os"
@@ -128,8 +129,20 @@ func (s *Server) Serve(ctx context.Context) error {
 	srv := &http.Server{
 		Handler: s.AddContext(serveCtx, router),
 	}
+	withTLS := s.Config.Config.TLSCertFile != ""
+	if withTLS {
+		// Request but do not verify client certificates, they are validated
+		// by the handlers which use them for client authentication.
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientAuth: tls.RequestClientCert,
+		}
+	}
 
-	logger.WithField("listenAddr", s.listenAddr).Infoln("starting http listener")
+	logger.WithFields(logrus.Fields{
+		"listenAddr": s.listenAddr,
+		"tls":        withTLS,
+	}).Infoln("starting http listener")
 	listener, err := net.Listen("tcp", s.listenAddr)
 	if err != nil {
 		return err
@@ -137,7 +150,12 @@ func (s *Server) Serve(ctx context.Context) error {
 	logger.Infoln("ready to handle requests")
 
 	go func() {
-		serveErr := srv.Serve(listener)
+		var serveErr error
+		if withTLS {
+			serveErr = srv.ServeTLS(listener, s.Config.Config.TLSCertFile, s.Config.Config.TLSKeyFile)
+		} else {
+			serveErr = srv.Serve(listener)
+		}
 		if serveErr != nil {
 			errCh <- serveErr
 		}